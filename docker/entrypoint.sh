@@ -1,20 +1,74 @@
 #!/bin/sh
 
+# Sites that already run DHCP/TFTP or a Docker registry can start the
+# container with SEXTANT_DHCP=off or SEXTANT_REGISTRY=off, so only
+# cloud-config-server, which serves the render path over HTTP, runs.
+# SEXTANT_ALERT_URL, if set, receives alerts like nodes in boot loops.
+# SEXTANT_SSH_CA=on signs the SSH host keys of nodes with the CA in
+# /bsroot/tls/ssh-ca, and user certificates of the operators listed
+# in /bsroot/tls/ssh-cert-tokens via /ssh-cert.
+# SEXTANT_ARP_PROBE_IFACE, if set, is the provisioning interface on
+# which the fixed IPs of nodes are ARP probed for conflicts.
+# SEXTANT_DNS_CHECK_SERVER, if set, is the authoritative server of
+# the external DNS zone the records of nodes are checked against.
+# SEXTANT_ACCESS_LOG=clf or json logs requests for configs and
+# artifacts to /bsroot/logs/access.log in that format.
+# Operators changing the cluster via HTTP, like editing cluster-desc,
+# authenticate with the bearer tokens in /bsroot/tls/admin-tokens.
+# cloud-config-server also serves https on 8443 with the certificate
+# of the bootstrapper, which nodes fetch the CA bundle from.
+
 # start dnsmasq
-mkdir -p /bsroot/dnsmasq
-dnsmasq --log-facility=-  --conf-file=/bsroot/config/dnsmasq.conf \
-  --dhcp-leasefile=/bsroot/dnsmasq/dnsmasq.leases
+if [ "$SEXTANT_DHCP" != "off" ]; then
+  mkdir -p /bsroot/dnsmasq
+  dnsmasq --log-facility=-  --conf-file=/bsroot/config/dnsmasq.conf \
+    --dhcp-leasefile=/bsroot/dnsmasq/dnsmasq.leases
+fi
+
+# keep the standby exports of dnsmasq.conf in step with edits of
+# cluster-desc.yml
+for standby in isc-dhcpd.conf kea-dhcp4.json bind.zone; do
+  if [ -f /bsroot/config/standby/$standby.template ]; then
+    /go/bin/addons -watch 10s -cluster-desc-file /bsroot/config/cluster-desc.yml \
+      -template-file /bsroot/config/standby/$standby.template \
+      -config-file /bsroot/html/static/standby/$standby &
+  fi
+done
 
 # start cloud-config-server
+ssh_ca_flags=""
+if [ "$SEXTANT_SSH_CA" = "on" ]; then
+  ssh_ca_flags="-certgen.ssh-ca-key /bsroot/tls/ssh-ca -ssh-cert-tokens /bsroot/tls/ssh-cert-tokens"
+fi
+access_log_flags=""
+if [ -n "$SEXTANT_ACCESS_LOG" ]; then
+  access_log_flags="-access-log /bsroot/logs/access.log -access-log-format $SEXTANT_ACCESS_LOG"
+fi
 /go/bin/cloud-config-server -addr ":80" \
+  -tls-addr ":8443" \
+  -tls-crt /bsroot/tls/bootstrapper.crt \
+  -tls-key /bsroot/tls/bootstrapper.key \
   -dir /bsroot/html/static \
   -cloud-config-dir /bsroot/config/templatefiles \
   -cluster-desc /bsroot/config/cluster-desc.yml \
+  -report-dir /bsroot/reports \
+  -proxy-cache-dir /bsroot/proxy-cache \
+  -history-dir /bsroot/history \
+  -freeze-file /bsroot/freeze.json \
+  -admin-tokens /bsroot/tls/admin-tokens \
+  -ca-bundle /bsroot/config/ca-bundle.pem \
+  -alert-url "$SEXTANT_ALERT_URL" \
+  $ssh_ca_flags \
+  $access_log_flags \
+  -arp-probe-iface "$SEXTANT_ARP_PROBE_IFACE" \
+  -dns-check-server "$SEXTANT_DNS_CHECK_SERVER" \
   -ca-crt /bsroot/tls/ca.pem \
   -ca-key /bsroot/tls/ca-key.pem &
 
 # start registry
-/go/bin/registry serve /bsroot/config/registry.yml &
-sleep 2
+if [ "$SEXTANT_REGISTRY" != "off" ]; then
+  /go/bin/registry serve /bsroot/config/registry.yml &
+  sleep 2
+fi
 
 wait
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"log"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/k8sp/sextant/golang/clusterdesc"
 	"github.com/topicai/candy"
@@ -31,6 +36,16 @@ type addonsConfig struct {
 	MasterHostname      string
 	SetNTP              bool
 	DNSMASQLease        string
+	Nodes               []clusterdesc.Node
+	Kubernetes          clusterdesc.KubernetesFeatures
+
+	// For the standby exports of dnsmasq.conf for ISC dhcpd, Kea
+	// and BIND, see standby.go.
+	Subnet       string
+	SubnetCIDR   string
+	LeaseSeconds int64
+	Reservations []reservation
+	Serial       int64
 }
 
 func execute(templateFile string, config *clusterdesc.Cluster, w io.Writer) {
@@ -53,11 +68,19 @@ func execute(templateFile string, config *clusterdesc.Cluster, w io.Writer) {
 		Dockerdomain:        config.Dockerdomain,
 		K8sClusterDNS:       config.K8sClusterDNS,
 		EtcdEndpoint:        strings.Split(config.GetEtcdEndpoints(), ",")[0],
-		Images:              config.Images,
+		Images:              config.PinnedImages(),
 		IngressHostNetwork:  config.IngressHostNetwork,
 		MasterHostname:      config.GetMasterHostname(),
 		SetNTP:              config.DNSMASQSetNTP,
 		DNSMASQLease:        config.DNSMASQLease,
+		Nodes:               config.Nodes,
+		Kubernetes:          config.Kubernetes(),
+
+		Subnet:       config.Subnet,
+		SubnetCIDR:   config.SubnetCIDR(),
+		LeaseSeconds: leaseSeconds(config.DNSMASQLease),
+		Reservations: reservationsOf(config),
+		Serial:       time.Now().Unix(),
 	}
 
 	candy.Must(tmpl.Execute(w, ac))
@@ -67,15 +90,56 @@ func main() {
 	clusterDescFile := flag.String("cluster-desc-file", "./cluster-desc.yml", "Local copy of cluster description YAML file.")
 	templateFile := flag.String("template-file", "./ingress.template", "config file template.")
 	configFile := flag.String("config-file", "./ingress.yaml", "config file with yaml")
+	watch := flag.Duration("watch", 0, "If not 0, keep running and generate config-file again whenever cluster-desc-file changes, checking at this interval, like for the standby exports of dnsmasq.conf.")
 	flag.Parse()
 
-	d, e := ioutil.ReadFile(*clusterDescFile)
-	candy.Must(e)
+	if *watch == 0 {
+		d, e := ioutil.ReadFile(*clusterDescFile)
+		candy.Must(e)
+		candy.Must(generate(d, *templateFile, *configFile))
+		return
+	}
+	// Until cluster-desc is valid again, the last config generated
+	// stays.
+	var last []byte
+	for ; ; time.Sleep(*watch) {
+		d, e := ioutil.ReadFile(*clusterDescFile)
+		if e != nil {
+			log.Printf("Cannot read %s: %v", *clusterDescFile, e)
+			continue
+		}
+		if last != nil && bytes.Equal(d, last) {
+			continue
+		}
+		if e := generate(d, *templateFile, *configFile); e != nil {
+			log.Printf("Cannot generate %s: %v", *configFile, e)
+			continue
+		}
+		last = d
+	}
+}
 
+// generate writes configFile from templateFile and the cluster-desc
+// in clusterDesc.  It writes to a temporary file and renames it, so
+// readers never see a partially written config.
+func generate(clusterDesc []byte, templateFile, configFile string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
 	c := &clusterdesc.Cluster{
 		DNSMASQSetNTP: false,
 		DNSMASQLease:  "24h",
 	}
-	candy.Must(yaml.Unmarshal(d, c))
-	candy.WithCreated(*configFile, func(w io.Writer) { execute(*templateFile, c, w) })
+	if e := yaml.Unmarshal(clusterDesc, c); e != nil {
+		return e
+	}
+	var b bytes.Buffer
+	execute(templateFile, c, &b)
+	tmp := configFile + ".tmp"
+	if e := ioutil.WriteFile(tmp, b.Bytes(), 0644); e != nil {
+		return e
+	}
+	return os.Rename(tmp, configFile)
 }
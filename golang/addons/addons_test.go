@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
+	"os"
 	"testing"
 
 	tpcfg "github.com/k8sp/sextant/golang/clusterdesc"
@@ -30,3 +32,125 @@ func TestExecute(t *testing.T) {
 	initialEtcdCluster := yml["metadata"].(map[interface{}]interface{})["name"]
 	assert.Equal(t, initialEtcdCluster, "nginx-ingress-controller-v1")
 }
+
+func TestExecuteDeploymentAPIVersion(t *testing.T) {
+	for v, apiVersion := range map[string]string{"1.5": "extensions/v1beta1", "1.7": "apps/v1beta1"} {
+		for _, f := range []string{"ingress", "default-backend", "dashboard-controller"} {
+			var out bytes.Buffer
+			execute("./template/"+f+".template", &tpcfg.Cluster{KubernetesVersion: v}, &out)
+			assert.Contains(t, out.String(), "apiVersion: "+apiVersion+"\nkind: Deployment\n", f)
+		}
+	}
+}
+
+func TestExecuteDNSMasqHostRecords(t *testing.T) {
+	config := &tpcfg.Cluster{
+		DomainName: "example.com",
+		Nodes: []tpcfg.Node{
+			{MAC: "00:25:90:c0:f7:80", IP: "10.10.14.200"},
+			{MAC: "0c:c4:7a:82:c5:bc"},
+		},
+	}
+
+	var conf bytes.Buffer
+	execute("./template/dnsmasq.conf.template", config, &conf)
+	assert.Contains(t, conf.String(), "dhcp-host=00:25:90:c0:f7:80,10.10.14.200,00-25-90-c0-f7-80\n")
+	assert.Contains(t, conf.String(), "host-record=00-25-90-c0-f7-80.example.com,00-25-90-c0-f7-80,10.10.14.200\n")
+	assert.Contains(t, conf.String(), "dhcp-host=0c:c4:7a:82:c5:bc,0c-c4-7a-82-c5-bc\n")
+}
+
+func TestExecuteDNSMasqSkipsQuarantined(t *testing.T) {
+	config := &tpcfg.Cluster{
+		Nodes: []tpcfg.Node{{MAC: "00:25:90:c0:f7:80", IP: "10.10.14.200", Quarantine: "burn-in failed"}},
+	}
+
+	var conf bytes.Buffer
+	execute("./template/dnsmasq.conf.template", config, &conf)
+	assert.NotContains(t, conf.String(), "00:25:90:c0:f7:80")
+}
+
+func TestExecuteStandbyExports(t *testing.T) {
+	config := &tpcfg.Cluster{
+		Bootstrapper: "10.10.14.253",
+		Subnet:       "10.10.14.0",
+		Netmask:      "255.255.255.0",
+		IPLow:        "10.10.14.1",
+		IPHigh:       "10.10.14.127",
+		Routers:      []string{"10.10.14.254"},
+		Nameservers:  []string{"10.10.14.253"},
+		DomainName:   "example.com",
+		Dockerdomain: "bootstrapper",
+		DNSMASQLease: "24h",
+		Nodes: []tpcfg.Node{
+			{MAC: "00:25:90:c0:f7:80", IP: "10.10.14.200"},
+			{MAC: "00:25:90:c0:f7:81", IP: "10.10.14.201", Quarantine: "burn-in failed"},
+			{MAC: "0c:c4:7a:82:c5:bc"},
+		},
+	}
+
+	// Nodes without a fixed IP are reserved their hostname.
+	var isc bytes.Buffer
+	execute("./template/isc-dhcpd.conf.template", config, &isc)
+	assert.Contains(t, isc.String(), "subnet 10.10.14.0 netmask 255.255.255.0 {\n  range 10.10.14.1 10.10.14.127;\n")
+	assert.Contains(t, isc.String(), "default-lease-time 86400;\n")
+	assert.Contains(t, isc.String(), "host 00-25-90-c0-f7-80 {\n  hardware ethernet 00:25:90:c0:f7:80;\n  fixed-address 10.10.14.200;\n")
+	assert.NotContains(t, isc.String(), "00:25:90:c0:f7:81")
+	assert.Contains(t, isc.String(), "host 0c-c4-7a-82-c5-bc {\n  hardware ethernet 0c:c4:7a:82:c5:bc;\n  option host-name \"0c-c4-7a-82-c5-bc\";\n")
+
+	var kea bytes.Buffer
+	execute("./template/kea-dhcp4.json.template", config, &kea)
+	var k struct {
+		Dhcp4 struct {
+			Subnet4 []struct {
+				Subnet       string
+				Reservations []map[string]string
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(kea.Bytes(), &k))
+	assert.Equal(t, "10.10.14.0/24", k.Dhcp4.Subnet4[0].Subnet)
+	assert.Equal(t, []map[string]string{{
+		"hw-address": "00:25:90:c0:f7:80",
+		"ip-address": "10.10.14.200",
+		"hostname":   "00-25-90-c0-f7-80",
+	}, {
+		"hw-address": "0c:c4:7a:82:c5:bc",
+		"hostname":   "0c-c4-7a-82-c5-bc",
+	}}, k.Dhcp4.Subnet4[0].Reservations)
+
+	var zone bytes.Buffer
+	execute("./template/bind.zone.template", config, &zone)
+	assert.Contains(t, zone.String(), "$ORIGIN example.com.\n")
+	assert.Contains(t, zone.String(), "bootstrapper IN A 10.10.14.253\n")
+	assert.Contains(t, zone.String(), "00-25-90-c0-f7-80 IN A 10.10.14.200")
+	assert.NotContains(t, zone.String(), "10.10.14.201")
+	assert.NotContains(t, zone.String(), "0c-c4-7a-82-c5-bc")
+}
+
+func TestGenerate(t *testing.T) {
+	f, e := ioutil.TempFile("", "")
+	candy.Must(e)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	b, e := yaml.Marshal(tpcfg.Cluster{DomainName: "example.com", Dockerdomain: "bootstrapper", Bootstrapper: "10.10.14.253"})
+	candy.Must(e)
+	assert.Nil(t, generate(b, "./template/bind.zone.template", f.Name()))
+	zone, e := ioutil.ReadFile(f.Name())
+	candy.Must(e)
+	assert.Contains(t, string(zone), "bootstrapper IN A 10.10.14.253\n")
+
+	// A broken cluster-desc leaves the config generated before.
+	assert.NotNil(t, generate([]byte("{"), "./template/bind.zone.template", f.Name()))
+	assert.NotNil(t, generate(b, "./template/missing.template", f.Name()))
+	again, e := ioutil.ReadFile(f.Name())
+	candy.Must(e)
+	assert.Equal(t, zone, again)
+}
+
+func TestLeaseSeconds(t *testing.T) {
+	assert.Equal(t, int64(86400), leaseSeconds("24h"))
+	assert.Equal(t, int64(600), leaseSeconds("600"))
+	assert.Equal(t, int64(infiniteLease), leaseSeconds("infinite"))
+	assert.Equal(t, int64(3600), leaseSeconds(""))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// infiniteLease is how ISC dhcpd and Kea spell dnsmasq's "infinite".
+const infiniteLease = 4294967295
+
+// reservation binds a hostname, and a fixed IP if any, to a node's
+// MAC, like the dhcp-host lines of dnsmasq.conf, for the standby
+// exports.
+type reservation struct {
+	MAC      string
+	IP       string // Empty for a node leased an IP from the range.
+	Hostname string
+}
+
+// reservationsOf returns the reservations dnsmasq.conf makes: those
+// of enlisted nodes that aren't quarantined, with or without an IP.
+func reservationsOf(c *clusterdesc.Cluster) []reservation {
+	var rs []reservation
+	for _, n := range c.Nodes {
+		if n.Quarantined() {
+			continue
+		}
+		rs = append(rs, reservation{MAC: n.Mac(), IP: n.IP, Hostname: n.Hostname()})
+	}
+	return rs
+}
+
+// leaseSeconds converts a dnsmasq lease time, like 24h, 45m, 3600 or
+// infinite, to seconds.  It defaults to dnsmasq's one hour.
+func leaseSeconds(lease string) int64 {
+	if lease == "infinite" {
+		return infiniteLease
+	}
+	if s, e := strconv.ParseInt(lease, 10, 64); e == nil {
+		return s
+	}
+	if d, e := time.ParseDuration(lease); e == nil {
+		return int64(d / time.Second)
+	}
+	return int64(time.Hour / time.Second)
+}
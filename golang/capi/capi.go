@@ -0,0 +1,328 @@
+// capi translates the nodes in cluster-desc into Cluster API
+// manifests, so that the cluster can be moved to CAPI-based management
+// incrementally, with sextant still serving DHCP and PXE:
+//
+//	capi -cluster-desc cluster-desc.yml -cluster-name prod > capi.yaml
+//
+// Every node becomes a BareMetalHost of metal3.  Masters and etcd
+// members, which are bound to their hosts, also become a Machine each,
+// and workers a MachineDeployment.  The Metal3Machine and
+// Metal3MachineTemplate they refer to as infrastructure are left to
+// the setup of the infrastructure provider.
+//
+// With -import, it reads such manifests, maybe changed, and prints the
+// nodes section of cluster-desc their BareMetalHosts describe:
+//
+//	capi -import capi.yaml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+const labelPrefix = "sextant.k8sp.io/"
+
+type objectMeta struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// bareMetalHostSpec has no bmc, as sextant doesn't know the BMCs of
+// nodes, so online is left unset too: metal3 can't power hosts without
+// a BMC, and nodes keep booting from sextant.
+type bareMetalHostSpec struct {
+	BootMACAddress string `yaml:"bootMACAddress"`
+}
+
+type bareMetalHost struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   objectMeta        `yaml:"metadata"`
+	Spec       bareMetalHostSpec `yaml:"spec"`
+}
+
+type objectRef struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+}
+
+// bootstrap names the secret of the bootstrap data of machines.  Nodes
+// keep fetching their cloud-config from sextant, so the secret only
+// satisfies CAPI.
+type bootstrap struct {
+	DataSecretName string `yaml:"dataSecretName"`
+}
+
+type machineSpec struct {
+	ClusterName       string    `yaml:"clusterName"`
+	Version           string    `yaml:"version,omitempty"`
+	Bootstrap         bootstrap `yaml:"bootstrap"`
+	InfrastructureRef objectRef `yaml:"infrastructureRef"`
+}
+
+type machine struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   objectMeta  `yaml:"metadata"`
+	Spec       machineSpec `yaml:"spec"`
+}
+
+type labelSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type machineTemplate struct {
+	Metadata struct {
+		Labels map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+	Spec machineSpec `yaml:"spec"`
+}
+
+type machineDeploymentSpec struct {
+	ClusterName string          `yaml:"clusterName"`
+	Replicas    int             `yaml:"replicas"`
+	Selector    labelSelector   `yaml:"selector"`
+	Template    machineTemplate `yaml:"template"`
+}
+
+type machineDeployment struct {
+	APIVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Metadata   objectMeta            `yaml:"metadata"`
+	Spec       machineDeploymentSpec `yaml:"spec"`
+}
+
+const (
+	capiVersion  = "cluster.x-k8s.io/v1beta1"
+	metal3Infra  = "infrastructure.cluster.x-k8s.io/v1beta1"
+	clusterLabel = "cluster.x-k8s.io/cluster-name"
+)
+
+func main() {
+	clusterDesc := flag.String("cluster-desc", "./cluster-desc.yml", "Configurations for a k8s cluster.")
+	clusterName := flag.String("cluster-name", "sextant", "Name of the CAPI Cluster the exported Machines belong to.")
+	namespace := flag.String("namespace", "", "Namespace of the exported manifests.")
+	importFile := flag.String("import", "", "BareMetalHost manifests to print the nodes section of cluster-desc from.")
+	flag.Parse()
+
+	if len(*importFile) > 0 {
+		b, e := ioutil.ReadFile(*importFile)
+		candy.Must(e)
+		nodes, e := importHosts(string(b))
+		candy.Must(e)
+		out, e := yaml.Marshal(map[string][]clusterdesc.Node{"nodes": nodes})
+		candy.Must(e)
+		os.Stdout.Write(out)
+		return
+	}
+
+	b, e := ioutil.ReadFile(*clusterDesc)
+	candy.Must(e)
+	c := &clusterdesc.Cluster{}
+	candy.Must(yaml.Unmarshal(b, c))
+	candy.Must(export(os.Stdout, c, *clusterName, *namespace))
+}
+
+func boolLabel(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// nodeAnnotations are the annotations of the node fields that aren't
+// labels, encoded in JSON if not strings.  Empty fields are left out.
+func nodeAnnotations(n clusterdesc.Node) (map[string]string, error) {
+	a := map[string]string{}
+	for k, v := range map[string]string{
+		"ip":              n.IP,
+		"quarantine":      n.Quarantine,
+		"kube-reserved":   n.KubeReserved,
+		"system-reserved": n.SystemReserved,
+	} {
+		if len(v) > 0 {
+			a[labelPrefix+k] = v
+		}
+	}
+	for k, v := range map[string]interface{}{
+		"systemd-dropins": n.SystemdDropIns,
+		"sysctl":          n.Sysctl,
+	} {
+		if b, e := json.Marshal(v); e != nil {
+			return nil, e
+		} else if string(b) != "null" {
+			a[labelPrefix+k] = string(b)
+		}
+	}
+	if n.Hardware != (clusterdesc.Hardware{}) {
+		b, e := json.Marshal(n.Hardware)
+		if e != nil {
+			return nil, e
+		}
+		a[labelPrefix+"hardware"] = string(b)
+	}
+	return a, nil
+}
+
+// writeManifest writes m as a YAML document to w, after a separator
+// unless it is the first.
+func writeManifest(w io.Writer, m interface{}, first bool) error {
+	b, e := yaml.Marshal(m)
+	if e != nil {
+		return e
+	}
+	if !first {
+		fmt.Fprintln(w, "---")
+	}
+	_, e = fmt.Fprintln(w, strings.TrimSuffix(string(b), "\n"))
+	return e
+}
+
+// export writes a BareMetalHost manifest for every node enlisted in c.
+// Roles and the rack become labels, and the other node fields
+// annotations.  Masters and etcd members become Machines of cluster,
+// bound to their hosts by name, and the other nodes but quarantined
+// ones replicas of the MachineDeployment <cluster>-workers.
+func export(w io.Writer, c *clusterdesc.Cluster, cluster, namespace string) error {
+	first := true
+	workers := 0
+	for _, n := range c.Nodes {
+		annotations, e := nodeAnnotations(n)
+		if e != nil {
+			return e
+		}
+		h := bareMetalHost{
+			APIVersion: "metal3.io/v1alpha1",
+			Kind:       "BareMetalHost",
+			Metadata: objectMeta{
+				Name:      n.Hostname(),
+				Namespace: namespace,
+				Labels: map[string]string{
+					labelPrefix + "kube-master":   boolLabel(n.KubeMaster),
+					labelPrefix + "etcd-member":   boolLabel(n.EtcdMember),
+					labelPrefix + "ceph-monitor":  boolLabel(n.CephMonitor),
+					labelPrefix + "ingress":       boolLabel(n.IngressLabel),
+					labelPrefix + "gpu":           boolLabel(n.GPU),
+					labelPrefix + "flannel-iface": n.FlannelIface,
+					labelPrefix + "rack":          n.Rack,
+				},
+				Annotations: annotations,
+			},
+			Spec: bareMetalHostSpec{BootMACAddress: n.Mac()},
+		}
+		if e := writeManifest(w, h, first); e != nil {
+			return e
+		}
+		first = false
+
+		// Quarantined nodes boot the diagnostic profile only.
+		switch {
+		case n.Quarantined():
+		case n.KubeMaster || n.EtcdMember:
+			m := machine{
+				APIVersion: capiVersion,
+				Kind:       "Machine",
+				Metadata: objectMeta{
+					Name:      n.Hostname(),
+					Namespace: namespace,
+					Labels:    map[string]string{clusterLabel: cluster},
+				},
+				Spec: machineSpec{
+					ClusterName:       cluster,
+					Version:           c.KubernetesVersion,
+					Bootstrap:         bootstrap{DataSecretName: cluster + "-sextant"},
+					InfrastructureRef: objectRef{APIVersion: metal3Infra, Kind: "Metal3Machine", Name: n.Hostname()},
+				},
+			}
+			if e := writeManifest(w, m, false); e != nil {
+				return e
+			}
+		default:
+			workers++
+		}
+	}
+
+	d := machineDeployment{
+		APIVersion: capiVersion,
+		Kind:       "MachineDeployment",
+		Metadata: objectMeta{
+			Name:      cluster + "-workers",
+			Namespace: namespace,
+			Labels:    map[string]string{clusterLabel: cluster},
+		},
+		Spec: machineDeploymentSpec{
+			ClusterName: cluster,
+			Replicas:    workers,
+			Selector:    labelSelector{MatchLabels: map[string]string{clusterLabel: cluster, labelPrefix + "pool": "workers"}},
+		},
+	}
+	d.Spec.Template.Metadata.Labels = d.Spec.Selector.MatchLabels
+	d.Spec.Template.Spec = machineSpec{
+		ClusterName:       cluster,
+		Version:           c.KubernetesVersion,
+		Bootstrap:         bootstrap{DataSecretName: cluster + "-sextant"},
+		InfrastructureRef: objectRef{APIVersion: metal3Infra, Kind: "Metal3MachineTemplate", Name: cluster + "-workers"},
+	}
+	return writeManifest(w, d, first)
+}
+
+// importHosts translates BareMetalHost manifests, as written by export
+// and maybe changed since, back into nodes.  Other manifests are
+// skipped.
+func importHosts(manifests string) ([]clusterdesc.Node, error) {
+	var nodes []clusterdesc.Node
+	for _, doc := range strings.Split(manifests, "\n---") {
+		if len(strings.TrimSpace(doc)) == 0 {
+			continue
+		}
+		h := bareMetalHost{}
+		if e := yaml.Unmarshal([]byte(doc), &h); e != nil {
+			return nil, e
+		}
+		if h.Kind != "BareMetalHost" {
+			continue
+		}
+		l, a := h.Metadata.Labels, h.Metadata.Annotations
+		n := clusterdesc.Node{
+			MAC:          h.Spec.BootMACAddress,
+			IP:           a[labelPrefix+"ip"],
+			KubeMaster:   l[labelPrefix+"kube-master"] == "true",
+			EtcdMember:   l[labelPrefix+"etcd-member"] == "true",
+			CephMonitor:  l[labelPrefix+"ceph-monitor"] == "true",
+			IngressLabel: l[labelPrefix+"ingress"] == "true",
+			GPU:          l[labelPrefix+"gpu"] == "true",
+			FlannelIface: l[labelPrefix+"flannel-iface"],
+			Rack:         l[labelPrefix+"rack"],
+			Quarantine:   a[labelPrefix+"quarantine"],
+
+			KubeReserved:   a[labelPrefix+"kube-reserved"],
+			SystemReserved: a[labelPrefix+"system-reserved"],
+		}
+		for k, v := range map[string]interface{}{
+			"systemd-dropins": &n.SystemdDropIns,
+			"sysctl":          &n.Sysctl,
+			"hardware":        &n.Hardware,
+		} {
+			if s, ok := a[labelPrefix+k]; ok {
+				if e := json.Unmarshal([]byte(s), v); e != nil {
+					return nil, fmt.Errorf("annotation %s%s of %s: %v", labelPrefix, k, h.Metadata.Name, e)
+				}
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
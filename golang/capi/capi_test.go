@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestExportImport(t *testing.T) {
+	c := &clusterdesc.Cluster{Nodes: []clusterdesc.Node{
+		{MAC: "00:25:90:C0:F7:80", IP: "10.10.14.2", KubeMaster: true, EtcdMember: true, Rack: "r1"},
+		{MAC: "00:25:90:c0:f7:81", Quarantine: "burn-in"},
+		{
+			MAC:            "00:25:90:c0:f7:82",
+			SystemdDropIns: map[string]clusterdesc.DropIn{"docker.service": {"Service": {"LimitNOFILE": {"1048576"}}}},
+			Hardware:       clusterdesc.Hardware{CPUs: 32, MemoryMB: 131072},
+			KubeReserved:   "cpu=500m",
+			SystemReserved: "memory=1Gi",
+			Sysctl:         map[string]string{"vm.swappiness": "0"},
+		},
+	}}
+	var b bytes.Buffer
+	assert.Nil(t, export(&b, c, "prod", "sextant"))
+	// The master is a Machine, the worker a replica of the
+	// MachineDeployment, and the quarantined node neither.
+	kinds := map[string]int{}
+	for _, doc := range strings.Split(b.String(), "\n---") {
+		d := machineDeployment{}
+		assert.Nil(t, yaml.Unmarshal([]byte(doc), &d))
+		kinds[d.Kind]++
+		if d.Kind == "MachineDeployment" {
+			assert.Equal(t, "prod-workers", d.Metadata.Name)
+			assert.Equal(t, 1, d.Spec.Replicas)
+		}
+	}
+	assert.Equal(t, map[string]int{"BareMetalHost": 3, "Machine": 1, "MachineDeployment": 1}, kinds)
+
+	nodes, e := importHosts(b.String())
+	assert.Nil(t, e)
+	assert.Equal(t, 3, len(nodes))
+	c.Nodes[0].MAC = "00:25:90:c0:f7:80"
+	assert.Equal(t, c.Nodes, nodes)
+}
@@ -1,6 +1,9 @@
 package certgen
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"html/template"
 	"io"
 	"io/ioutil"
@@ -78,6 +81,24 @@ func GenerateCA(caKey string, caCrt string) error {
 	return nil
 }
 
+// NodeToken returns the credential that the node hostname presents
+// to the bootstrapper, like when uploading its first-boot report.  It
+// is an HMAC of hostname keyed by caKey, so only the bootstrapper
+// issues and checks it.
+func NodeToken(caKey, hostname string) (string, error) {
+	return currentSigner().NodeToken(caKey, hostname)
+}
+
+func nodeToken(caKey, hostname string) (string, error) {
+	k, e := ioutil.ReadFile(caKey)
+	if e != nil {
+		return "", e
+	}
+	m := hmac.New(sha256.New, k)
+	m.Write([]byte("sextant node " + hostname))
+	return hex.EncodeToString(m.Sum(nil)), nil
+}
+
 func openSSLCnfTmpl(master bool) *template.Template {
 	if master == true {
 		return template.Must(template.New("").Funcs(funcMap).Parse(masterOpenSSLConfTmpl))
@@ -87,6 +108,10 @@ func openSSLCnfTmpl(master bool) *template.Template {
 
 // Gen generates and returns the TLS certse.  It panics for errors.
 func Gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS []string) ([]byte, []byte) {
+	return currentSigner().Gen(master, hostname, caKey, caCrt, kubeMasterIP, kubeMasterDNS)
+}
+
+func gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS []string) ([]byte, []byte) {
 	out, e := ioutil.TempDir("", "")
 	candy.Must(e)
 	defer func() {
@@ -123,5 +148,6 @@ func Gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS
 	candy.Must(e)
 	c, e := ioutil.ReadFile(crt)
 	candy.Must(e)
+	reportCertIssued(hostname, master, c)
 	return k, c
 }
@@ -38,7 +38,22 @@ func TryWithEnv(env map[string]string, name string, arg ...string) {
 	run(false, env, name, arg)
 }
 
+// Exec works like Run, but returns the error instead of panicking, for
+// commands run while serving requests.
+func Exec(name string, arg ...string) error {
+	return execute(nil, name, arg)
+}
+
 func run(panic bool, env map[string]string, name string, arg []string) {
+	if e := execute(env, name, arg); e != nil {
+		if panic {
+			log.Panic(e)
+		}
+		log.Print(e)
+	}
+}
+
+func execute(env map[string]string, name string, arg []string) error {
 	log.Printf("Running %s %s ...", name, strings.Join(arg, " "))
 	cmd := exec.Command(name, arg...)
 
@@ -59,21 +74,17 @@ func run(panic bool, env map[string]string, name string, arg []string) {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	p := log.Printf
-	if panic {
-		p = log.Panicf
-	}
-
 	if *Silent {
 		b, e := cmd.CombinedOutput()
 		if e != nil {
-			p("Command \"%s %s\" error: %v\nwith output:\n%s", name, strings.Join(arg, " "), e, string(b))
+			return fmt.Errorf("Command \"%s %s\" error: %v\nwith output:\n%s", name, strings.Join(arg, " "), e, string(b))
 		}
 	} else {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if e := cmd.Run(); e != nil {
-			p("Command \"%s %s\" error: %v", name, strings.Join(arg, " "), e)
+			return fmt.Errorf("Command \"%s %s\" error: %v", name, strings.Join(arg, " "), e)
 		}
 	}
+	return nil
 }
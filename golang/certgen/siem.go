@@ -0,0 +1,185 @@
+package certgen
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	SIEMSyslog   = flag.String("certgen.siem-syslog", "", "If not empty, the syslog address, e.g. udp://siem:514, to send CEF certificate events to")
+	CertAuditLog = flag.String("certgen.cert-audit-log", "", "If not empty, append the CEF event of every certificate issued to this file, from which ReplayCertEvents sends them to the SIEM again.")
+)
+
+// cefEscape escapes a CEF extension value.
+func cefEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`).Replace(s)
+}
+
+// certEvent formats the issuance of the PEM encoded certificate crt
+// at issued as a CEF event for SIEM.
+func certEvent(hostname string, master bool, crt []byte, issued time.Time) (string, error) {
+	b, _ := pem.Decode(crt)
+	if b == nil {
+		return "", fmt.Errorf("no PEM data in certificate of %s", hostname)
+	}
+	c, e := x509.ParseCertificate(b.Bytes)
+	if e != nil {
+		return "", e
+	}
+
+	role := "worker"
+	if master {
+		role = "master"
+	}
+	return fmt.Sprintf("CEF:0|k8sp|sextant|1.0|cert-issue|Certificate issued|3|rt=%d dhost=%s cs1Label=role cs1=%s cs2Label=subject cs2=%s cs3Label=serial cs3=%s start=%d end=%d",
+		issued.UnixNano()/int64(time.Millisecond), cefEscape(hostname), role, cefEscape(c.Subject.CommonName), c.SerialNumber.Text(16),
+		c.NotBefore.UnixNano()/int64(time.Millisecond), c.NotAfter.UnixNano()/int64(time.Millisecond)), nil
+}
+
+// certAuditMutex serializes appends to -certgen.cert-audit-log.
+var certAuditMutex sync.Mutex
+
+// auditCertEvent appends ev, issued at issued, to the audit log fn, one
+// "<RFC 3339 time> <CEF event>" per line.
+func auditCertEvent(fn string, issued time.Time, ev string) error {
+	certAuditMutex.Lock()
+	defer certAuditMutex.Unlock()
+	f, e := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if e != nil {
+		return e
+	}
+	_, e = fmt.Fprintf(f, "%s %s\n", issued.UTC().Format(time.RFC3339Nano), ev)
+	if e2 := f.Close(); e == nil {
+		e = e2
+	}
+	return e
+}
+
+// ReplayCertEvents sends the events in -certgen.cert-audit-log of
+// certificates issued after since to -certgen.siem-syslog again, in
+// order, like after the SIEM lost them.  It returns how many it sent
+// and the time of the last one, from which a replay cut short resumes.
+func ReplayCertEvents(since time.Time) (int, time.Time, error) {
+	if len(*SIEMSyslog) == 0 || len(*CertAuditLog) == 0 {
+		return 0, since, fmt.Errorf("replay needs -certgen.siem-syslog and -certgen.cert-audit-log")
+	}
+	u, e := url.Parse(*SIEMSyslog)
+	if e != nil {
+		return 0, since, e
+	}
+	f, e := os.Open(*CertAuditLog)
+	if os.IsNotExist(e) {
+		return 0, since, nil
+	} else if e != nil {
+		return 0, since, e
+	}
+	defer f.Close()
+
+	var w *syslog.Writer
+	n, last := 0, since
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		issued, e := time.Parse(time.RFC3339Nano, fields[0])
+		if e != nil || !issued.After(since) {
+			continue
+		}
+		if w == nil {
+			if w, e = syslog.Dial(u.Scheme, u.Host, syslog.LOG_NOTICE|syslog.LOG_AUTH, "sextant"); e != nil {
+				return n, last, e
+			}
+			defer w.Close()
+		}
+		if e := w.Notice(fields[1]); e != nil {
+			return n, last, e
+		}
+		n, last = n+1, issued
+	}
+	return n, last, s.Err()
+}
+
+// siemQueueSize bounds the certificate events waiting to be sent to
+// a SIEM syslog server.  Events beyond it are dropped and logged, so
+// a slow or unreachable SIEM never holds up issuance.
+const siemQueueSize = 256
+
+// siemQueues are the queues of events of the SIEM syslog servers by
+// address, each drained by a sendSIEM goroutine.
+var siemQueues = struct {
+	sync.Mutex
+	queues map[string]chan string
+}{queues: make(map[string]chan string)}
+
+// reportCertIssued queues the CEF event of an issued certificate for
+// the syslog server given by -certgen.siem-syslog.  Failures are
+// logged but never fail the issuance.
+func reportCertIssued(hostname string, master bool, crt []byte) {
+	if len(*SIEMSyslog) == 0 && len(*CertAuditLog) == 0 {
+		return
+	}
+	issued := time.Now()
+	ev, e := certEvent(hostname, master, crt, issued)
+	if e != nil {
+		log.Printf("Cannot format certificate event: %v", e)
+		return
+	}
+	if len(*CertAuditLog) > 0 {
+		if e := auditCertEvent(*CertAuditLog, issued, ev); e != nil {
+			log.Printf("Cannot append certificate event to %s: %v", *CertAuditLog, e)
+		}
+	}
+	if len(*SIEMSyslog) == 0 {
+		return
+	}
+	u, e := url.Parse(*SIEMSyslog)
+	if e != nil {
+		log.Printf("Invalid -certgen.siem-syslog %s: %v", *SIEMSyslog, e)
+		return
+	}
+
+	siemQueues.Lock()
+	q, ok := siemQueues.queues[*SIEMSyslog]
+	if !ok {
+		q = make(chan string, siemQueueSize)
+		siemQueues.queues[*SIEMSyslog] = q
+		go sendSIEM(u, q)
+	}
+	siemQueues.Unlock()
+	select {
+	case q <- ev:
+	default:
+		log.Printf("Dropped the certificate event of %s, as SIEM syslog %s is behind", hostname, *SIEMSyslog)
+	}
+}
+
+// sendSIEM sends the events of q to the syslog server at u over one
+// connection, dialed on the first event and again after failing to.
+// syslog.Writer reconnects by itself if a write fails.
+func sendSIEM(u *url.URL, q <-chan string) {
+	var w *syslog.Writer
+	for ev := range q {
+		if w == nil {
+			var e error
+			if w, e = syslog.Dial(u.Scheme, u.Host, syslog.LOG_NOTICE|syslog.LOG_AUTH, "sextant"); e != nil {
+				log.Printf("Cannot connect to SIEM syslog %s: %v", u, e)
+				continue
+			}
+		}
+		if e := w.Notice(ev); e != nil {
+			log.Printf("Cannot send certificate event to %s: %v", u, e)
+		}
+	}
+}
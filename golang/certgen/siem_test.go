@@ -0,0 +1,98 @@
+package certgen
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestCertEvent(t *testing.T) {
+	out, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(out)
+	caKey, caCrt := GenerateRootCA(out)
+	_, crt := Gen(false, "00-25-90-c0-f7-80", caKey, caCrt, nil, nil)
+
+	ev, e := certEvent("00-25-90-c0-f7-80", false, crt, time.Unix(1496275200, 0))
+	assert.Nil(t, e)
+	assert.True(t, strings.HasPrefix(ev, "CEF:0|k8sp|sextant|1.0|cert-issue|"))
+	assert.Contains(t, ev, "rt=1496275200000 dhost=00-25-90-c0-f7-80 cs1Label=role cs1=worker")
+
+	_, e = certEvent("00-25-90-c0-f7-80", false, []byte("garbage"), time.Now())
+	assert.NotNil(t, e)
+}
+
+func TestReportCertIssued(t *testing.T) {
+	out, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(out)
+	caKey, caCrt := GenerateRootCA(out)
+	_, crt := Gen(false, "00-25-90-c0-f7-80", caKey, caCrt, nil, nil)
+
+	l, e := net.ListenPacket("udp", "127.0.0.1:0")
+	candy.Must(e)
+	defer l.Close()
+	saved := *SIEMSyslog
+	defer func() { *SIEMSyslog = saved }()
+	*SIEMSyslog = "udp://" + l.LocalAddr().String()
+
+	// Events are sent in order, over one connection.
+	reportCertIssued("00-25-90-c0-f7-80", false, crt)
+	reportCertIssued("00-25-90-c0-f7-81", true, crt)
+	var from []string
+	buf := make([]byte, 4096)
+	for _, want := range []string{"dhost=00-25-90-c0-f7-80", "dhost=00-25-90-c0-f7-81"} {
+		candy.Must(l.SetReadDeadline(time.Now().Add(5 * time.Second)))
+		n, addr, e := l.ReadFrom(buf)
+		if !assert.Nil(t, e) {
+			return
+		}
+		assert.Contains(t, string(buf[:n]), want)
+		from = append(from, addr.String())
+	}
+	assert.Equal(t, from[0], from[1])
+}
+
+func TestReplayCertEvents(t *testing.T) {
+	out, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(out)
+	caKey, caCrt := GenerateRootCA(out)
+	_, crt := Gen(false, "00-25-90-c0-f7-80", caKey, caCrt, nil, nil)
+
+	l, e := net.ListenPacket("udp", "127.0.0.1:0")
+	candy.Must(e)
+	defer l.Close()
+	savedSyslog, savedLog := *SIEMSyslog, *CertAuditLog
+	defer func() { *SIEMSyslog, *CertAuditLog = savedSyslog, savedLog }()
+	*SIEMSyslog, *CertAuditLog = "", path.Join(out, "cert-audit.log")
+
+	// Without a SIEM, events are only kept in the audit log.
+	reportCertIssued("00-25-90-c0-f7-80", false, crt)
+	start := time.Now()
+	reportCertIssued("00-25-90-c0-f7-81", false, crt)
+
+	*SIEMSyslog = "udp://" + l.LocalAddr().String()
+	n, last, e := ReplayCertEvents(start)
+	assert.Nil(t, e)
+	assert.Equal(t, 1, n)
+	assert.True(t, last.After(start))
+	buf := make([]byte, 4096)
+	candy.Must(l.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	m, _, e := l.ReadFrom(buf)
+	if assert.Nil(t, e) {
+		assert.Contains(t, string(buf[:m]), "dhost=00-25-90-c0-f7-81")
+	}
+
+	// Resuming from the last event sent replays nothing more.
+	n, _, e = ReplayCertEvents(last)
+	assert.Nil(t, e)
+	assert.Equal(t, 0, n)
+}
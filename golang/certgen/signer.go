@@ -0,0 +1,58 @@
+package certgen
+
+import (
+	"sync"
+	"time"
+)
+
+// Signer issues what sextant signs with its CAs: the TLS certificates
+// of nodes, the tokens nodes present to the bootstrapper, and the SSH
+// certificates of operators.  Gen, NodeToken and SignSSHUser go
+// through the Signer set by SetSigner, so that code calling them can
+// be tested without openssl, ssh-keygen or CA keys.
+type Signer interface {
+	Gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS []string) ([]byte, []byte)
+	NodeToken(caKey, hostname string) (string, error)
+	SignSSHUser(caKey string, pub []byte, identity string, principals []string, ttl time.Duration) ([]byte, error)
+}
+
+// localSigner is the default Signer, which signs with openssl and
+// ssh-keygen on this host.
+type localSigner struct{}
+
+func (localSigner) Gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS []string) ([]byte, []byte) {
+	return gen(master, hostname, caKey, caCrt, kubeMasterIP, kubeMasterDNS)
+}
+
+func (localSigner) NodeToken(caKey, hostname string) (string, error) {
+	return nodeToken(caKey, hostname)
+}
+
+func (localSigner) SignSSHUser(caKey string, pub []byte, identity string, principals []string, ttl time.Duration) ([]byte, error) {
+	return signSSHUser(caKey, pub, identity, principals, ttl)
+}
+
+var signer = struct {
+	sync.RWMutex
+	s Signer
+}{s: localSigner{}}
+
+// SetSigner makes Gen, NodeToken and SignSSHUser use s, or sign on
+// this host again if s is nil, and returns the Signer used before, for
+// tests to restore.
+func SetSigner(s Signer) Signer {
+	if s == nil {
+		s = localSigner{}
+	}
+	signer.Lock()
+	defer signer.Unlock()
+	prev := signer.s
+	signer.s = s
+	return prev
+}
+
+func currentSigner() Signer {
+	signer.RLock()
+	defer signer.RUnlock()
+	return signer.s
+}
@@ -0,0 +1,145 @@
+package certgen
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	SSHCAKey       = flag.String("certgen.ssh-ca-key", "", "If not empty, the private key of the SSH CA, generated if missing, which signs the host keys of nodes and the user certificates of operators.  Nodes trust its public key, <key>.pub, for users.")
+	SSHHostCertTTL = flag.Duration("certgen.ssh-host-cert-ttl", 0, "How long the SSH host certificates of nodes are valid, or 0 for ever.")
+)
+
+// GenerateSSHCA generates the SSH CA key pair caKey and caKey.pub,
+// unless caKey exists.
+func GenerateSSHCA(caKey string) {
+	if _, e := os.Stat(caKey); e == nil {
+		return
+	}
+	Run("ssh-keygen", "-q", "-t", "rsa", "-b", "2048", "-N", "", "-C", "sextant-ssh-ca", "-f", caKey)
+}
+
+// SSHCAPublicKey returns the public key of the SSH CA caKey, in the
+// format of authorized_keys.
+func SSHCAPublicKey(caKey string) (string, error) {
+	b, e := ioutil.ReadFile(caKey + ".pub")
+	return strings.TrimSpace(string(b)), e
+}
+
+// GenSSHHost generates a host key for hostname and its certificate,
+// signed by caKey, for names, valid for ttl, or for ever if ttl is 0.
+func GenSSHHost(hostname, caKey string, names []string, ttl time.Duration) ([]byte, []byte, error) {
+	out, e := ioutil.TempDir("", "")
+	if e != nil {
+		return nil, nil, e
+	}
+	defer func() {
+		if e := os.RemoveAll(out); e != nil {
+			log.Printf("GenSSHHost failed deleting %s", out)
+		}
+	}()
+
+	key := path.Join(out, "ssh_host_key")
+	if e := Exec("ssh-keygen", "-q", "-t", "rsa", "-b", "2048", "-N", "", "-C", hostname, "-f", key); e != nil {
+		return nil, nil, e
+	}
+	sign := []string{"-q", "-s", caKey, "-h", "-I", hostname, "-n", strings.Join(names, ",")}
+	if ttl > 0 {
+		sign = append(sign, "-V", validity(ttl))
+	}
+	if e := Exec("ssh-keygen", append(sign, key+".pub")...); e != nil {
+		return nil, nil, e
+	}
+
+	k, e := ioutil.ReadFile(key)
+	if e != nil {
+		return nil, nil, e
+	}
+	c, e := ioutil.ReadFile(key + "-cert.pub")
+	return k, c, e
+}
+
+// sshHost is a host key and its certificate kept by sshHostCache.
+type sshHost struct {
+	key, crt []byte
+	renew    time.Time // Zero if the certificate doesn't expire.
+}
+
+// sshHostCache keeps the host key and certificate generated for each
+// node, by hostname, CA and names, so renders don't run ssh-keygen.
+var sshHostCache = struct {
+	sync.Mutex
+	hosts map[string]sshHost
+}{hosts: make(map[string]sshHost)}
+
+// CachedSSHHost works like GenSSHHost, but returns the key and
+// certificate generated before for the same hostname, CA and names,
+// until the last quarter of the validity of the certificate.
+func CachedSSHHost(hostname, caKey string, names []string, ttl time.Duration) ([]byte, []byte, error) {
+	ca, e := SSHCAPublicKey(caKey)
+	if e != nil {
+		return nil, nil, e
+	}
+	id := strings.Join(append([]string{hostname, ca, ttl.String()}, names...), "\x00")
+
+	sshHostCache.Lock()
+	h, ok := sshHostCache.hosts[id]
+	sshHostCache.Unlock()
+	if ok && (h.renew.IsZero() || time.Now().Before(h.renew)) {
+		return h.key, h.crt, nil
+	}
+
+	k, c, e := GenSSHHost(hostname, caKey, names, ttl)
+	if e != nil {
+		return nil, nil, e
+	}
+	h = sshHost{key: k, crt: c}
+	if ttl > 0 {
+		h.renew = time.Now().Add(ttl * 3 / 4)
+	}
+	sshHostCache.Lock()
+	sshHostCache.hosts[id] = h
+	sshHostCache.Unlock()
+	return k, c, nil
+}
+
+// validity is the -V of ssh-keygen for a certificate valid for ttl
+// from now, allowing for clock skew between the bootstrapper and
+// nodes.
+func validity(ttl time.Duration) string {
+	return fmt.Sprintf("-5m:+%ds", int(ttl/time.Second))
+}
+
+// SignSSHUser signs pub, an SSH public key, with caKey into a user
+// certificate of identity for principals, valid for ttl.
+func SignSSHUser(caKey string, pub []byte, identity string, principals []string, ttl time.Duration) ([]byte, error) {
+	return currentSigner().SignSSHUser(caKey, pub, identity, principals, ttl)
+}
+
+func signSSHUser(caKey string, pub []byte, identity string, principals []string, ttl time.Duration) ([]byte, error) {
+	out, e := ioutil.TempDir("", "")
+	if e != nil {
+		return nil, e
+	}
+	defer func() {
+		if e := os.RemoveAll(out); e != nil {
+			log.Printf("SignSSHUser failed deleting %s", out)
+		}
+	}()
+
+	key := path.Join(out, "user_key")
+	if e := ioutil.WriteFile(key+".pub", pub, 0600); e != nil {
+		return nil, e
+	}
+	if e := Exec("ssh-keygen", "-q", "-s", caKey, "-I", identity, "-n", strings.Join(principals, ","), "-V", validity(ttl), key+".pub"); e != nil {
+		return nil, e
+	}
+	return ioutil.ReadFile(key + "-cert.pub")
+}
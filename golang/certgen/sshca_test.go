@@ -0,0 +1,83 @@
+package certgen
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestSSHCA(t *testing.T) {
+	out, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(out)
+	caKey := path.Join(out, "ssh-ca")
+	GenerateSSHCA(caKey)
+	pub, e := SSHCAPublicKey(caKey)
+	assert.Nil(t, e)
+	assert.True(t, strings.HasPrefix(pub, "ssh-rsa "))
+
+	// An existing CA is kept.
+	GenerateSSHCA(caKey)
+	again, _ := SSHCAPublicKey(caKey)
+	assert.Equal(t, pub, again)
+
+	key, crt, e := GenSSHHost("00-25-90-c0-f7-80", caKey, []string{"00-25-90-c0-f7-80", "10.10.14.200"}, 0)
+	assert.Nil(t, e)
+	assert.Contains(t, string(key), "PRIVATE KEY-----")
+	assert.True(t, strings.HasPrefix(string(crt), "ssh-rsa-cert-v01@openssh.com "))
+	fn := path.Join(out, "host-cert.pub")
+	candy.Must(ioutil.WriteFile(fn, crt, 0600))
+	b, e := exec.Command("ssh-keygen", "-L", "-f", fn).CombinedOutput()
+	assert.Nil(t, e)
+	assert.Contains(t, string(b), "host certificate")
+	assert.Contains(t, string(b), "10.10.14.200")
+
+	userPub := path.Join(out, "user")
+	Run("ssh-keygen", "-q", "-t", "rsa", "-b", "2048", "-N", "", "-f", userPub)
+	p, e := ioutil.ReadFile(userPub + ".pub")
+	candy.Must(e)
+	crt, e = SignSSHUser(caKey, p, "alice", []string{"core", "root"}, 8*time.Hour)
+	assert.Nil(t, e)
+	candy.Must(ioutil.WriteFile(fn, crt, 0600))
+	b, e = exec.Command("ssh-keygen", "-L", "-f", fn).CombinedOutput()
+	assert.Nil(t, e)
+	assert.Contains(t, string(b), "user certificate")
+	assert.Contains(t, string(b), `"alice"`)
+	assert.Contains(t, string(b), "core")
+
+	_, _, e = GenSSHHost("00-25-90-c0-f7-80", path.Join(out, "missing"), []string{"00-25-90-c0-f7-80"}, 0)
+	assert.NotNil(t, e)
+}
+
+func TestCachedSSHHost(t *testing.T) {
+	out, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(out)
+	caKey := path.Join(out, "ssh-ca")
+	GenerateSSHCA(caKey)
+
+	names := []string{"00-25-90-c0-f7-80"}
+	key, crt, e := CachedSSHHost("00-25-90-c0-f7-80", caKey, names, 0)
+	assert.Nil(t, e)
+	again, _, e := CachedSSHHost("00-25-90-c0-f7-80", caKey, names, 0)
+	assert.Nil(t, e)
+	assert.Equal(t, key, again)
+
+	// Other names, or a certificate nearing expiry, are signed again.
+	other, _, e := CachedSSHHost("00-25-90-c0-f7-80", caKey, append(names, "10.10.14.200"), 0)
+	assert.Nil(t, e)
+	assert.NotEqual(t, key, other)
+	_, short, e := CachedSSHHost("00-25-90-c0-f7-80", caKey, names, time.Nanosecond)
+	assert.Nil(t, e)
+	_, renewed, e := CachedSSHHost("00-25-90-c0-f7-80", caKey, names, time.Nanosecond)
+	assert.Nil(t, e)
+	assert.NotEqual(t, short, renewed)
+	assert.NotEqual(t, crt, renewed)
+}
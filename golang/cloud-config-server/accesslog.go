@@ -0,0 +1,237 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	clfTimeFormat     = "02/Jan/2006:15:04:05 -0700"
+	rotatedTimeFormat = "20060102T150405.000000000"
+)
+
+// accessEntry is a line of the access log in JSON.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	MAC        string    `json:"mac,omitempty"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS int64     `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// accessLog writes a line per request to file, separate from the
+// glog application log, in Common Log Format, or in JSON if format is
+// "json", for traffic analysis tools expecting access logs.  file is
+// rotated to file.<time>.<sequence number> once it would exceed
+// maxSize bytes or is older than maxAge, where 0 means no limit, and
+// rotated files are gzipped if compress, keeping the latest keep of
+// them.  Rotated files are compressed and pruned in the background,
+// so requests aren't held up logging meanwhile.
+type accessLog struct {
+	file     string
+	format   string
+	maxSize  int64
+	maxAge   time.Duration
+	keep     int
+	compress bool
+	now      func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	seq    int
+
+	rotating sync.WaitGroup // Compressing and pruning rotated files.
+}
+
+func newAccessLog(file, format string, maxSize int64, maxAge time.Duration, keep int, compress bool) (*accessLog, error) {
+	if format != "clf" && format != "json" {
+		return nil, fmt.Errorf("unknown access log format %q, want clf or json", format)
+	}
+	l := &accessLog{
+		file:     file,
+		format:   format,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		keep:     keep,
+		compress: compress,
+		now:      time.Now,
+	}
+	return l, l.open()
+}
+
+func (l *accessLog) open() error {
+	if e := os.MkdirAll(filepath.Dir(l.file), 0755); e != nil {
+		return e
+	}
+	f, e := os.OpenFile(l.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if e != nil {
+		return e
+	}
+	fi, e := f.Stat()
+	if e != nil {
+		f.Close()
+		return e
+	}
+	l.f, l.size, l.opened = f, fi.Size(), l.now()
+	return nil
+}
+
+// rotateLocked renames the log to file.<time>.<sequence number> and
+// opens a new log, then gzips the rotated log if compress and prunes
+// all but the latest keep rotated logs in the background.
+func (l *accessLog) rotateLocked() error {
+	l.f.Close()
+	l.seq++
+	rotated := fmt.Sprintf("%s.%s.%06d", l.file, l.now().UTC().Format(rotatedTimeFormat), l.seq)
+	if e := os.Rename(l.file, rotated); e != nil {
+		return e
+	}
+	l.rotating.Add(1)
+	go func() {
+		defer l.rotating.Done()
+		if l.compress {
+			if e := gzipFile(rotated); e != nil {
+				glog.Warningf("Cannot compress %s: %v", rotated, e)
+			}
+		}
+		l.prune()
+	}()
+	return l.open()
+}
+
+// prune removes all but the latest keep rotated logs, whether
+// compressed yet or not.
+func (l *accessLog) prune() {
+	if l.keep <= 0 {
+		return
+	}
+	files, _ := filepath.Glob(l.file + ".*")
+	var rotated []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".gz") || !contains(files, strings.TrimSuffix(f, ".gz")) {
+			rotated = append(rotated, strings.TrimSuffix(f, ".gz"))
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > l.keep {
+		os.Remove(rotated[0])
+		os.Remove(rotated[0] + ".gz")
+		rotated = rotated[1:]
+	}
+}
+
+func contains(s []string, x string) bool {
+	for _, y := range s {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipFile replaces file by file.gz.
+func gzipFile(file string) error {
+	in, e := os.Open(file)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+	out, e := os.Create(file + ".gz")
+	if e != nil {
+		return e
+	}
+	z := gzip.NewWriter(out)
+	if _, e = io.Copy(z, in); e == nil {
+		e = z.Close()
+	}
+	if e2 := out.Close(); e == nil {
+		e = e2
+	}
+	if e != nil {
+		os.Remove(file + ".gz")
+		return e
+	}
+	return os.Remove(file)
+}
+
+func (l *accessLog) write(line []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && (l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize ||
+		l.maxAge > 0 && l.now().Sub(l.opened) >= l.maxAge) {
+		if e := l.rotateLocked(); e != nil {
+			glog.Errorf("Cannot rotate access log %s: %v", l.file, e)
+			if l.open() != nil {
+				return
+			}
+		}
+	}
+	n, e := l.f.Write(line)
+	l.size += int64(n)
+	if e != nil {
+		glog.Errorf("Cannot write access log %s: %v", l.file, e)
+	}
+}
+
+// line returns the line logging e.
+func (l *accessLog) line(e accessEntry) []byte {
+	if l.format == "json" {
+		b, _ := json.Marshal(e)
+		return append(b, '\n')
+	}
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil || len(host) == 0 {
+		host = "-"
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = fmt.Sprint(e.Bytes)
+	}
+	return []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s\n",
+		host, e.Time.Format(clfTimeFormat), e.Method, e.URL, e.Proto, e.Status, size))
+}
+
+// wrap logs every request served by h.  A nil accessLog logs nothing.
+func (l *accessLog) wrap(h http.Handler) http.HandlerFunc {
+	if l == nil {
+		return h.ServeHTTP
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := l.now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		l.write(l.line(accessEntry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			MAC:        macInPath(r.URL.Path),
+			Method:     r.Method,
+			URL:        strings.Replace(r.URL.RequestURI(), "\"", "%22", -1),
+			Proto:      r.Proto,
+			Status:     sw.status,
+			Bytes:      sw.size,
+			DurationMS: int64(l.now().Sub(start) / time.Millisecond),
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}))
+	}
+}
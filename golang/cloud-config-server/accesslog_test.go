@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestAccessLogCLF(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+
+	l, e := newAccessLog(path.Join(dir, "access.log"), "clf", 0, 0, 0, false)
+	candy.Must(e)
+	l.now = func() time.Time { return time.Date(2017, 3, 1, 13, 55, 36, 0, time.UTC) }
+	h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#cloud-config\n"))
+	}))
+
+	req, _ := http.NewRequest("GET", "/cloud-config/00:25:90:c0:f7:80?x=1", nil)
+	req.RemoteAddr = "10.10.14.1:4321"
+	h(httptest.NewRecorder(), req)
+
+	b, e := ioutil.ReadFile(path.Join(dir, "access.log"))
+	candy.Must(e)
+	assert.Equal(t, "10.10.14.1 - - [01/Mar/2017:13:55:36 +0000] \"GET /cloud-config/00:25:90:c0:f7:80?x=1 HTTP/1.1\" 200 14\n", string(b))
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+
+	_, e = newAccessLog(path.Join(dir, "access.log"), "xml", 0, 0, 0, false)
+	assert.Error(t, e)
+
+	l, e := newAccessLog(path.Join(dir, "access.log"), "json", 0, 0, 0, false)
+	candy.Must(e)
+	h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such node", http.StatusNotFound)
+	}))
+	req, _ := http.NewRequest("GET", "/cloud-config/00:25:90:c0:f7:80", nil)
+	req.Header.Set("User-Agent", "curl")
+	h(httptest.NewRecorder(), req)
+
+	b, e := ioutil.ReadFile(path.Join(dir, "access.log"))
+	candy.Must(e)
+	var entry accessEntry
+	candy.Must(json.Unmarshal(b, &entry))
+	assert.Equal(t, http.StatusNotFound, entry.Status)
+	assert.Equal(t, "00:25:90:c0:f7:80", entry.MAC)
+	assert.Equal(t, "curl", entry.UserAgent)
+	assert.Equal(t, int64(len("no such node\n")), entry.Bytes)
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	file := path.Join(dir, "access.log")
+	l, e := newAccessLog(file, "clf", 200, time.Hour, 2, true)
+	candy.Must(e)
+	l.now = func() time.Time { return now }
+	h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req, _ := http.NewRequest("GET", "/static/coreos_production_pxe.vmlinuz", nil)
+
+	// Lines are 94 bytes, so every third one rotates by size.
+	for i := 0; i < 4; i++ {
+		h(httptest.NewRecorder(), req)
+		now = now.Add(time.Second)
+	}
+	l.rotating.Wait()
+	rotated, _ := filepath.Glob(file + ".*")
+	assert.Equal(t, 1, len(rotated))
+
+	// An old log rotates by age.
+	now = now.Add(time.Hour)
+	h(httptest.NewRecorder(), req)
+	h(httptest.NewRecorder(), req)
+	now = now.Add(time.Hour)
+	h(httptest.NewRecorder(), req)
+	l.rotating.Wait()
+
+	rotated, _ = filepath.Glob(file + ".*")
+	assert.Equal(t, 2, len(rotated)) // Pruned to keep.
+	for _, f := range rotated {
+		assert.True(t, strings.HasSuffix(f, ".gz"))
+	}
+	f, e := os.Open(rotated[1])
+	candy.Must(e)
+	defer f.Close()
+	z, e := gzip.NewReader(f)
+	candy.Must(e)
+	b, e := ioutil.ReadAll(z)
+	candy.Must(e)
+	assert.Equal(t, 2, strings.Count(string(b), "\n"))
+
+	b, e = ioutil.ReadFile(file)
+	candy.Must(e)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"))
+}
+
+func TestAccessLogRotationSameTime(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "access.log")
+	l, e := newAccessLog(file, "json", 1, 0, 0, false)
+	candy.Must(e)
+	l.now = func() time.Time { return time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC) }
+	for i := 0; i < 3; i++ {
+		l.write([]byte("line\n"))
+	}
+	l.rotating.Wait()
+	rotated, _ := filepath.Glob(file + ".*")
+	assert.Equal(t, 2, len(rotated))
+}
+
+func TestAccessLogNil(t *testing.T) {
+	var l *accessLog
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	l.wrap(http.NotFoundHandler())(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// adminIdentityKey is the context key of the identity of the operator
+// authenticated by adminAuth.
+type adminIdentityKey struct{}
+
+// adminAuth authenticates operators changing the cluster, like editing
+// cluster-desc and templates or freezing changes, with bearer tokens
+// listed in tokensFile, with lines like
+//
+//	<token> <identity>
+//
+// for example "9f8e... alice", where lines starting with # are
+// comments.  The file is read on every request, like the tokens of
+// /ssh-cert, so tokens are revoked without restarting the server.
+// Without tokensFile, or if it can't be read, admin requests are
+// refused.
+type adminAuth struct {
+	tokensFile string
+}
+
+func newAdminAuth(tokensFile string) *adminAuth {
+	return &adminAuth{tokensFile: tokensFile}
+}
+
+func readAdminTokens(tokensFile string) (map[string]string, error) {
+	f, e := os.Open(tokensFile)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	identities := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		identities[fields[0]] = fields[1]
+	}
+	return identities, s.Err()
+}
+
+// identity returns the identity of the bearer token of r.
+func (a *adminAuth) identity(r *http.Request) (string, error) {
+	if len(a.tokensFile) == 0 {
+		return "", errors.New("admin requests are disabled, see -admin-tokens")
+	}
+	identities, e := readAdminTokens(a.tokensFile)
+	if e != nil {
+		glog.Errorf("Cannot read admin tokens: %v", e)
+		return "", errors.New("admin tokens are unavailable")
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 {
+		return "", errors.New("a valid bearer token is required")
+	}
+	for t, id := range identities {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return id, nil
+		}
+	}
+	return "", errors.New("a valid bearer token is required")
+}
+
+// require refuses requests to h that carry no valid admin token, and
+// passes the identity of the operator on to h, see authorOf.
+func (a *adminAuth) require(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, e := a.identity(r)
+		if e != nil {
+			glog.Warningf("Refused %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, e)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, e.Error(), http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), adminIdentityKey{}, id)))
+	}
+}
+
+// guard is require for requests other than GET and HEAD, so reading
+// stays open to nodes and dashboards.
+func (a *adminAuth) guard(h http.HandlerFunc) http.HandlerFunc {
+	required := a.require(h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			h(w, r)
+			return
+		}
+		required(w, r)
+	}
+}
+
+// authorOf returns the identity of the operator authenticated for r.
+func authorOf(r *http.Request) string {
+	if id, ok := r.Context().Value(adminIdentityKey{}).(string); ok {
+		return id
+	}
+	return "anonymous@" + r.RemoteAddr
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestAdminAuth(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	tokens := path.Join(dir, "admin-tokens")
+	candy.Must(ioutil.WriteFile(tokens, []byte("# token identity\ns3cret alice\n"), 0600))
+
+	var author string
+	h := func(w http.ResponseWriter, r *http.Request) { author = authorOf(r) }
+	do := func(a *adminAuth, method, token string) int {
+		author = ""
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/cluster-desc", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		// A client-supplied author is ignored.
+		req.Header.Set("X-Sextant-Author", "mallory")
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		a.guard(h)(rr, req)
+		return rr.Code
+	}
+
+	a := newAdminAuth(tokens)
+	assert.Equal(t, http.StatusOK, do(a, "GET", ""))
+	assert.Equal(t, "anonymous@10.0.0.1:1234", author)
+	assert.Equal(t, http.StatusUnauthorized, do(a, "PUT", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(a, "PUT", "guess"))
+	assert.Equal(t, "", author)
+	assert.Equal(t, http.StatusOK, do(a, "PUT", "s3cret"))
+	assert.Equal(t, "alice", author)
+
+	// Without tokens, changes are refused.
+	assert.Equal(t, http.StatusUnauthorized, do(newAdminAuth(""), "PUT", "s3cret"))
+	assert.Equal(t, http.StatusUnauthorized, do(newAdminAuth(path.Join(dir, "none")), "PUT", "s3cret"))
+}
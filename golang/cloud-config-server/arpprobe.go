@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// ipConflict describes a fixed IP of a node which another device
+// answers ARP requests for.
+type ipConflict struct {
+	IP             string
+	MAC            string // Of the node the IP is fixed to.
+	ConflictingMAC string
+	Time           time.Time
+}
+
+var arpReply = regexp.MustCompile(`\[([0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){5})\]`)
+
+// arping returns the MACs answering ARP requests for ip on iface, by
+// running arping of iputils.
+func arping(iface, ip string) ([]string, error) {
+	out, e := exec.Command("arping", "-c", "2", "-w", "2", "-I", iface, ip).CombinedOutput()
+	if _, exit := e.(*exec.ExitError); e != nil && !exit {
+		return nil, e // arping exits non-zero if nothing replied.
+	}
+	var macs []string
+	for _, m := range arpReply.FindAllStringSubmatch(string(out), -1) {
+		macs = append(macs, strings.ToLower(m[1]))
+	}
+	return macs, nil
+}
+
+// arpProbeTTL is how long the result of an ARP probe of an IP is used
+// before the IP is probed again.
+const arpProbeTTL = time.Minute
+
+// arpProber probes, on iface, the fixed IP of every node, so that if a
+// device other than the node answers for the IP, like a forgotten
+// machine or one configured by hand, the conflict is logged and listed
+// by /ip-conflicts, and, if refuse, the config of the node is refused,
+// so the node doesn't come up with a duplicate IP.  Probes take
+// seconds, so they run in the background, from sweep and when serving
+// a node whose last probe is older than ttl, and serving a config
+// only looks up the last result.
+type arpProber struct {
+	iface  string
+	refuse bool
+	ttl    time.Duration
+	probe  func(iface, ip string) ([]string, error)
+	now    func() time.Time
+	probes sync.WaitGroup // Probes running, waited for by tests.
+
+	mu        sync.Mutex
+	conflicts map[string]ipConflict // By IP.
+	probed    map[string]time.Time  // When IPs were last probed.
+	probing   map[string]bool       // IPs being probed.
+}
+
+func newARPProber(iface string, refuse bool) *arpProber {
+	return &arpProber{
+		iface:     iface,
+		refuse:    refuse,
+		ttl:       arpProbeTTL,
+		probe:     arping,
+		now:       time.Now,
+		conflicts: make(map[string]ipConflict),
+		probed:    make(map[string]time.Time),
+		probing:   make(map[string]bool),
+	}
+}
+
+// check probes ip, fixed to mac, and returns the conflict, if any.
+func (p *arpProber) check(mac, ip string) *ipConflict {
+	macs, e := p.probe(p.iface, ip)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.probing, ip)
+	if e != nil {
+		glog.Warningf("Cannot ARP probe %s of %s: %v", ip, mac, e)
+		return nil
+	}
+	p.probed[ip] = p.now()
+	for _, m := range macs {
+		if m != mac {
+			c := ipConflict{IP: ip, MAC: mac, ConflictingMAC: m, Time: p.now()}
+			p.conflicts[ip] = c
+			glog.Errorf("ALERT: %s, fixed to %s, is in use by %s", ip, mac, m)
+			events.publish("node.ip-conflict", mac, c)
+			return &c
+		}
+	}
+	delete(p.conflicts, ip)
+	return nil
+}
+
+// lookup returns the conflict found by the last probe of ip, fixed to
+// mac, and starts probing ip in the background if that probe is older
+// than ttl.
+func (p *arpProber) lookup(mac, ip string) *ipConflict {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.now().Sub(p.probed[ip]) >= p.ttl && !p.probing[ip] {
+		p.probing[ip] = true
+		p.probes.Add(1)
+		go func() {
+			defer p.probes.Done()
+			p.check(mac, ip)
+		}()
+	}
+	if c, ok := p.conflicts[ip]; ok && c.MAC == mac {
+		return &c
+	}
+	return nil
+}
+
+// fixedIPs returns the fixed IPs of the nodes in clusterDescFile by
+// MAC address.
+func fixedIPs(clusterDescFile string) map[string]string {
+	ips := make(map[string]string)
+	c, err := cctemplate.LoadClusterDesc(clusterDescFile)
+	if err != nil {
+		return ips
+	}
+	for _, n := range c.Nodes {
+		if hwAddr, err := net.ParseMAC(n.MAC); err == nil && len(n.IP) > 0 {
+			ips[hwAddr.String()] = n.IP
+		}
+	}
+	return ips
+}
+
+// sweep probes the fixed IPs of all nodes in clusterDescFile every
+// ttl, so conflicts are known before the nodes boot.  It never
+// returns.
+func (p *arpProber) sweep(clusterDescFile string) {
+	for {
+		for mac, ip := range fixedIPs(clusterDescFile) {
+			p.lookup(mac, ip)
+		}
+		time.Sleep(p.ttl)
+	}
+}
+
+// wrap refuses to serve h to the node given by {mac} if its fixed IP,
+// in clusterDescFile, is known to be in use by another device, and
+// refuse is set.  A nil arpProber checks nothing.
+func (p *arpProber) wrap(clusterDescFile string, h http.HandlerFunc) http.HandlerFunc {
+	if p == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"]); err == nil {
+			if ip, ok := fixedIPs(clusterDescFile)[hwAddr.String()]; ok {
+				if conflict := p.lookup(hwAddr.String(), ip); conflict != nil && p.refuse {
+					http.Error(w, ip+" is in use by "+conflict.ConflictingMAC, http.StatusConflict)
+					return
+				}
+			}
+		}
+		h(w, r)
+	}
+}
+
+// listHandler returns the IP conflicts found in JSON.
+func (p *arpProber) listHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		conflicts := []ipConflict{}
+		if p != nil {
+			p.mu.Lock()
+			for _, c := range p.conflicts {
+				conflicts = append(conflicts, c)
+			}
+			p.mu.Unlock()
+		}
+		sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].IP < conflicts[j].IP })
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(conflicts))
+	})
+}
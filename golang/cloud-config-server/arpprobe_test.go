@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestARPProber(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	b := []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80", "ip": "10.10.14.200"}, {"mac": "00:25:90:c0:f7:81"}]}`)
+	candy.Must(ioutil.WriteFile(clusterDescFile, b, 0644))
+
+	replies := map[string][]string{}
+	probed := 0
+	p := newARPProber("eth0", true)
+	p.ttl = 0 // Probe on every request.
+	p.probe = func(iface, ip string) ([]string, error) {
+		probed++
+		return replies[ip], nil
+	}
+
+	served := 0
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", p.wrap(clusterDescFile, func(w http.ResponseWriter, r *http.Request) { served++ }))
+	router.HandleFunc("/ip-conflicts", p.listHandler())
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(rr, req)
+		p.probes.Wait()
+		return rr
+	}
+	conflicts := func() []ipConflict {
+		var l []ipConflict
+		assert.Nil(t, json.Unmarshal(get("/ip-conflicts").Body.Bytes(), &l))
+		return l
+	}
+
+	// The node itself answering for its IP is no conflict.
+	replies["10.10.14.200"] = []string{"00:25:90:c0:f7:80"}
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	assert.Empty(t, conflicts())
+
+	// Nodes without a fixed IP aren't probed.
+	get("/cloud-config/00:25:90:c0:f7:81")
+	assert.Equal(t, 1, probed)
+	assert.Equal(t, 2, served)
+
+	// Serving doesn't wait for the probe, so the conflict is refused
+	// from the next request on.
+	replies["10.10.14.200"] = []string{"de:ad:be:ef:00:01"}
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	assert.Equal(t, 3, served)
+	rr := get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "de:ad:be:ef:00:01")
+	assert.Equal(t, 3, served)
+	l := conflicts()
+	if assert.Equal(t, 1, len(l)) {
+		assert.Equal(t, "10.10.14.200", l[0].IP)
+		assert.Equal(t, "00:25:90:c0:f7:80", l[0].MAC)
+		assert.Equal(t, "de:ad:be:ef:00:01", l[0].ConflictingMAC)
+	}
+
+	// Once the device is gone, the conflict is cleared.
+	replies["10.10.14.200"] = nil
+	get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	assert.Empty(t, conflicts())
+
+	// Within the TTL, the last result is used without probing.
+	p.ttl = time.Hour
+	n := probed
+	get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, n, probed)
+}
+
+func TestARPReply(t *testing.T) {
+	out := "ARPING 10.10.14.200 from 10.10.14.253 eth0\nUnicast reply from 10.10.14.200 [DE:AD:BE:EF:00:01]  0.712ms\n"
+	m := arpReply.FindAllStringSubmatch(out, -1)
+	if assert.Equal(t, 1, len(m)) {
+		assert.Equal(t, "DE:AD:BE:EF:00:01", m[0][1])
+	}
+}
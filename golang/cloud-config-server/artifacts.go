@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/topicai/candy"
+)
+
+// checksumSuffix names the sidecar file, in the format of sha256sum,
+// which bsroot.sh writes next to every boot artifact it has verified
+// the signature of.
+const checksumSuffix = ".sha256"
+
+// maxChecksumSize bounds what is read of a checksum sidecar, which
+// holds one line of sha256sum.
+const maxChecksumSize = 4 << 10
+
+// verification is the result of checking an artifact against its
+// checksum sidecar.
+type verification struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	SHA256   string    `json:"sha256"`
+	Verified bool      `json:"verified"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// artifactVerifier checks artifacts under dir against their sidecars.
+// As artifacts are OS images of hundreds of MBs, results are cached
+// until the size or the modification time of the artifact changes.
+// Artifacts are hashed without holding mu, so hashing one doesn't hold
+// up requests for others, and only once at a time, so nodes booting
+// together wait for the same hash instead of each hashing the image.
+type artifactVerifier struct {
+	dir      string
+	mu       sync.Mutex
+	cache    map[string]verification
+	inflight map[string]chan struct{} // Closed once hashed, by file.
+}
+
+func newArtifactVerifier(dir string) *artifactVerifier {
+	return &artifactVerifier{dir: dir, cache: make(map[string]verification), inflight: make(map[string]chan struct{})}
+}
+
+// verify checks the artifact at name, relative to dir.  It returns
+// false if the artifact has no sidecar, so there is nothing to check.
+func (v *artifactVerifier) verify(name string) (verification, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	fn := filepath.Join(v.dir, filepath.FromSlash(name))
+	sum, e := readChecksum(fn + checksumSuffix)
+	if e != nil {
+		return verification{}, false
+	}
+	r := verification{Path: name}
+	fi, e := os.Stat(fn)
+	if e != nil {
+		r.Error = e.Error()
+		return r, true
+	}
+	r.Size, r.ModTime = fi.Size(), fi.ModTime()
+	fields := strings.Fields(string(sum))
+	if len(fields) > 0 {
+		r.SHA256 = strings.ToLower(fields[0])
+	}
+
+	v.mu.Lock()
+	for {
+		if c, ok := v.cache[fn]; ok && c.Size == r.Size && c.ModTime.Equal(r.ModTime) && c.SHA256 == r.SHA256 {
+			v.mu.Unlock()
+			return c, true
+		}
+		done, hashing := v.inflight[fn]
+		if !hashing {
+			break
+		}
+		v.mu.Unlock()
+		<-done
+		v.mu.Lock()
+	}
+	done := make(chan struct{})
+	v.inflight[fn] = done
+	v.mu.Unlock()
+
+	actual, e := sha256File(fn)
+	v.mu.Lock()
+	switch {
+	case e != nil:
+		r.Error = e.Error()
+	case actual != r.SHA256:
+		r.Error = "sha256 is " + actual
+		glog.Errorf("Artifact %s failed verification: %s, expecting %s", fn, r.Error, r.SHA256)
+		v.cache[fn] = r
+	default:
+		r.Verified = true
+		v.cache[fn] = r
+	}
+	delete(v.inflight, fn)
+	v.mu.Unlock()
+	close(done)
+	return r, true
+}
+
+func readChecksum(fn string) ([]byte, error) {
+	f, e := os.Open(fn)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	return ioutil.ReadAll(io.LimitReader(f, maxChecksumSize))
+}
+
+func sha256File(fn string) (string, error) {
+	f, e := os.Open(fn)
+	if e != nil {
+		return "", e
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, e := io.Copy(h, f); e != nil {
+		return "", e
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// fileServer serves files under dir like http.FileServer, except
+// that it refuses to serve artifacts that fail verification.
+func (v *artifactVerifier) fileServer() http.Handler {
+	fs := http.FileServer(http.Dir(v.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a, ok := v.verify(r.URL.Path); ok && !a.Verified {
+			http.Error(w, r.URL.Path+" failed verification: "+a.Error, http.StatusForbidden)
+			return
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
+
+// listHandler lists the verification status of all artifacts in JSON.
+func (v *artifactVerifier) listHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		list := []verification{}
+		candy.Must(filepath.Walk(v.dir, func(fn string, fi os.FileInfo, e error) error {
+			if e != nil || fi.IsDir() || !strings.HasSuffix(fn, checksumSuffix) {
+				return nil
+			}
+			rel, e := filepath.Rel(v.dir, strings.TrimSuffix(fn, checksumSuffix))
+			if e != nil {
+				return e
+			}
+			a, _ := v.verify(filepath.ToSlash(rel))
+			list = append(list, a)
+			return nil
+		}))
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(list))
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestArtifactVerifier(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(os.MkdirAll(path.Join(dir, "current"), 0755))
+	write := func(name, content string) {
+		candy.Must(ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+	write("current/good.bin", "good")
+	write("current/good.bin.sha256", fmt.Sprintf("%x  good.bin\n", sha256.Sum256([]byte("good"))))
+	write("current/bad.bin", "tampered")
+	write("current/bad.bin.sha256", fmt.Sprintf("%x  bad.bin\n", sha256.Sum256([]byte("bad"))))
+	write("plain.txt", "no sidecar")
+
+	v := newArtifactVerifier(dir)
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		v.fileServer().ServeHTTP(rr, req)
+		return rr
+	}
+	assert.Equal(t, "good", get("/current/good.bin").Body.String())
+	assert.Equal(t, http.StatusForbidden, get("/current/bad.bin").Code)
+	assert.Equal(t, "no sidecar", get("/plain.txt").Body.String())
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/artifacts", nil)
+	v.listHandler()(rr, req)
+	var list []verification
+	candy.Must(json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Equal(t, 2, len(list))
+	status := make(map[string]bool)
+	for _, a := range list {
+		status[a.Path] = a.Verified
+	}
+	assert.Equal(t, map[string]bool{"current/bad.bin": false, "current/good.bin": true}, status)
+}
+
+func TestArtifactVerifierConcurrent(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	big := strings.Repeat("x", 8<<20)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "big.iso"), []byte(big), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(dir, "big.iso.sha256"), []byte(fmt.Sprintf("%x  big.iso\n", sha256.Sum256([]byte(big)))), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(dir, "small.bin"), []byte("small"), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(dir, "small.bin.sha256"), []byte(fmt.Sprintf("%x  small.bin\n", sha256.Sum256([]byte("small")))), 0644))
+
+	// While the image is hashed, other artifacts are still verified,
+	// and requests for the image share the one hash.
+	v := newArtifactVerifier(dir)
+	var wg sync.WaitGroup
+	results := make([]verification, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = v.verify("big.iso")
+		}(i)
+	}
+	a, ok := v.verify("small.bin")
+	assert.True(t, ok)
+	assert.True(t, a.Verified)
+	wg.Wait()
+	for _, r := range results {
+		assert.True(t, r.Verified)
+	}
+	assert.Empty(t, v.inflight)
+}
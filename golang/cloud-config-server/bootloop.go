@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// bootLoop describes a node caught in a boot loop.
+type bootLoop struct {
+	MAC     string
+	Since   time.Time
+	Fetches int // Within the window when caught.
+}
+
+// bootLoopWatchdog counts the cloud-configs fetched by every node.  A
+// node that fetches limit of them within window is likely
+// reinstalling itself over and over, so it is switched to the
+// quarantine profile, and an alert is logged and POSTed to alertURL,
+// until an admin releases it with DELETE /boot-loops/<mac>.  The boot
+// loops are kept in file, unless it is empty, so a restart of the
+// server releases no node.
+type bootLoopWatchdog struct {
+	window   time.Duration
+	limit    int // 0 disables the watchdog.
+	alertURL string
+	file     string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	fetches map[string][]time.Time
+	loops   map[string]bootLoop
+	last    *bootLoop // Kept after release, for /status.
+}
+
+func newBootLoopWatchdog(window time.Duration, limit int, alertURL, file string) (*bootLoopWatchdog, error) {
+	d := &bootLoopWatchdog{
+		window:   window,
+		limit:    limit,
+		alertURL: alertURL,
+		file:     file,
+		now:      time.Now,
+		fetches:  make(map[string][]time.Time),
+		loops:    make(map[string]bootLoop),
+	}
+	if len(file) == 0 {
+		return d, nil
+	}
+	b, e := ioutil.ReadFile(file)
+	if os.IsNotExist(e) {
+		return d, nil
+	} else if e != nil {
+		return nil, e
+	}
+	var loops []bootLoop
+	if e := json.Unmarshal(b, &loops); e != nil {
+		return nil, fmt.Errorf("%s: %v", file, e)
+	}
+	for i, l := range loops {
+		d.loops[l.MAC] = l
+		d.last = &loops[i]
+		cctemplate.Quarantine(l.MAC, d.reason(l))
+	}
+	return d, nil
+}
+
+func (d *bootLoopWatchdog) reason(l bootLoop) string {
+	return fmt.Sprintf("boot loop, fetched %d cloud-configs within %v", l.Fetches, d.window)
+}
+
+// saveLocked writes the boot loops to file.  d.mu must be held.
+func (d *bootLoopWatchdog) saveLocked() error {
+	if len(d.file) == 0 {
+		return nil
+	}
+	loops := make([]bootLoop, 0, len(d.loops))
+	for _, l := range d.loops {
+		loops = append(loops, l)
+	}
+	sort.Slice(loops, func(i, j int) bool { return loops[i].Since.Before(loops[j].Since) })
+	b, e := json.Marshal(loops)
+	candy.Must(e)
+	if e := os.MkdirAll(path.Dir(d.file), 0755); e != nil {
+		return e
+	}
+	tmp := d.file + ".saving"
+	if e := ioutil.WriteFile(tmp, b, 0644); e != nil {
+		return e
+	}
+	return os.Rename(tmp, d.file)
+}
+
+// observe records a fetch by mac, and returns the boot loop if the
+// fetch is the one that makes it.
+func (d *bootLoopWatchdog) observe(mac string) *bootLoop {
+	if d.limit <= 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.loops[mac]; ok {
+		return nil
+	}
+	now := d.now()
+	recent := []time.Time{now}
+	for _, t := range d.fetches[mac] {
+		if now.Sub(t) < d.window {
+			recent = append(recent, t)
+		}
+	}
+	d.fetches[mac] = recent
+	if len(recent) < d.limit {
+		return nil
+	}
+	l := bootLoop{MAC: mac, Since: now, Fetches: len(recent)}
+	d.loops[mac] = l
+	d.last = &l
+	delete(d.fetches, mac)
+	if e := d.saveLocked(); e != nil {
+		glog.Warningf("Cannot save the boot loop of %s: %v", mac, e)
+	}
+	return &l
+}
+
+// lastLoop returns the latest boot loop caught, or nil.
+func (d *bootLoopWatchdog) lastLoop() *bootLoop {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+func (d *bootLoopWatchdog) release(mac string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l, ok := d.loops[mac]
+	delete(d.loops, mac)
+	if e := d.saveLocked(); e != nil {
+		if ok {
+			d.loops[mac] = l
+		}
+		return false, e
+	}
+	delete(d.fetches, mac)
+	cctemplate.Release(mac)
+	return ok, nil
+}
+
+// watch wraps h, which serves the cloud-config of the node given by
+// the route variable {mac}.  The fetch that makes a boot loop is
+// already served the quarantine profile.
+func (d *bootLoopWatchdog) watch(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"]); err == nil && !isPreflight(r) {
+			if l := d.observe(hwAddr.String()); l != nil {
+				cctemplate.Quarantine(l.MAC, d.reason(*l))
+				d.alert(l)
+			}
+		}
+		h(w, r)
+	}
+}
+
+func (d *bootLoopWatchdog) alert(l *bootLoop) {
+	glog.Errorf("ALERT: %s fetched %d cloud-configs within %v, serving it the quarantine profile until DELETE /boot-loops/%s",
+		l.MAC, l.Fetches, d.window, l.MAC)
+	events.publish("node.boot-loop", l.MAC, *l)
+	if len(d.alertURL) == 0 {
+		return
+	}
+	b, _ := json.Marshal(l)
+	go func() {
+		resp, err := http.Post(d.alertURL, "application/json", bytes.NewReader(b))
+		if err != nil {
+			glog.Warningf("Cannot POST boot loop alert of %s to %s: %v", l.MAC, d.alertURL, err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// listHandler returns the nodes caught in boot loops in JSON.
+func (d *bootLoopWatchdog) listHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		loops := make([]bootLoop, 0, len(d.loops))
+		for _, l := range d.loops {
+			loops = append(loops, l)
+		}
+		d.mu.Unlock()
+		sort.Slice(loops, func(i, j int) bool { return loops[i].MAC < loops[j].MAC })
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(loops))
+	})
+}
+
+// releaseHandler releases the node given by {mac} on DELETE, so it
+// gets its own profile again.  Serve it behind adminAuth.require.
+func (d *bootLoopWatchdog) releaseHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			http.Error(w, "Only DELETE releases a node", http.StatusMethodNotAllowed)
+			return
+		}
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		candy.Must(err)
+		released, err := d.release(hwAddr.String())
+		candy.Must(err)
+		if !released {
+			http.Error(w, hwAddr.String()+" is not in a boot loop", http.StatusNotFound)
+			return
+		}
+		glog.Infof("%s released %s from boot loop quarantine", authorOf(r), hwAddr)
+		events.publish("node.released", hwAddr.String(), map[string]string{"author": authorOf(r)})
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestBootLoopWatchdog(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "reports", "boot-loops.json")
+
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	d, e := newBootLoopWatchdog(time.Hour, 3, "", file)
+	candy.Must(e)
+	d.now = func() time.Time { return now }
+
+	served := 0
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", d.watch(func(w http.ResponseWriter, r *http.Request) { served++ }))
+	router.HandleFunc("/boot-loops", d.listHandler())
+	router.HandleFunc("/boot-loops/{mac}", d.releaseHandler())
+	do := func(method, url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, nil)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	loops := func() []bootLoop {
+		var l []bootLoop
+		assert.Nil(t, json.Unmarshal(do("GET", "/boot-loops").Body.Bytes(), &l))
+		return l
+	}
+
+	// Fetches spread wider than the window are no loop.
+	for i := 0; i < 4; i++ {
+		do("GET", "/cloud-config/00:25:90:c0:f7:80")
+		now = now.Add(40 * time.Minute)
+	}
+	assert.Empty(t, loops())
+
+	for i := 0; i < 3; i++ {
+		do("GET", "/cloud-config/00-25-90-C0-F7-80")
+		now = now.Add(time.Minute)
+	}
+	assert.Equal(t, 7, served)
+	l := loops()
+	if assert.Equal(t, 1, len(l)) {
+		assert.Equal(t, "00:25:90:c0:f7:80", l[0].MAC)
+		assert.Equal(t, 3, l[0].Fetches)
+	}
+
+	// The boot loop survives restarts.
+	g, e := newBootLoopWatchdog(time.Hour, 3, "", file)
+	candy.Must(e)
+	if assert.Equal(t, 1, len(g.loops)) {
+		assert.Equal(t, 3, g.loops["00:25:90:c0:f7:80"].Fetches)
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do("GET", "/boot-loops/00:25:90:c0:f7:80").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/boot-loops/0c:c4:7a:82:c5:bc").Code)
+	assert.Equal(t, http.StatusOK, do("DELETE", "/boot-loops/00:25:90:c0:f7:80").Code)
+	assert.Empty(t, loops())
+	g, e = newBootLoopWatchdog(time.Hour, 3, "", file)
+	candy.Must(e)
+	assert.Empty(t, g.loops)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// bringUpNode is how the bring-up went for a node.
+type bringUpNode struct {
+	MAC       string
+	Started   time.Time // The first fetch of the cloud-config of the node.
+	Finished  time.Time // The first-boot report, zero if none yet.
+	Seconds   float64   `json:",omitempty"`
+	Fetches   int       // Of cloud-configs and post-install scripts.
+	Retries   int       // Fetches after the first one.
+	Artifacts int       // Static files served to the node.
+	Failures  []string  `json:",omitempty"`
+}
+
+// bringUpReport summarizes a bring-up, from the first cloud-config
+// fetched by a node to the first-boot reports of all nodes that
+// fetched theirs since.
+type bringUpReport struct {
+	ID            string
+	ConfigVersion string
+	Started       time.Time
+	Finished      time.Time
+	Seconds       float64
+	Nodes         []bringUpNode
+	Artifacts     map[string]int // Times served, by path under /static/.
+	Failures      int
+}
+
+// bringUpTracker follows the requests of nodes as a middleware.  A
+// node joins the bring-up by fetching its cloud-config, not by other
+// requests naming it, like those for its provenance.  Once every node
+// that joined and isn't quarantined in cluster-desc has uploaded its
+// first-boot report, which signals that it completed, it saves a
+// bringUpReport to reportDir/bringup/<id>.json, served as
+// /reports/bringup/<id>, and starts over with the next bring-up.
+// Nodes that don't join, like those not reinstalled, don't hold the
+// bring-up open.
+type bringUpTracker struct {
+	clusterDescFile string
+	ccTemplateDir   string
+	reportDir       string
+	now             func() time.Time
+
+	mu        sync.Mutex
+	nodes     map[string]*bringUpNode
+	macOf     map[string]string // By remote IP, to tell who fetches artifacts.
+	artifacts map[string]int
+}
+
+func newBringUpTracker(clusterDescFile, ccTemplateDir, reportDir string) *bringUpTracker {
+	t := &bringUpTracker{
+		clusterDescFile: clusterDescFile,
+		ccTemplateDir:   ccTemplateDir,
+		reportDir:       reportDir,
+		now:             time.Now,
+	}
+	t.reset()
+	return t
+}
+
+func (t *bringUpTracker) reset() {
+	t.nodes = make(map[string]*bringUpNode)
+	t.macOf = make(map[string]string)
+	t.artifacts = make(map[string]int)
+}
+
+func (t *bringUpTracker) dir() string {
+	return path.Join(t.reportDir, "bringup")
+}
+
+// middleware tracks every request served by next.
+func (t *bringUpTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		t.observe(r, sw.status, strings.TrimSpace(sw.body.String()))
+	})
+}
+
+func (t *bringUpTracker) observe(r *http.Request, status int, body string) {
+	ip, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil {
+		ip = r.RemoteAddr
+	}
+	mac := macInPath(r.URL.Path)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(mac) == 0 {
+		if !strings.HasPrefix(r.URL.Path, "/static/") || status >= 400 {
+			return
+		}
+		if n, ok := t.nodes[t.macOf[ip]]; ok {
+			n.Artifacts++
+			t.artifacts[strings.TrimPrefix(r.URL.Path, "/static/")]++
+		}
+		return
+	}
+
+	n, ok := t.nodes[mac]
+	if !ok {
+		if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, "/cloud-config/") || isPreflight(r) {
+			return
+		}
+		n = &bringUpNode{MAC: mac, Started: t.now()}
+		t.nodes[mac] = n
+	}
+	t.macOf[ip] = mac
+	if (strings.HasPrefix(r.URL.Path, "/cloud-config/") || strings.HasPrefix(r.URL.Path, "/centos/post-script/")) && !isPreflight(r) {
+		n.Fetches++
+		if n.Fetches > 1 {
+			n.Retries++
+		}
+	}
+	if status >= 400 {
+		n.Failures = append(n.Failures, fmt.Sprintf("%s %s: %d %s", r.Method, r.URL.Path, status, cctemplate.RedactText(body)))
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/"+firstBootReportFile) && (r.Method == "POST" || r.Method == "PUT") && n.Finished.IsZero() {
+		n.Finished = t.now()
+		n.Seconds = n.Finished.Sub(n.Started).Seconds()
+		hwAddr, _ := net.ParseMAC(mac)
+		if _, _, failed := readFirstBootReport(nodeReportDir(t.reportDir, hwAddr)); failed {
+			n.Failures = append(n.Failures, "failed units on first boot, see /nodes/"+mac+"/first-boot-report")
+		}
+		t.finishLocked()
+	}
+}
+
+// finishLocked saves the report and starts over, if every node of
+// the cluster has finished.
+func (t *bringUpTracker) finishLocked() {
+	c, e := cctemplate.LoadClusterDesc(t.clusterDescFile)
+	if e != nil {
+		glog.Warningf("Cannot tell if the bring-up finished: %v", e)
+		return
+	}
+	if !bringUpFinished(c, t.nodes) {
+		return
+	}
+	rep := t.reportLocked()
+	if e := t.save(rep); e != nil {
+		glog.Errorf("Cannot save bring-up report %s: %v", rep.ID, e)
+		return
+	}
+	glog.Infof("Bring-up %s finished in %.0fs with %d failures", rep.ID, rep.Seconds, rep.Failures)
+	events.publish("bringup.finished", "", map[string]interface{}{"id": rep.ID, "seconds": rep.Seconds, "failures": rep.Failures})
+	t.reset()
+}
+
+// bringUpFinished tells whether every node in nodes has completed,
+// but for those quarantined in c.
+func bringUpFinished(c *clusterdesc.Cluster, nodes map[string]*bringUpNode) bool {
+	quarantined := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if n.Quarantined() {
+			quarantined[n.Mac()] = true
+		}
+	}
+	finished := 0
+	for mac, b := range nodes {
+		if quarantined[mac] {
+			continue
+		}
+		if b.Finished.IsZero() {
+			return false
+		}
+		finished++
+	}
+	return finished > 0
+}
+
+func (t *bringUpTracker) reportLocked() *bringUpReport {
+	rep := &bringUpReport{Artifacts: make(map[string]int, len(t.artifacts))}
+	for k, v := range t.artifacts {
+		rep.Artifacts[k] = v
+	}
+	for _, n := range t.nodes {
+		if rep.Started.IsZero() || n.Started.Before(rep.Started) {
+			rep.Started = n.Started
+		}
+		if n.Finished.After(rep.Finished) {
+			rep.Finished = n.Finished
+		}
+		rep.Failures += len(n.Failures)
+		rep.Nodes = append(rep.Nodes, *n)
+	}
+	sort.Slice(rep.Nodes, func(i, j int) bool { return rep.Nodes[i].MAC < rep.Nodes[j].MAC })
+	if !rep.Finished.IsZero() {
+		rep.Seconds = rep.Finished.Sub(rep.Started).Seconds()
+	}
+	rep.ID = rep.Started.UTC().Format("20060102T150405Z")
+	if v, e := cctemplate.ConfigVersion(t.ccTemplateDir, t.clusterDescFile); e == nil {
+		rep.ConfigVersion = v
+	}
+	return rep
+}
+
+func (t *bringUpTracker) save(rep *bringUpReport) error {
+	if e := os.MkdirAll(t.dir(), 0755); e != nil {
+		return e
+	}
+	b, e := json.MarshalIndent(rep, "", "  ")
+	if e != nil {
+		return e
+	}
+	fn := path.Join(t.dir(), rep.ID+".json")
+	if e := ioutil.WriteFile(fn+".tmp", b, 0644); e != nil {
+		return e
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// listHandler lists the IDs of the saved bring-up reports in JSON.
+func (t *bringUpTracker) listHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		ids := []string{}
+		fis, e := ioutil.ReadDir(t.dir())
+		if e != nil && !os.IsNotExist(e) {
+			candy.Must(e)
+		}
+		for _, fi := range fis {
+			if strings.HasSuffix(fi.Name(), ".json") {
+				ids = append(ids, strings.TrimSuffix(fi.Name(), ".json"))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(ids))
+	})
+}
+
+// reportHandler serves the bring-up report given by {id}, or, for
+// current, the one in progress.
+func (t *bringUpTracker) reportHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		w.Header().Set("Content-Type", "application/json")
+		if id == "current" {
+			t.mu.Lock()
+			rep := t.reportLocked()
+			t.mu.Unlock()
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			candy.Must(enc.Encode(rep))
+			return
+		}
+		if path.Base(id) != id || strings.HasPrefix(id, ".") {
+			http.Error(w, "invalid bring-up report "+id, http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, path.Join(t.dir(), id+".json"))
+	})
+}
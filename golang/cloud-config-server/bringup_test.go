@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestBringUpReport(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	reportDir := path.Join(dir, "reports")
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	b := []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80", "ip": "10.10.14.1"}, {"mac": "00:25:90:c0:f7:81", "ip": "10.10.14.2"}, {"mac": "00:25:90:c0:f7:82", "quarantine": "burn-in"}, {"mac": "00:25:90:c0:f7:83"}]}`)
+	candy.Must(ioutil.WriteFile(clusterDescFile, b, 0644))
+
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newBringUpTracker(clusterDescFile, templateDir, reportDir)
+	tracker.now = func() time.Time { return now }
+
+	fail := true
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			fail = false
+			http.Error(w, "template: cc-template: boom", http.StatusInternalServerError)
+		}
+	})
+	router.PathPrefix("/static/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/nodes/{mac}/provenance", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/nodes/{mac}/first-boot-report", makeFirstBootReportHandler(reportDir, clusterDescFile, ""))
+	router.HandleFunc("/reports/bringup", tracker.listHandler())
+	router.HandleFunc("/reports/bringup/{id}", tracker.reportHandler())
+	handler := tracker.middleware(router)
+	do := func(from, method, url, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.RemoteAddr = from + ":12345"
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	ids := func() []string {
+		var l []string
+		assert.Nil(t, json.Unmarshal(do("10.0.0.1", "GET", "/reports/bringup", "").Body.Bytes(), &l))
+		return l
+	}
+
+	do("10.10.14.1", "GET", "/cloud-config/00:25:90:c0:f7:80", "")
+	do("10.10.14.1", "GET", "/cloud-config/00:25:90:c0:f7:80", "")
+	do("10.10.14.1", "GET", "/static/kubelet", "")
+	do("10.10.14.2", "GET", "/cloud-config/00:25:90:c0:f7:81", "")
+	do("10.10.14.3", "GET", "/static/unknown", "")
+	// Requests naming a node other than for its cloud-config don't
+	// start its bring-up, so f7:83, which isn't reinstalled, doesn't
+	// hold the bring-up open.
+	do("10.0.0.1", "GET", "/nodes/00:25:90:c0:f7:83/provenance", "")
+	do("10.0.0.1", "GET", "/cloud-config/00:25:90:c0:f7:83?preflight", "")
+	now = now.Add(10 * time.Minute)
+	do("10.10.14.1", "POST", "/nodes/00:25:90:c0:f7:80/first-boot-report", "# units\n# files\n# failed units\n")
+	assert.Empty(t, ids())
+
+	var cur bringUpReport
+	assert.Nil(t, json.Unmarshal(do("10.0.0.1", "GET", "/reports/bringup/current", "").Body.Bytes(), &cur))
+	assert.Equal(t, 2, len(cur.Nodes))
+
+	now = now.Add(5 * time.Minute)
+	do("10.10.14.2", "POST", "/nodes/00:25:90:c0:f7:81/first-boot-report", "# units\n# files\n# failed units\nkubelet.service\n")
+	l := ids()
+	if !assert.Equal(t, []string{"20170601T000000Z"}, l) {
+		return
+	}
+
+	var rep bringUpReport
+	rr := do("10.0.0.1", "GET", "/reports/bringup/"+l[0], "")
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &rep), rr.Body.String())
+	assert.Equal(t, float64(900), rep.Seconds)
+	assert.Equal(t, map[string]int{"kubelet": 1}, rep.Artifacts)
+	assert.Equal(t, 2, rep.Failures)
+	assert.NotEmpty(t, rep.ConfigVersion)
+	if assert.Equal(t, 2, len(rep.Nodes)) {
+		n := rep.Nodes[0]
+		assert.Equal(t, "00:25:90:c0:f7:80", n.MAC)
+		assert.Equal(t, float64(600), n.Seconds)
+		assert.Equal(t, 2, n.Fetches)
+		assert.Equal(t, 1, n.Retries)
+		assert.Equal(t, 1, n.Artifacts)
+		if assert.Equal(t, 1, len(n.Failures)) {
+			assert.Contains(t, n.Failures[0], "boom")
+		}
+		if assert.Equal(t, 1, len(rep.Nodes[1].Failures)) {
+			assert.Contains(t, rep.Nodes[1].Failures[0], "failed units")
+		}
+	}
+
+	// The next bring-up starts over.
+	assert.Nil(t, json.Unmarshal(do("10.0.0.1", "GET", "/reports/bringup/current", "").Body.Bytes(), &cur))
+	assert.Empty(t, cur.Nodes)
+
+	// The router would clean a path with "..", so the id is set
+	// directly to reach the validation of the handler.
+	for _, id := range []string{"..", "../x", ".hidden"} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/reports/bringup/x", nil)
+		tracker.reportHandler()(rr, mux.SetURLVars(req, map[string]string{"id": id}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, id)
+	}
+}
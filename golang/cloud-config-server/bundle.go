@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/topicai/candy"
+)
+
+// makeAddonsHandler generates a HTTP handler, which serves the addon
+// manifests in addonsDir/<role>/ as /addons/<role>.tar.gz, so that each
+// role's config fetches only the addons it applies.
+func makeAddonsHandler(addonsDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		role := strings.TrimSuffix(mux.Vars(r)["bundle"], ".tar.gz")
+		if role == mux.Vars(r)["bundle"] || path.Base(role) != role || strings.HasPrefix(role, ".") {
+			http.NotFound(w, r)
+			return
+		}
+		dir := path.Join(addonsDir, role)
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		candy.Must(err)
+
+		w.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		for _, fi := range files {
+			if !fi.Mode().IsRegular() {
+				continue
+			}
+			hdr, err := tar.FileInfoHeader(fi, "")
+			candy.Must(err)
+			candy.Must(tw.WriteHeader(hdr))
+			f, err := os.Open(path.Join(dir, fi.Name()))
+			candy.Must(err)
+			_, err = io.Copy(tw, f)
+			f.Close()
+			candy.Must(err)
+		}
+		candy.Must(tw.Close())
+		candy.Must(gz.Close())
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestAddonsHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(os.Mkdir(path.Join(dir, "master"), 0755))
+	candy.Must(ioutil.WriteFile(path.Join(dir, "master", "kubedns-svc.yaml"), []byte("kind: Service"), 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/addons/{bundle}", makeAddonsHandler(dir))
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("/addons/worker.tar.gz").Code)
+	assert.Equal(t, http.StatusNotFound, get("/addons/master").Code)
+
+	rr := get("/addons/master.tar.gz")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	gz, e := gzip.NewReader(rr.Body)
+	candy.Must(e)
+	tr := tar.NewReader(gz)
+	hdr, e := tr.Next()
+	candy.Must(e)
+	assert.Equal(t, "kubedns-svc.yaml", hdr.Name)
+	b, _ := ioutil.ReadAll(tr)
+	assert.Equal(t, "kind: Service", string(b))
+	_, e = tr.Next()
+	assert.Equal(t, io.EOF, e)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// makeDebugRenderHandler generates a HTTP handler, which renders the
+// template given by ?template=, cc-template by default, for a node
+// without certs, followed by the variables the template was executed
+// with, both with secrets redacted.  With ?trace=1, output lines are
+// annotated with the template file and line they come from.
+func makeDebugRenderHandler(clusterDescFile, ccTemplateDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		candy.Must(err)
+		name := r.URL.Query().Get("template")
+		if len(name) == 0 {
+			name = "cc-template"
+		}
+		trace := r.URL.Query().Get("trace") == "1"
+
+		var out bytes.Buffer
+		candy.Must(cctemplate.ExecuteDebug(&out, hwAddr.String(), name, ccTemplateDir, clusterDescFile, trace))
+
+		c, err := cctemplate.EffectiveConfig(hwAddr.String(), clusterDescFile)
+		candy.Must(err)
+		redacted, err := cctemplate.Redact(c)
+		candy.Must(err)
+		b, err := json.MarshalIndent(redacted, "", "  ")
+		candy.Must(err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "%s\n\n# Variables:\n%s\n", cctemplate.RedactText(out.String()), b)
+	})
+}
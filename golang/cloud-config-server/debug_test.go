@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestDebugRenderHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	tmplDir := path.Join(dir, "templatefiles")
+	candy.Must(os.Mkdir(tmplDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "cc.template"),
+		[]byte("{{ define \"cc-template\" }}\nhostname: {{ .Hostname }}{{ end }}"), 0644))
+	desc := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(desc, []byte(`{"dockerdomain": "bootstrapper"}`), 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/debug/render/{mac}", makeDebugRenderHandler(desc, tmplDir))
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/render/00:25:90:c0:f7:80?trace=1", nil)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cc.template:2| hostname: 00-25-90-c0-f7-80")
+	assert.Contains(t, rr.Body.String(), `"Dockerdomain": "bootstrapper"`)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// deprecationUse is a deprecated construct and the nodes whose
+// configs are rendered from it.
+type deprecationUse struct {
+	clusterdesc.Deprecation
+	Nodes []string
+}
+
+// summarizeDeprecations returns the deprecated constructs used by the
+// nodes in c, including unlistedWorkers, which stands for the nodes
+// not enlisted in cluster-desc.
+func summarizeDeprecations(c *clusterdesc.Cluster, ccTemplateDir, clusterDescFile string) ([]deprecationUse, error) {
+	uses := make(map[string]*deprecationUse)
+	nodes := append(append([]clusterdesc.Node{}, c.Nodes...), clusterdesc.Node{MAC: "00:00:00:00:00:00"})
+	for i, n := range nodes {
+		name := n.Hostname()
+		if i == len(nodes)-1 {
+			name = unlistedWorkers
+		}
+		ds, err := cctemplate.Deprecations(n.Mac(), ccTemplateDir, clusterDescFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range ds {
+			if uses[d.Construct] == nil {
+				uses[d.Construct] = &deprecationUse{Deprecation: d}
+			}
+			uses[d.Construct].Nodes = append(uses[d.Construct].Nodes, name)
+		}
+	}
+	summary := []deprecationUse{}
+	for _, u := range uses {
+		summary = append(summary, *u)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Construct < summary[j].Construct })
+	return summary, nil
+}
+
+// makeDeprecationsHandler generates a HTTP handler, which returns in
+// JSON the deprecated constructs of cluster-desc and the templates
+// in use, by the nodes using them, so operators can migrate before
+// the constructs are removed.
+func makeDeprecationsHandler(clusterDescFile, ccTemplateDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cctemplate.LoadClusterDesc(clusterDescFile)
+		candy.Must(err)
+		summary, err := summarizeDeprecations(c, ccTemplateDir, clusterDescFile)
+		candy.Must(err)
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		candy.Must(enc.Encode(summary))
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestDeprecationsHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "cc.template"), []byte(`{{ define "cc-template" }}{{ .MasterIP }}{{ end }}`), 0644))
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(clusterDescFile, []byte(`{"nodes": [{"mac": "00:00:00:00:00:01"}, {"mac": "00:00:00:00:00:02", "quarantine": "burn-in"}]}`), 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/deprecations", makeDeprecationsHandler(clusterDescFile, dir))
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/deprecations", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var summary []deprecationUse
+	candy.Must(json.Unmarshal(rr.Body.Bytes(), &summary))
+	// Quarantined nodes are rendered from no deprecated constructs.
+	if assert.Len(t, summary, 1) {
+		assert.Equal(t, "cc.template:1: .MasterIP", summary[0].Construct)
+		assert.Equal(t, []string{"00-00-00-00-00-01", unlistedWorkers}, summary[0].Nodes)
+	}
+}
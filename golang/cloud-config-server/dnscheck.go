@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+const dnsCheckTimeout = 5 * time.Second
+
+// dnsConflict describes a record in the external DNS zone that
+// contradicts the hostname or fixed IP of a node in cluster-desc.
+type dnsConflict struct {
+	MAC    string
+	Name   string // The FQDN of the node.
+	IP     string // The fixed IP of the node.
+	Record string // A or PTR.
+	Found  []string
+	Time   time.Time
+}
+
+// dnsChecker looks up, on the authoritative server of the external
+// zone, the FQDN and the fixed IP of every node before serving the
+// node its config.  If the zone maps the FQDN to another address, or
+// the IP to another name, like records left by a decommissioned
+// machine, the conflict is logged and listed by /dns-conflicts, and,
+// if refuse, the config is refused.  Nodes without a fixed IP, or a
+// cluster without domainname, are not checked.
+type dnsChecker struct {
+	refuse     bool
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	now        func() time.Time
+
+	mu        sync.Mutex
+	conflicts map[string]dnsConflict // By MAC.
+}
+
+func newDNSChecker(server string, refuse bool) *dnsChecker {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+	return &dnsChecker{
+		refuse:     refuse,
+		lookupHost: r.LookupHost,
+		lookupAddr: r.LookupAddr,
+		now:        time.Now,
+		conflicts:  make(map[string]dnsConflict),
+	}
+}
+
+// lookupRecords returns the records found, where none is not an error.
+func lookupRecords(ctx context.Context, f func(context.Context, string) ([]string, error), name string) ([]string, error) {
+	found, e := f(ctx, name)
+	if dnsErr, ok := e.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return found, e
+}
+
+// check looks up n of c and returns the conflict, if any.
+func (d *dnsChecker) check(c *clusterdesc.Cluster, n clusterdesc.Node) *dnsConflict {
+	if len(n.IP) == 0 || len(c.DomainName) == 0 {
+		return nil
+	}
+	fqdn := n.Hostname() + "." + strings.TrimSuffix(c.DomainName, ".")
+	ctx, cancel := context.WithTimeout(context.Background(), dnsCheckTimeout)
+	defer cancel()
+
+	var conflict *dnsConflict
+	addrs, e := lookupRecords(ctx, d.lookupHost, fqdn+".")
+	if e != nil {
+		glog.Warningf("Cannot look up %s of %s: %v", fqdn, n.Mac(), e)
+		return nil
+	}
+	for _, a := range addrs {
+		if a != n.IP {
+			conflict = &dnsConflict{Record: "A", Found: addrs}
+			break
+		}
+	}
+	if conflict == nil {
+		names, e := lookupRecords(ctx, d.lookupAddr, n.IP)
+		if e != nil {
+			glog.Warningf("Cannot look up %s of %s: %v", n.IP, n.Mac(), e)
+			return nil
+		}
+		for _, name := range names {
+			if !strings.EqualFold(strings.TrimSuffix(name, "."), fqdn) {
+				conflict = &dnsConflict{Record: "PTR", Found: names}
+				break
+			}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if conflict == nil {
+		delete(d.conflicts, n.Mac())
+		return nil
+	}
+	conflict.MAC, conflict.Name, conflict.IP, conflict.Time = n.Mac(), fqdn, n.IP, d.now()
+	d.conflicts[n.Mac()] = *conflict
+	glog.Errorf("ALERT: the external DNS has %s records %s for %s (%s), contradicting cluster-desc",
+		conflict.Record, strings.Join(conflict.Found, ","), fqdn, n.IP)
+	events.publish("node.dns-conflict", n.Mac(), *conflict)
+	return conflict
+}
+
+// wrap checks the node given by {mac} in clusterDescFile before h
+// serves it.  A nil dnsChecker checks nothing.
+func (d *dnsChecker) wrap(clusterDescFile string, h http.HandlerFunc) http.HandlerFunc {
+	if d == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		if err == nil {
+			if c, err := cctemplate.LoadClusterDesc(clusterDescFile); err == nil {
+				for _, n := range c.Nodes {
+					if n.Mac() == hwAddr.String() {
+						if conflict := d.check(c, n); conflict != nil && d.refuse {
+							http.Error(w, "the external DNS has "+conflict.Record+" records "+strings.Join(conflict.Found, ",")+
+								" for "+conflict.Name+" ("+conflict.IP+")", http.StatusConflict)
+							return
+						}
+						break
+					}
+				}
+			}
+		}
+		h(w, r)
+	}
+}
+
+// listHandler returns the DNS conflicts found in JSON.
+func (d *dnsChecker) listHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		conflicts := []dnsConflict{}
+		if d != nil {
+			d.mu.Lock()
+			for _, c := range d.conflicts {
+				conflicts = append(conflicts, c)
+			}
+			d.mu.Unlock()
+		}
+		sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].MAC < conflicts[j].MAC })
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(conflicts))
+	})
+}
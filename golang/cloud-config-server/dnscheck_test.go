@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestDNSChecker(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	b := []byte(`{"domainname": "example.com", "nodes": [{"mac": "00:25:90:c0:f7:80", "ip": "10.10.14.200"}, {"mac": "00:25:90:c0:f7:81"}]}`)
+	candy.Must(ioutil.WriteFile(clusterDescFile, b, 0644))
+
+	hosts, addrs := map[string][]string{}, map[string][]string{}
+	looked := 0
+	find := func(m map[string][]string) func(context.Context, string) ([]string, error) {
+		return func(_ context.Context, name string) ([]string, error) {
+			looked++
+			if r, ok := m[name]; ok {
+				return r, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+	}
+	d := newDNSChecker("10.10.14.1", true)
+	d.lookupHost, d.lookupAddr = find(hosts), find(addrs)
+
+	served := 0
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", d.wrap(clusterDescFile, func(w http.ResponseWriter, r *http.Request) { served++ }))
+	router.HandleFunc("/dns-conflicts", d.listHandler())
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	conflicts := func() []dnsConflict {
+		var l []dnsConflict
+		assert.Nil(t, json.Unmarshal(get("/dns-conflicts").Body.Bytes(), &l))
+		return l
+	}
+
+	// No records, or records matching cluster-desc, are no conflict.
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	hosts["00-25-90-c0-f7-80.example.com."] = []string{"10.10.14.200"}
+	addrs["10.10.14.200"] = []string{"00-25-90-c0-f7-80.example.com."}
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	assert.Empty(t, conflicts())
+
+	// Nodes without a fixed IP aren't looked up.
+	get("/cloud-config/00:25:90:c0:f7:81")
+	assert.Equal(t, 4, looked)
+	assert.Equal(t, 3, served)
+
+	addrs["10.10.14.200"] = []string{"old-db.example.com."}
+	rr := get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "old-db.example.com.")
+	l := conflicts()
+	if assert.Equal(t, 1, len(l)) {
+		assert.Equal(t, "PTR", l[0].Record)
+		assert.Equal(t, "00-25-90-c0-f7-80.example.com", l[0].Name)
+	}
+
+	hosts["00-25-90-c0-f7-80.example.com."] = []string{"10.10.14.9"}
+	rr = get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "A", conflicts()[0].Record)
+	assert.Equal(t, 3, served)
+
+	// Once the records are fixed, the conflict is cleared.
+	delete(hosts, "00-25-90-c0-f7-80.example.com.")
+	delete(addrs, "10.10.14.200")
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80").Code)
+	assert.Empty(t, conflicts())
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+const maxEditSize = 1 << 20
+
+// editMutex serializes edits, so the version check and the write of
+// an edit are atomic.
+var editMutex sync.Mutex
+
+// etag returns the version of a file content, used as its ETag.
+func etag(b []byte) string {
+	return fmt.Sprintf("\"%x\"", sha256.Sum256(b))
+}
+
+// makeEditHandler generates a HTTP handler that serves the file
+// returned by fileOf with its version in ETag, and replaces it on PUT
+// if the If-Match precondition carries the current version, or, to
+// create the file, if If-None-Match is *.  So two operators editing
+// the same file can't silently clobber each other.  The new content
+// must pass validate.  Versions are kept in history, listed in JSON on
+// GET with ?versions, and POST with ?rollback=<version> and the same
+// preconditions as PUT restores one of them.  Edits are attributed to
+// the operator authenticated by adminAuth.
+func makeEditHandler(fileOf func(r *http.Request) (string, error), validate func(fn string, b []byte) error, history *editHistory) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		fn, err := fileOf(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		editMutex.Lock()
+		defer editMutex.Unlock()
+
+		cur, err := ioutil.ReadFile(fn)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			candy.Must(err)
+		}
+
+		if r.Method != "PUT" && r.Method != "POST" {
+			if _, ok := r.URL.Query()["versions"]; ok {
+				l, err := history.list(fn)
+				candy.Must(err)
+				w.Header().Set("Content-Type", "application/json")
+				candy.Must(json.NewEncoder(w).Encode(l))
+				return
+			}
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", etag(cur))
+			w.Write(cur)
+			return
+		}
+
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		switch {
+		case len(ifMatch) == 0 && ifNoneMatch != "*":
+			http.Error(w, "If-Match with the current ETag, or If-None-Match: * to create, is required", http.StatusPreconditionRequired)
+			return
+		case len(ifMatch) > 0 && (!exists || ifMatch != etag(cur)):
+			http.Error(w, "edited concurrently, reload and retry", http.StatusPreconditionFailed)
+			return
+		case ifNoneMatch == "*" && exists:
+			http.Error(w, "already exists", http.StatusPreconditionFailed)
+			return
+		}
+
+		var b []byte
+		if r.Method == "POST" {
+			if b, err = history.load(fn, r.URL.Query().Get("rollback")); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		} else {
+			b, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEditSize))
+			candy.Must(err)
+		}
+		if err := validate(fn, b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Write to a temporary file and rename, so renders never
+		// see a partially written file.
+		if exists {
+			if err := history.save(fn, cur); err != nil {
+				glog.Warningf("Cannot keep the history of %s: %v", fn, err)
+			}
+		}
+		tmp := fn + ".editing"
+		candy.Must(ioutil.WriteFile(tmp, b, 0644))
+		candy.Must(os.Rename(tmp, fn))
+		if err := history.save(fn, b); err != nil {
+			glog.Warningf("Cannot keep the history of %s: %v", fn, err)
+		}
+
+		author := authorOf(r)
+		glog.Infof("%s edited %s to version %s", author, fn, etag(b))
+		events.publish("config.edited", "", map[string]string{"file": path.Base(fn), "version": etag(b), "author": author})
+		w.Header().Set("ETag", etag(b))
+	})
+}
+
+func validateClusterDesc(fn string, b []byte) error {
+	c := &clusterdesc.Cluster{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return err
+	}
+	if err := c.CheckMinSextantVersion(); err != nil {
+		return err
+	}
+	if err := c.CheckSysctl(); err != nil {
+		return err
+	}
+	if err := c.CheckFirewall(); err != nil {
+		return err
+	}
+	if err := c.CheckSystemdDropIns(); err != nil {
+		return err
+	}
+	return c.CheckKubernetesVersion()
+}
+
+func validateTemplate(fn string, b []byte) error {
+	if _, err := template.New("").Parse(string(b)); err != nil {
+		return err
+	}
+	return cctemplate.CheckTemplateVersion(path.Base(fn), b)
+}
+
+// serveCABundleRemoval answers GET of the CA bundle in caBundleFile
+// with 410 Gone if an operator emptied it, which tells nodes to remove
+// the bundle they installed.  Nodes keep theirs on 404, as the bundle
+// may just be missing, like on a bootstrapper set up again.
+func serveCABundleRemoval(caBundleFile string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			if _, ok := r.URL.Query()["versions"]; !ok {
+				if b, err := ioutil.ReadFile(caBundleFile); err == nil && len(bytes.TrimSpace(b)) == 0 {
+					w.Header().Set("ETag", etag(b))
+					http.Error(w, "the CA bundle was removed", http.StatusGone)
+					return
+				}
+			}
+		}
+		h(w, r)
+	}
+}
+
+// validateCABundle checks that b consists of PEM encoded certificates
+// only, so nodes aren't handed something their trust stores skip or
+// choke on.  An empty bundle trusts nothing beyond the system CAs.
+func validateCABundle(fn string, b []byte) error {
+	for rest := bytes.TrimSpace(b); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return errors.New("not a PEM encoded certificate: " + string(firstLine(rest)))
+		}
+		if block.Type != "CERTIFICATE" {
+			return errors.New("not a certificate: " + block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+// templateFileOf returns the file of the template named by the route
+// variable {name} in the last root of ccTemplateDir, so edits overlay
+// the templates of earlier roots instead of modifying them.
+func templateFileOf(ccTemplateDir string) func(r *http.Request) (string, error) {
+	roots := cctemplate.TemplateRoots(ccTemplateDir)
+	return func(r *http.Request) (string, error) {
+		name := mux.Vars(r)["name"]
+		if path.Base(name) != name || strings.HasPrefix(name, ".") {
+			return "", errors.New("invalid template name " + name)
+		}
+		if len(roots) == 0 {
+			return "", errors.New("no template directory")
+		}
+		if fi, err := os.Stat(roots[len(roots)-1]); err == nil && !fi.IsDir() {
+			return "", errors.New("the legacy single-file template layout cannot be edited; add a template directory to -cloud-config-dir")
+		}
+		return path.Join(roots[len(roots)-1], name), nil
+	}
+}
+
+// makeTemplateOriginsHandler generates a HTTP handler, which returns
+// in JSON the file each template is loaded from, by template file
+// name, so one can tell which root of ccTemplateDir overrides it.
+func makeTemplateOriginsHandler(ccTemplateDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		files, err := cctemplate.TemplateFiles(ccTemplateDir)
+		candy.Must(err)
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		candy.Must(enc.Encode(files))
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestEditHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "a.template"), []byte("v1"), 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/templates/{name}", makeEditHandler(templateFileOf(dir), validateTemplate, nil))
+	do := func(method, url, body string, header map[string]string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("GET", "/templates/a.template", "", nil)
+	assert.Equal(t, "v1", rr.Body.String())
+	v1 := rr.Header().Get("ETag")
+
+	assert.Equal(t, http.StatusPreconditionRequired, do("PUT", "/templates/a.template", "v2", nil).Code)
+	// If-None-Match creates only with *, and never replaces a file.
+	assert.Equal(t, http.StatusPreconditionRequired, do("PUT", "/templates/a.template", "v2", map[string]string{"If-None-Match": `"stale"`}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "/templates/a.template", "v2", map[string]string{"If-Match": `"stale"`}).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/templates/a.template", "{{ if }}", map[string]string{"If-Match": v1}).Code)
+
+	rr = do("PUT", "/templates/a.template", "v2", map[string]string{"If-Match": v1})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEqual(t, v1, rr.Header().Get("ETag"))
+	// The second of two edits based on v1 is rejected.
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "/templates/a.template", "v3", map[string]string{"If-Match": v1}).Code)
+	assert.Equal(t, "v2", do("GET", "/templates/a.template", "", nil).Body.String())
+
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "/templates/a.template", "v3", map[string]string{"If-None-Match": "*"}).Code)
+	assert.Equal(t, http.StatusOK, do("PUT", "/templates/b.template", "b", map[string]string{"If-None-Match": "*"}).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/templates/.hidden", "b", map[string]string{"If-None-Match": "*"}).Code)
+}
+
+func TestTemplateOverlay(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	upstream, overlay := path.Join(dir, "upstream"), path.Join(dir, "overlay")
+	candy.Must(os.Mkdir(upstream, 0755))
+	candy.Must(os.Mkdir(overlay, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(upstream, "a.template"), []byte("upstream"), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(upstream, "b.template"), []byte("upstream"), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(overlay, "b.template"), []byte("overlay"), 0644))
+	roots := upstream + ":" + overlay
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/templates/{name}", makeEditHandler(templateFileOf(roots), validateTemplate, nil))
+	router.HandleFunc("/template-origins", makeTemplateOriginsHandler(roots))
+	origins := func() map[string]string {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/template-origins", nil)
+		router.ServeHTTP(rr, req)
+		m := make(map[string]string)
+		candy.Must(json.Unmarshal(rr.Body.Bytes(), &m))
+		return m
+	}
+	assert.Equal(t, map[string]string{
+		"a.template": path.Join(upstream, "a.template"),
+		"b.template": path.Join(overlay, "b.template"),
+	}, origins())
+
+	// Edits go to the overlay, leaving upstream intact.
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/templates/a.template", bytes.NewBufferString("edited"))
+	req.Header.Set("If-None-Match", "*")
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, path.Join(overlay, "a.template"), origins()["a.template"])
+	b, _ := ioutil.ReadFile(path.Join(upstream, "a.template"))
+	assert.Equal(t, "upstream", string(b))
+}
+
+func TestValidateCABundle(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	caKey, caCrt := certgen.GenerateRootCA(dir)
+	crt, e := ioutil.ReadFile(caCrt)
+	candy.Must(e)
+	key, e := ioutil.ReadFile(caKey)
+	candy.Must(e)
+
+	assert.Nil(t, validateCABundle("ca-bundle.pem", nil))
+	assert.Nil(t, validateCABundle("ca-bundle.pem", crt))
+	assert.Nil(t, validateCABundle("ca-bundle.pem", append(append(crt, '\n'), crt...)))
+	assert.Error(t, validateCABundle("ca-bundle.pem", key))
+	assert.Error(t, validateCABundle("ca-bundle.pem", append(crt, []byte("garbage\n")...)))
+}
+
+func TestCABundleRemoval(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	bundle := path.Join(dir, "ca-bundle.pem")
+	_, caCrt := certgen.GenerateRootCA(dir)
+	crt, e := ioutil.ReadFile(caCrt)
+	candy.Must(e)
+
+	admin := newAdminAuth(path.Join(dir, "admin-tokens"))
+	candy.Must(ioutil.WriteFile(admin.tokensFile, []byte("s3cret alice\n"), 0600))
+	h := admin.guard(serveCABundleRemoval(bundle, makeEditHandler(
+		func(*http.Request) (string, error) { return bundle, nil }, validateCABundle, nil)))
+	do := func(method, body string, header map[string]string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/ca-bundle", bytes.NewBufferString(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		h(rr, req)
+		return rr
+	}
+
+	// Nodes keep their bundle while it is missing, and remove it once
+	// an operator emptied it.
+	assert.Equal(t, http.StatusNotFound, do("GET", "", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, do("PUT", string(crt), map[string]string{"If-None-Match": "*"}).Code)
+	rr := do("PUT", string(crt), map[string]string{"If-None-Match": "*", "Authorization": "Bearer s3cret"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, string(crt), do("GET", "", nil).Body.String())
+
+	rr = do("PUT", "", map[string]string{"If-Match": rr.Header().Get("ETag"), "Authorization": "Bearer s3cret"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = do("GET", "", nil)
+	assert.Equal(t, http.StatusGone, rr.Code)
+	assert.Equal(t, etag(nil), rr.Header().Get("ETag"))
+}
+
+func TestEditRollback(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "config", "cluster-desc.yml")
+	candy.Must(os.Mkdir(path.Dir(fn), 0755))
+	candy.Must(ioutil.WriteFile(fn, []byte("v1"), 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cluster-desc", makeEditHandler(func(*http.Request) (string, error) { return fn, nil },
+		func(string, []byte) error { return nil }, newEditHistory(path.Join(dir, "history"), 10)))
+	do := func(method, url, body string, header map[string]string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	v1 := do("GET", "/cluster-desc", "", nil).Header().Get("ETag")
+	v2 := do("PUT", "/cluster-desc", "v2", map[string]string{"If-Match": v1}).Header().Get("ETag")
+
+	var versions []historyVersion
+	candy.Must(json.Unmarshal(do("GET", "/cluster-desc?versions", "", nil).Body.Bytes(), &versions))
+	assert.Equal(t, 2, len(versions))
+	assert.True(t, versions[1].Current)
+
+	assert.Equal(t, http.StatusPreconditionFailed, do("POST", "/cluster-desc?rollback="+versions[0].Version, "", map[string]string{"If-Match": v1}).Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/cluster-desc?rollback=0123", "", map[string]string{"If-Match": v2}).Code)
+	rr := do("POST", "/cluster-desc?rollback="+versions[0].Version, "", map[string]string{"If-Match": v2})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, v1, rr.Header().Get("ETag"))
+	assert.Equal(t, "v1", do("GET", "/cluster-desc", "", nil).Body.String())
+}
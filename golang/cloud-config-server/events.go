@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// event is a change within sextant, as streamed by /events.  Types
+// are like node.boot-loop or config.edited, see the publish calls.
+type event struct {
+	ID   uint64      `json:"id"`
+	Time time.Time   `json:"time"`
+	Type string      `json:"type"`
+	MAC  string      `json:"mac,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// eventBus numbers the events of sextant in the order published and
+// streams them to the subscribers of /events, so automation can
+// follow nodes, config edits and certs issued without polling the
+// many endpoints listing them.  The last keep events are retained, so
+// a subscriber reconnecting with the ID of the last event it got
+// resumes without a gap, unless it fell further behind.  IDs start at
+// the time the bus was created in milliseconds since the epoch, so
+// they keep increasing across restarts of the server.
+type eventBus struct {
+	keep int
+	now  func() time.Time
+
+	mu     sync.Mutex
+	lastID uint64
+	ring   []event // The retained events, from the oldest on.
+	subs   map[chan event]bool
+}
+
+// events is the event bus of the server, global like the quarantine
+// of cctemplate, as events come from all over.
+var events = newEventBus(1024)
+
+func newEventBus(keep int) *eventBus {
+	return &eventBus{
+		keep:   keep,
+		now:    time.Now,
+		lastID: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		subs:   make(map[chan event]bool),
+	}
+}
+
+func (b *eventBus) publish(typ, mac string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e := event{ID: b.lastID, Time: b.now().UTC(), Type: typ, MAC: mac, Data: data}
+	b.ring = append(b.ring, e)
+	if len(b.ring) > b.keep {
+		b.ring = b.ring[len(b.ring)-b.keep:]
+	}
+	for c := range b.subs {
+		select {
+		case c <- e:
+		default:
+			// Dropping events would break the order, so drop the
+			// subscriber, which resumes from the retained events.
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// subscribe returns the retained events after the event with ID
+// since, and a channel of the events to come.  missed tells if events
+// after since are no longer retained, or since is unknown.
+func (b *eventBus) subscribe(since uint64) (backlog []event, c chan event, missed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	first := b.lastID + 1 - uint64(len(b.ring)) // The oldest retained.
+	if since > b.lastID {
+		since, missed = b.lastID, true
+	} else if since+1 < first {
+		missed = true
+	}
+	for _, e := range b.ring {
+		if e.ID > since {
+			backlog = append(backlog, e)
+		}
+	}
+	c = make(chan event, 256)
+	b.subs[c] = true
+	return backlog, c, missed
+}
+
+func (b *eventBus) unsubscribe(c chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[c] {
+		delete(b.subs, c)
+		close(c)
+	}
+}
+
+// streamHandler streams events as server-sent events, with the event
+// ID as SSE id.  Subscribers resume after the event given by the
+// Last-Event-ID header, which EventSource sends on reconnect, or by
+// ?since=, and by default get only events to come.  If events were
+// missed, an events.missed event comes first, so the subscriber knows
+// to resync from the other endpoints.
+func (b *eventBus) streamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resume := r.Header.Get("Last-Event-ID")
+		if len(resume) == 0 {
+			resume = r.URL.Query().Get("since")
+		}
+		var since uint64
+		if len(resume) > 0 {
+			var err error
+			if since, err = strconv.ParseUint(resume, 10, 64); err != nil {
+				http.Error(w, "invalid event ID "+resume, http.StatusBadRequest)
+				return
+			}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		backlog, c, missed := b.subscribe(since)
+		defer b.unsubscribe(c)
+		if len(resume) == 0 {
+			backlog, missed = nil, false
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		if missed {
+			fmt.Fprintf(w, "event: events.missed\ndata: {}\n\n")
+		}
+		for _, e := range backlog {
+			writeEvent(w, e)
+		}
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-c:
+				if !ok {
+					return // Too slow, resumes on reconnect.
+				}
+				writeEvent(w, e)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e event) {
+	b, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+}
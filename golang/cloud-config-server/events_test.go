@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBusResume(t *testing.T) {
+	b := newEventBus(2)
+	b.publish("config.edited", "", nil)
+	first := b.lastID
+	b.publish("node.first-boot-report", "00:25:90:c0:f7:80", nil)
+	b.publish("node.first-boot-report", "00:25:90:c0:f7:81", nil)
+
+	backlog, c, missed := b.subscribe(first)
+	assert.False(t, missed)
+	if assert.Equal(t, 2, len(backlog)) {
+		assert.Equal(t, first+1, backlog[0].ID)
+		assert.Equal(t, "00:25:90:c0:f7:81", backlog[1].MAC)
+	}
+	b.publish("node.released", "00:25:90:c0:f7:80", nil)
+	assert.Equal(t, first+3, (<-c).ID)
+	b.unsubscribe(c)
+
+	// Events no longer retained, or IDs of another run, are missed.
+	backlog, c, missed = b.subscribe(first - 1)
+	assert.True(t, missed)
+	assert.Equal(t, 2, len(backlog))
+	b.unsubscribe(c)
+	backlog, c, missed = b.subscribe(first + 100)
+	assert.True(t, missed)
+	assert.Empty(t, backlog)
+	b.unsubscribe(c)
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	b := newEventBus(1024)
+	_, c, _ := b.subscribe(b.lastID)
+	for i := 0; i < 300; i++ {
+		b.publish("node.config-rendered", "", nil)
+	}
+	n := 0
+	for range c {
+		n++
+	}
+	assert.Equal(t, 256, n) // Then closed rather than skipping events.
+	b.unsubscribe(c)
+}
+
+func TestEventStream(t *testing.T) {
+	b := newEventBus(16)
+	b.publish("config.edited", "", map[string]string{"file": "cluster-desc.yml"})
+	s := httptest.NewServer(b.streamHandler())
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(b.lastID-1))
+	resp, e := http.DefaultClient.Do(req.WithContext(ctx))
+	assert.Nil(t, e)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	b.publish("node.boot-loop", "00:25:90:c0:f7:80", nil)
+
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 8 {
+		line, e := r.ReadString('\n')
+		assert.Nil(t, e)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	assert.Equal(t, fmt.Sprintf("id: %d", b.lastID-1), lines[0])
+	assert.Equal(t, "event: config.edited", lines[1])
+	assert.Contains(t, lines[2], `"data":{"file":"cluster-desc.yml"}`)
+	assert.Equal(t, "event: node.boot-loop", lines[5])
+	assert.Contains(t, lines[6], `"mac":"00:25:90:c0:f7:80"`)
+
+	resp, e = http.Get(s.URL + "?since=x")
+	assert.Nil(t, e)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
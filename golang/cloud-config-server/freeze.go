@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/topicai/candy"
+)
+
+// freeze describes a change freeze, why and until when.
+type freeze struct {
+	Reason string
+	Until  time.Time
+	Author string `json:",omitempty"`
+}
+
+// changeFreeze refuses changes, that is edits of cluster-desc and
+// templates and releases of nodes from boot loops, while an admin has
+// frozen them with PUT /freeze, until the freeze expires or is lifted
+// with DELETE /freeze.  The freeze is kept in file, unless it is
+// empty, so it survives restarts.
+type changeFreeze struct {
+	file string
+	now  func() time.Time
+
+	mu     sync.Mutex
+	frozen *freeze
+}
+
+func newChangeFreeze(file string) (*changeFreeze, error) {
+	f := &changeFreeze{file: file, now: time.Now}
+	if len(file) == 0 {
+		return f, nil
+	}
+	b, e := ioutil.ReadFile(file)
+	if os.IsNotExist(e) {
+		return f, nil
+	} else if e != nil {
+		return nil, e
+	}
+	f.frozen = &freeze{}
+	if e := json.Unmarshal(b, f.frozen); e != nil {
+		return nil, fmt.Errorf("%s: %v", file, e)
+	}
+	return f, nil
+}
+
+// current returns the freeze in effect, or nil.
+func (f *changeFreeze) current() *freeze {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frozen == nil || !f.now().Before(f.frozen.Until) {
+		return nil
+	}
+	z := *f.frozen
+	return &z
+}
+
+// set replaces the freeze with z, or lifts it if z is nil.
+func (f *changeFreeze) set(z *freeze) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.file) > 0 {
+		if z == nil {
+			if e := os.Remove(f.file); e != nil && !os.IsNotExist(e) {
+				return e
+			}
+		} else {
+			b, e := json.Marshal(z)
+			candy.Must(e)
+			tmp := f.file + ".saving"
+			if e := ioutil.WriteFile(tmp, b, 0644); e != nil {
+				return e
+			}
+			if e := os.Rename(tmp, f.file); e != nil {
+				return e
+			}
+		}
+	}
+	f.frozen = z
+	return nil
+}
+
+// guard refuses requests to h other than GET and HEAD while changes
+// are frozen.
+func (f *changeFreeze) guard(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			if z := f.current(); z != nil {
+				glog.Warningf("Refused %s %s from %s: changes are frozen until %s", r.Method, r.URL.Path, r.RemoteAddr, z.Until)
+				http.Error(w, fmt.Sprintf("Changes are frozen until %s: %s", z.Until.Format(time.RFC3339), z.Reason), http.StatusLocked)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// handler serves the freeze in effect in JSON on GET, freezes changes
+// on PUT with a JSON body like {"Reason": "...", "Until":
+// "2017-12-24T00:00:00Z"}, and lifts the freeze on DELETE.  Serve it
+// behind adminAuth.guard, which authenticates the author.
+func (f *changeFreeze) handler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		author := authorOf(r)
+		switch r.Method {
+		case "PUT":
+			z := &freeze{}
+			if e := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEditSize)).Decode(z); e != nil {
+				http.Error(w, e.Error(), http.StatusBadRequest)
+				return
+			}
+			if e := checkFreeze(z, f.now()); e != nil {
+				http.Error(w, e.Error(), http.StatusBadRequest)
+				return
+			}
+			z.Author = author
+			candy.Must(f.set(z))
+			glog.Infof("%s froze changes until %s: %s", author, z.Until, z.Reason)
+			events.publish("config.frozen", "", *z)
+		case "DELETE":
+			if f.current() == nil {
+				http.Error(w, "Changes are not frozen", http.StatusNotFound)
+				return
+			}
+			candy.Must(f.set(nil))
+			glog.Infof("%s lifted the change freeze", author)
+			events.publish("config.unfrozen", "", map[string]string{"author": author})
+			return
+		}
+
+		z := f.current()
+		if z == nil {
+			http.Error(w, "Changes are not frozen", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(z))
+	})
+}
+
+func checkFreeze(z *freeze, now time.Time) error {
+	if len(z.Reason) == 0 {
+		return errors.New("a freeze needs a Reason")
+	}
+	if !z.Until.After(now) {
+		return errors.New("a freeze needs an Until in the future")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestChangeFreeze(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "freeze.json")
+
+	now := time.Date(2017, 12, 20, 0, 0, 0, 0, time.UTC)
+	f, e := newChangeFreeze(file)
+	candy.Must(e)
+	f.now = func() time.Time { return now }
+
+	tokens := path.Join(dir, "admin-tokens")
+	candy.Must(ioutil.WriteFile(tokens, []byte("s3cret alice\n"), 0600))
+	admin := newAdminAuth(tokens)
+
+	edits := 0
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/freeze", admin.guard(f.handler()))
+	router.HandleFunc("/cluster-desc", f.guard(func(w http.ResponseWriter, r *http.Request) { edits++ }))
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/freeze", "").Code)
+	do("PUT", "/cluster-desc", "")
+	assert.Equal(t, 1, edits)
+
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/freeze", `{"Until": "2017-12-27T00:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/freeze", `{"Reason": "holidays", "Until": "2017-12-01T00:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, do("PUT", "/freeze", `{"Reason": "holidays", "Until": "2017-12-27T00:00:00Z"}`).Code)
+	assert.Contains(t, do("GET", "/freeze", "").Body.String(), `"Author":"alice"`)
+
+	rr := do("PUT", "/cluster-desc", "")
+	assert.Equal(t, http.StatusLocked, rr.Code)
+	assert.Contains(t, rr.Body.String(), "holidays")
+	do("GET", "/cluster-desc", "")
+	assert.Equal(t, 2, edits)
+
+	// The freeze survives restarts.
+	g, e := newChangeFreeze(file)
+	candy.Must(e)
+	g.now = f.now
+	if z := g.current(); assert.NotNil(t, z) {
+		assert.Equal(t, "holidays", z.Reason)
+	}
+
+	// It expires by itself, or is lifted.
+	now = now.Add(7 * 24 * time.Hour)
+	do("PUT", "/cluster-desc", "")
+	assert.Equal(t, 3, edits)
+	now = now.Add(-7 * 24 * time.Hour)
+	rr = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/freeze", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.NotNil(t, f.current())
+	assert.Equal(t, http.StatusOK, do("DELETE", "/freeze", "").Code)
+	do("PUT", "/cluster-desc", "")
+	assert.Equal(t, 4, edits)
+	_, e = os.Stat(file)
+	assert.True(t, os.IsNotExist(e))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// unlistedWorkers stands for the nodes not enlisted in cluster-desc.
+const unlistedWorkers = "workers"
+
+type graphVertex struct {
+	ID       string   `json:"id"`
+	Roles    []string `json:"roles"`
+	Reported bool     `json:"reported"`          // Uploaded a first-boot report.
+	Missing  bool     `json:"missing,omitempty"` // An artifact not in the static dir.
+}
+
+type graphEdge struct {
+	From string `json:"from"` // From waits for To.
+	To   string `json:"to"`
+}
+
+type provisionGraph struct {
+	Vertices []graphVertex `json:"vertices"`
+	Edges    []graphEdge   `json:"edges"`
+}
+
+func nodeRoles(n clusterdesc.Node) []string {
+	roles := []string{}
+	for _, r := range []struct {
+		is   bool
+		name string
+	}{{n.EtcdMember, "etcd"}, {n.KubeMaster, "master"}, {n.CephMonitor, "ceph-monitor"}, {n.IngressLabel, "ingress"}} {
+		if r.is {
+			roles = append(roles, r.name)
+		}
+	}
+	if !n.KubeMaster && !n.EtcdMember {
+		roles = append(roles, "worker")
+	}
+	return roles
+}
+
+// profileOf returns the name of the profile the nodes of c are
+// rendered from.
+func profileOf(c *clusterdesc.Cluster) string {
+	if c.OSName == "CentOS" {
+		return "centos"
+	}
+	return "coreos"
+}
+
+// kubeletOf is the vertex of the worker kubelet of an etcd member that
+// is no master.  The kubelet waits for the masters, which wait for the
+// etcd member, so the node itself can't wait for the masters.
+func kubeletOf(hostname string) string {
+	return hostname + "/kubelet"
+}
+
+// buildGraph computes what nodes wait for during bring-up: Kubernetes
+// masters need the etcd members, and workers, including those not
+// enlisted and the kubelets of etcd members, need the masters.  Nodes
+// also need the profile they are rendered from, which needs the
+// artifacts listed in artifacts; those not in staticDir are Missing.
+// Quarantined nodes wait for nothing and nothing waits for them.  It
+// returns an error if anything waits for itself.
+func buildGraph(c *clusterdesc.Cluster, reportDir, staticDir string, artifacts []string) (provisionGraph, error) {
+	g := provisionGraph{Vertices: []graphVertex{}, Edges: []graphEdge{}}
+	var etcd, masters, workers, nodes []string
+	for _, n := range c.Nodes {
+		if n.Quarantined() {
+			continue
+		}
+		_, err := os.Stat(path.Join(reportDir, n.Hostname(), firstBootReportFile))
+		g.Vertices = append(g.Vertices, graphVertex{ID: n.Hostname(), Roles: nodeRoles(n), Reported: err == nil})
+		nodes = append(nodes, n.Hostname())
+		switch {
+		case n.KubeMaster:
+			masters = append(masters, n.Hostname())
+		case n.EtcdMember:
+			g.Vertices = append(g.Vertices, graphVertex{ID: kubeletOf(n.Hostname()), Roles: []string{"worker"}})
+			g.Edges = append(g.Edges, graphEdge{From: kubeletOf(n.Hostname()), To: n.Hostname()})
+			workers = append(workers, kubeletOf(n.Hostname()))
+		default:
+			workers = append(workers, n.Hostname())
+		}
+		if n.EtcdMember {
+			etcd = append(etcd, n.Hostname())
+		}
+	}
+	g.Vertices = append(g.Vertices, graphVertex{ID: unlistedWorkers, Roles: []string{"worker"}})
+	workers = append(workers, unlistedWorkers)
+	nodes = append(nodes, unlistedWorkers)
+
+	for _, m := range masters {
+		for _, e := range etcd {
+			if e != m {
+				g.Edges = append(g.Edges, graphEdge{From: m, To: e})
+			}
+		}
+	}
+	for _, w := range workers {
+		for _, m := range masters {
+			g.Edges = append(g.Edges, graphEdge{From: w, To: m})
+		}
+	}
+
+	profile := "profile/" + profileOf(c)
+	g.Vertices = append(g.Vertices, graphVertex{ID: profile, Roles: []string{"profile"}})
+	for _, n := range nodes {
+		g.Edges = append(g.Edges, graphEdge{From: n, To: profile})
+	}
+	for _, a := range artifacts {
+		_, err := os.Stat(path.Join(staticDir, a))
+		g.Vertices = append(g.Vertices, graphVertex{ID: "static/" + a, Roles: []string{"artifact"}, Missing: err != nil})
+		g.Edges = append(g.Edges, graphEdge{From: profile, To: "static/" + a})
+	}
+
+	if cycle := findCycle(g.Edges); len(cycle) > 0 {
+		return g, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return g, nil
+}
+
+// findCycle returns the vertices of a cycle in edges, the first one
+// repeated at the end, or nil if there is none.
+func findCycle(edges []graphEdge) []string {
+	next := make(map[string][]string)
+	for _, e := range edges {
+		next[e.From] = append(next[e.From], e.To)
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var stack []string
+	var visit func(v string) []string
+	visit = func(v string) []string {
+		state[v] = visiting
+		stack = append(stack, v)
+		for _, w := range next[v] {
+			switch state[w] {
+			case visiting:
+				for i := range stack {
+					if stack[i] == w {
+						return append(append([]string{}, stack[i:]...), w)
+					}
+				}
+			case 0:
+				if c := visit(w); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[v] = done
+		return nil
+	}
+	for _, e := range edges {
+		if state[e.From] == 0 {
+			if c := visit(e.From); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// profileArtifacts returns the artifacts under /static/ that the
+// renders for the nodes in c fetch, sorted.
+func profileArtifacts(c *clusterdesc.Cluster, ccTemplateDir, clusterDescFile string) []string {
+	static := regexp.MustCompile(regexp.QuoteMeta(c.BootstrapperURL()+"/static/") + `([^\s'"|]+)`)
+	templates := []string{"cc-template"}
+	if c.OSName == "CentOS" {
+		templates = append(templates, "centos-post-script")
+	}
+	seen := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if n.Quarantined() {
+			continue
+		}
+		for _, name := range templates {
+			var out bytes.Buffer
+			if err := cctemplate.ExecuteDebug(&out, n.Mac(), name, ccTemplateDir, clusterDescFile, false); err != nil {
+				glog.Warningf("Cannot render %s for %s to list its artifacts: %v", name, n.Mac(), err)
+				continue
+			}
+			for _, m := range static.FindAllStringSubmatch(out.String(), -1) {
+				seen[strings.TrimSuffix(m[1], "/")] = true
+			}
+		}
+	}
+	var artifacts []string
+	for a := range seen {
+		artifacts = append(artifacts, a)
+	}
+	sort.Strings(artifacts)
+	return artifacts
+}
+
+// makeGraphHandler generates a HTTP handler, which serves the bring-up
+// dependency graph in JSON, or in DOT with ?format=dot.
+func makeGraphHandler(clusterDescFile, ccTemplateDir, reportDir, staticDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cctemplate.LoadClusterDesc(clusterDescFile)
+		candy.Must(err)
+		g, err := buildGraph(c, reportDir, staticDir, profileArtifacts(c, ccTemplateDir, clusterDescFile))
+		candy.Must(err)
+
+		if r.URL.Query().Get("format") != "dot" {
+			w.Header().Set("Content-Type", "application/json")
+			candy.Must(json.NewEncoder(w).Encode(g))
+			return
+		}
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		fmt.Fprintln(w, "digraph sextant {")
+		for _, v := range g.Vertices {
+			style := ""
+			if v.Reported {
+				style = ", style=filled, fillcolor=palegreen"
+			} else if v.Missing {
+				style = ", style=filled, fillcolor=salmon"
+			}
+			fmt.Fprintf(w, "  %q [label=%q%s];\n", v.ID, fmt.Sprintf("%s\n%v", v.ID, v.Roles), style)
+		}
+		for _, e := range g.Edges {
+			fmt.Fprintf(w, "  %q -> %q;\n", e.From, e.To)
+		}
+		fmt.Fprintln(w, "}")
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBuildGraph(t *testing.T) {
+	reportDir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(reportDir)
+	candy.Must(os.MkdirAll(path.Join(reportDir, "00-00-00-00-00-01"), 0755))
+	candy.Must(ioutil.WriteFile(path.Join(reportDir, "00-00-00-00-00-01", firstBootReportFile), nil, 0644))
+
+	c := &clusterdesc.Cluster{Nodes: []clusterdesc.Node{
+		{MAC: "00:00:00:00:00:01", EtcdMember: true},
+		{MAC: "00:00:00:00:00:02", EtcdMember: true, KubeMaster: true},
+		{MAC: "00:00:00:00:00:03", IngressLabel: true},
+		{MAC: "00:00:00:00:00:04", Quarantine: "burn-in"},
+	}}
+	staticDir := path.Join(reportDir, "static")
+	candy.Must(os.MkdirAll(staticDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(staticDir, "kubelet"), nil, 0644))
+	g, e := buildGraph(c, reportDir, staticDir, []string{"kubelet", "setup-network-environment-1.0.1"})
+	assert.Nil(t, e)
+
+	assert.Equal(t, []graphVertex{
+		{ID: "00-00-00-00-00-01", Roles: []string{"etcd"}, Reported: true},
+		{ID: "00-00-00-00-00-01/kubelet", Roles: []string{"worker"}},
+		{ID: "00-00-00-00-00-02", Roles: []string{"etcd", "master"}},
+		{ID: "00-00-00-00-00-03", Roles: []string{"ingress", "worker"}},
+		{ID: unlistedWorkers, Roles: []string{"worker"}},
+		{ID: "profile/coreos", Roles: []string{"profile"}},
+		{ID: "static/kubelet", Roles: []string{"artifact"}},
+		{ID: "static/setup-network-environment-1.0.1", Roles: []string{"artifact"}, Missing: true},
+	}, g.Vertices)
+	// The etcd member that is no master waits for nothing; its
+	// kubelet waits for it and for the master, which waits for it.
+	assert.Equal(t, []graphEdge{
+		{From: "00-00-00-00-00-01/kubelet", To: "00-00-00-00-00-01"},
+		{From: "00-00-00-00-00-02", To: "00-00-00-00-00-01"},
+		{From: "00-00-00-00-00-01/kubelet", To: "00-00-00-00-00-02"},
+		{From: "00-00-00-00-00-03", To: "00-00-00-00-00-02"},
+		{From: unlistedWorkers, To: "00-00-00-00-00-02"},
+		{From: "00-00-00-00-00-01", To: "profile/coreos"},
+		{From: "00-00-00-00-00-02", To: "profile/coreos"},
+		{From: "00-00-00-00-00-03", To: "profile/coreos"},
+		{From: unlistedWorkers, To: "profile/coreos"},
+		{From: "profile/coreos", To: "static/kubelet"},
+		{From: "profile/coreos", To: "static/setup-network-environment-1.0.1"},
+	}, g.Edges)
+}
+
+func TestFindCycle(t *testing.T) {
+	assert.Nil(t, findCycle([]graphEdge{{"a", "b"}, {"b", "c"}, {"a", "c"}}))
+	assert.Equal(t, []string{"b", "c", "b"}, findCycle([]graphEdge{{"a", "b"}, {"b", "c"}, {"c", "b"}}))
+}
+
+func TestProfileArtifacts(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "cc.template"), []byte(`{{ define "cc-template" }}
+wget {{ .BootstrapperURL }}/static/kubelet
+wget -r {{ .BootstrapperURL }}/static/gpu-drivers/coreos/{{ .CoreOSVersion }}/
+{{ end }}`), 0644))
+	desc := path.Join(dir, "cluster-desc.yml")
+	c := &clusterdesc.Cluster{Bootstrapper: "10.0.0.1", CoreOSVersion: "1235.6.0", Nodes: []clusterdesc.Node{{MAC: "00:00:00:00:00:01"}}}
+	b, e := yaml.Marshal(c)
+	candy.Must(e)
+	candy.Must(ioutil.WriteFile(desc, b, 0644))
+	assert.Equal(t, []string{"gpu-drivers/coreos/1235.6.0", "kubelet"}, profileArtifacts(c, dir, desc))
+}
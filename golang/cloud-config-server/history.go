@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// editHistory keeps the last keep versions of each file edited via
+// makeEditHandler under dir/<parent dir>/<file name>/, named
+// <time>-<sha256 prefix>, where time is when the version was last
+// saved, with a symlink current to the version in use.  So an edit can
+// be rolled back, see makeEditHandler, and what was served at a given
+// time can be compared after an incident.  A nil editHistory keeps
+// nothing.
+type editHistory struct {
+	dir  string
+	keep int
+}
+
+func newEditHistory(dir string, keep int) *editHistory {
+	if len(dir) == 0 || keep <= 0 {
+		return nil
+	}
+	return &editHistory{dir: dir, keep: keep}
+}
+
+const historyTimeFormat = "20060102T150405.000000000"
+
+// historyVersion describes a version of an edited file.
+type historyVersion struct {
+	Version string    // The sha256 prefix of the content.
+	Saved   time.Time // When the version was last saved.
+	Current bool      // The version in use.
+}
+
+func (h *editHistory) dirOf(fn string) string {
+	return path.Join(h.dir, path.Base(path.Dir(fn)), path.Base(fn))
+}
+
+// save records content as the current version of fn.
+func (h *editHistory) save(fn string, content []byte) error {
+	if h == nil {
+		return nil
+	}
+	dir := h.dirOf(fn)
+	if e := os.MkdirAll(dir, 0700); e != nil {
+		return e
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(content))[:12]
+
+	versions, e := h.versions(dir)
+	if e != nil {
+		return e
+	}
+	// A version saved again, like one rolled back to, is renamed as
+	// the latest, so versions are ordered by when they were last
+	// saved and the one in use is pruned last.
+	name := time.Now().UTC().Format(historyTimeFormat) + "-" + sum
+	old := ""
+	for i, v := range versions {
+		if strings.HasSuffix(v, "-"+sum) {
+			old = v
+			versions = append(versions[:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(old) > 0 {
+		e = os.Rename(path.Join(dir, old), path.Join(dir, name))
+	} else {
+		e = ioutil.WriteFile(path.Join(dir, name), content, 0600)
+	}
+	if e != nil {
+		return e
+	}
+	versions = append(versions, name)
+
+	tmp := path.Join(dir, ".current")
+	os.Remove(tmp)
+	if e := os.Symlink(name, tmp); e != nil {
+		return e
+	}
+	if e := os.Rename(tmp, path.Join(dir, "current")); e != nil {
+		return e
+	}
+
+	for len(versions) > h.keep {
+		if versions[0] != name {
+			if e := os.Remove(path.Join(dir, versions[0])); e != nil {
+				return e
+			}
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// versions lists the versions in dir from the oldest on.
+func (h *editHistory) versions(dir string) ([]string, error) {
+	files, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return nil, e
+	}
+	var v []string
+	for _, f := range files {
+		if f.Mode().IsRegular() && !strings.HasPrefix(f.Name(), ".") {
+			v = append(v, f.Name())
+		}
+	}
+	sort.Strings(v)
+	return v, nil
+}
+
+// list returns the versions of fn from the oldest on.
+func (h *editHistory) list(fn string) ([]historyVersion, error) {
+	l := []historyVersion{}
+	if h == nil {
+		return l, nil
+	}
+	dir := h.dirOf(fn)
+	versions, e := h.versions(dir)
+	if os.IsNotExist(e) {
+		return l, nil
+	} else if e != nil {
+		return nil, e
+	}
+	current, _ := os.Readlink(path.Join(dir, "current"))
+	for _, v := range versions {
+		i := strings.LastIndex(v, "-")
+		if i < 0 {
+			continue
+		}
+		saved, _ := time.Parse(historyTimeFormat, v[:i])
+		l = append(l, historyVersion{Version: v[i+1:], Saved: saved, Current: v == current})
+	}
+	return l, nil
+}
+
+// load returns the content of the version of fn, as returned by list.
+func (h *editHistory) load(fn, version string) ([]byte, error) {
+	if h == nil {
+		return nil, errors.New("no history is kept, see -history-dir")
+	}
+	versions, e := h.versions(h.dirOf(fn))
+	if e != nil && !os.IsNotExist(e) {
+		return nil, e
+	}
+	for _, v := range versions {
+		if len(version) > 0 && strings.HasSuffix(v, "-"+version) {
+			return ioutil.ReadFile(path.Join(h.dirOf(fn), v))
+		}
+	}
+	return nil, fmt.Errorf("no version %q of %s", version, path.Base(fn))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestEditHistory(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	h := newEditHistory(dir, 2)
+	fn := "/bsroot/config/cluster-desc.yml"
+	current := func() string {
+		b, e := ioutil.ReadFile(path.Join(dir, "config", "cluster-desc.yml", "current"))
+		candy.Must(e)
+		return string(b)
+	}
+
+	assert.Nil(t, h.save(fn, []byte("v1")))
+	assert.Nil(t, h.save(fn, []byte("v2")))
+	assert.Equal(t, "v2", current())
+
+	// Rolling back to v1 reuses its version.
+	assert.Nil(t, h.save(fn, []byte("v1")))
+	assert.Equal(t, "v1", current())
+	v, e := h.versions(path.Join(dir, "config", "cluster-desc.yml"))
+	candy.Must(e)
+	assert.Equal(t, 2, len(v))
+
+	// Only the last 2 versions saved are kept: v2, not v1, which was
+	// saved again after it, is pruned.
+	assert.Nil(t, h.save(fn, []byte("v3")))
+	l, e := h.list(fn)
+	candy.Must(e)
+	assert.Equal(t, 2, len(l))
+	assert.Equal(t, "v3", current())
+	assert.False(t, l[0].Current)
+	assert.True(t, l[1].Current)
+	b, e := h.load(fn, l[0].Version)
+	candy.Must(e)
+	assert.Equal(t, "v1", string(b))
+	_, e = h.load(fn, "")
+	assert.NotNil(t, e)
+
+	assert.Nil(t, newEditHistory("", 10).save(fn, []byte("v4")))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/topicai/candy"
+)
+
+// legacyPaths are the paths nodes installed by earlier sextant fetch
+// their cloud-configs from, as http://<addr:port>/?mac=<mac>, and the
+// path in the current API replacing them.
+var legacyPaths = map[string]string{
+	"/":             "/cloud-config/",
+	"/cloud-config": "/cloud-config/",
+}
+
+// legacyNode is the use of legacy and current endpoints by a node.
+type legacyNode struct {
+	MAC         string
+	Legacy      int
+	Current     int
+	LastLegacy  time.Time
+	LastCurrent time.Time
+	Migrated    bool // The last fetch was from the current API.
+}
+
+// legacyReport is the cutover report returned by /legacy-usage.
+type legacyReport struct {
+	Serving   bool           // Whether legacy endpoints are still served.
+	Endpoints map[string]int // Requests by endpoint, legacy ones with ?mac=.
+	Nodes     []legacyNode
+	Remaining int  // Nodes whose last fetch was from a legacy endpoint.
+	Ready     bool // No node fetched from legacy endpoints last.
+}
+
+// legacyCompat serves the legacy endpoints alongside the current API,
+// so large deployments reinstall nodes with the current layout one by
+// one instead of all at once.  A legacy request is rewritten to the
+// current path before anything else sees it, so it is rendered,
+// logged, guarded and traced like any other.  Requests are counted by
+// endpoint and by node, and /legacy-usage tells which nodes still
+// fetch from legacy endpoints, so operators know when to turn them off
+// with -legacy-endpoints=false.  Counts are kept in memory only.
+type legacyCompat struct {
+	serving bool
+	now     func() time.Time
+
+	mu        sync.Mutex
+	endpoints map[string]int
+	nodes     map[string]*legacyNode
+}
+
+func newLegacyCompat(serving bool) *legacyCompat {
+	return &legacyCompat{
+		serving:   serving,
+		now:       time.Now,
+		endpoints: make(map[string]int),
+		nodes:     make(map[string]*legacyNode),
+	}
+}
+
+// middleware rewrites legacy requests to the current API, or refuses
+// them with 410 Gone once legacy endpoints are no longer served, and
+// counts the requests for cloud-configs.
+func (l *legacyCompat) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, ok := legacyPaths[r.URL.Path]
+		m := r.URL.Query().Get("mac")
+		if !ok || len(m) == 0 {
+			if mac := macInPath(r.URL.Path); len(mac) > 0 && strings.HasPrefix(r.URL.Path, "/cloud-config/") {
+				l.observe("/cloud-config/{mac}", mac, false)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		hwAddr, err := net.ParseMAC(m)
+		if err != nil {
+			http.Error(w, "invalid MAC address "+m, http.StatusBadRequest)
+			return
+		}
+		endpoint := r.URL.Path + "?mac="
+		l.observe(endpoint, hwAddr.String(), true)
+		if !l.serving {
+			http.Error(w, "legacy endpoint "+endpoint+" is no longer served; fetch "+current+hwAddr.String(), http.StatusGone)
+			return
+		}
+
+		u := *r.URL
+		u.Path = current + hwAddr.String()
+		u.RawPath = ""
+		u.RawQuery = ""
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = &u
+		r2.RequestURI = u.RequestURI()
+		next.ServeHTTP(w, r2)
+	})
+}
+
+func (l *legacyCompat) observe(endpoint, mac string, legacy bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.endpoints[endpoint]++
+	n, ok := l.nodes[mac]
+	if !ok {
+		n = &legacyNode{MAC: mac}
+		l.nodes[mac] = n
+	}
+	now := l.now().UTC()
+	if legacy {
+		n.Legacy++
+		n.LastLegacy = now
+	} else {
+		n.Current++
+		n.LastCurrent = now
+	}
+	if n.Migrated == legacy {
+		n.Migrated = !legacy
+		if n.Migrated && n.Legacy > 0 {
+			events.publish("node.legacy-migrated", mac, nil)
+		}
+	}
+}
+
+// report returns the cutover report.
+func (l *legacyCompat) report() legacyReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rp := legacyReport{Serving: l.serving, Endpoints: make(map[string]int), Nodes: []legacyNode{}}
+	for e, n := range l.endpoints {
+		rp.Endpoints[e] = n
+	}
+	for _, n := range l.nodes {
+		rp.Nodes = append(rp.Nodes, *n)
+		if !n.Migrated {
+			rp.Remaining++
+		}
+	}
+	sort.Slice(rp.Nodes, func(i, j int) bool { return rp.Nodes[i].MAC < rp.Nodes[j].MAC })
+	rp.Ready = rp.Remaining == 0
+	return rp
+}
+
+// reportHandler returns the cutover report in JSON.
+func (l *legacyCompat) reportHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		candy.Must(enc.Encode(l.report()))
+	})
+}
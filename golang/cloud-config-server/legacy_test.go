@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLegacyCompat(t *testing.T) {
+	var paths []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	})
+	l := newLegacyCompat(true)
+	h := l.middleware(next)
+	for _, u := range []string{
+		"/?mac=00:25:90:C0:F7:80",
+		"/cloud-config?mac=00:25:90:c0:f7:81",
+		"/cloud-config/00:25:90:c0:f7:80",
+		"/cloud-config/00:25:90:c0:f7:82",
+		"/status",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", u, nil))
+	}
+	assert.Equal(t, []string{
+		"/cloud-config/00:25:90:c0:f7:80",
+		"/cloud-config/00:25:90:c0:f7:81",
+		"/cloud-config/00:25:90:c0:f7:80",
+		"/cloud-config/00:25:90:c0:f7:82",
+		"/status",
+	}, paths)
+
+	rp := l.report()
+	assert.Equal(t, map[string]int{"/?mac=": 1, "/cloud-config?mac=": 1, "/cloud-config/{mac}": 2}, rp.Endpoints)
+	if assert.Equal(t, 3, len(rp.Nodes)) {
+		assert.True(t, rp.Nodes[0].Migrated)
+		assert.Equal(t, 1, rp.Nodes[0].Legacy)
+		assert.False(t, rp.Nodes[1].Migrated)
+	}
+	assert.Equal(t, 1, rp.Remaining)
+	assert.False(t, rp.Ready)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?mac=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Once turned off, legacy endpoints point nodes to the current API.
+	l.serving = false
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?mac=00:25:90:c0:f7:81", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "/cloud-config/00:25:90:c0:f7:81")
+	assert.Equal(t, 5, len(paths))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const unixAddrPrefix = "unix:"
+
+// listen announces on addr, which is either a TCP address like
+// ":8080", or the path of a Unix domain socket prefixed by "unix:",
+// like "unix:/run/cloud-config-server.sock".  The latter is for
+// deployments fronting the server with a local reverse proxy, and
+// logs the credentials of every connecting peer.
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixAddrPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	sock := strings.TrimPrefix(addr, unixAddrPrefix)
+	// Remove the socket left by a previous run, or Listen fails, but
+	// nothing else that happens to be at sock.
+	if fi, e := os.Lstat(sock); e == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", sock)
+		}
+		if e := os.Remove(sock); e != nil {
+			return nil, e
+		}
+	} else if !os.IsNotExist(e) {
+		return nil, e
+	}
+
+	// Create the socket in a private directory, so nobody connects
+	// before only the owner and group, e.g., nginx, may, then move it
+	// in place.
+	dir, e := ioutil.TempDir(filepath.Dir(sock), ".sock")
+	if e != nil {
+		return nil, e
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	l, e := net.Listen("unix", tmp)
+	if e != nil {
+		return nil, e
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if e := os.Chmod(tmp, 0660); e != nil {
+		l.Close()
+		return nil, e
+	}
+	if e := os.Rename(tmp, sock); e != nil {
+		l.Close()
+		return nil, e
+	}
+	return &peerCredListener{l}, nil
+}
+
+// peerCredListener logs the peer credentials of accepted Unix socket
+// connections.
+type peerCredListener struct {
+	net.Listener
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	c, e := l.Listener.Accept()
+	if e == nil {
+		logPeerCred(c)
+	}
+	return c, e
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	sock := path.Join(dir, "server.sock")
+
+	// A stale socket must not prevent listening.
+	stale, e := net.Listen("unix", sock)
+	candy.Must(e)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	l, e := listen("unix:" + sock)
+	assert.Nil(t, e)
+	defer l.Close()
+
+	fi, e := os.Stat(sock)
+	assert.Nil(t, e)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	resp, e := client.Get("http://unix/")
+	assert.Nil(t, e)
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "ok", string(b))
+}
+
+func TestListenUnixSocketKeepsOtherFiles(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	sock := path.Join(dir, "server.sock")
+
+	candy.Must(ioutil.WriteFile(sock, []byte("data"), 0600))
+	_, e = listen("unix:" + sock)
+	assert.NotNil(t, e)
+	b, e := ioutil.ReadFile(sock)
+	assert.Nil(t, e)
+	assert.Equal(t, "data", string(b))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cctemplate "github.com/k8sp/sextant/golang/template"
+)
+
+const maxLoggedError = 512
+
+// logEvent describes a request served, as streamed by /logs/stream.
+type logEvent struct {
+	Time       time.Time `json:"time"`
+	MAC        string    `json:"mac,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// logHub fans out the requests served to the subscribers of
+// /logs/stream, so an engineer watching a node boot can follow the
+// node's fetches, and their errors, on the server side.
+type logHub struct {
+	mu   sync.Mutex
+	subs map[chan logEvent]string // To the MAC subscribed, or "" for all.
+}
+
+func newLogHub() *logHub {
+	return &logHub{subs: make(map[chan logEvent]string)}
+}
+
+func (h *logHub) publish(e logEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c, mac := range h.subs {
+		if len(mac) > 0 && mac != e.MAC {
+			continue
+		}
+		select {
+		case c <- e:
+		default: // Drop events for slow subscribers.
+		}
+	}
+}
+
+func (h *logHub) subscribe(mac string) chan logEvent {
+	c := make(chan logEvent, 64)
+	h.mu.Lock()
+	h.subs[c] = mac
+	h.mu.Unlock()
+	return c
+}
+
+func (h *logHub) unsubscribe(c chan logEvent) {
+	h.mu.Lock()
+	delete(h.subs, c)
+	h.mu.Unlock()
+}
+
+// macInPath returns the first MAC address in the path segments of a
+// URL, like /cloud-config/<mac>, or "".
+func macInPath(p string) string {
+	for _, s := range strings.Split(p, "/") {
+		if hwAddr, err := net.ParseMAC(s); err == nil {
+			return hwAddr.String()
+		}
+	}
+	return ""
+}
+
+// middleware publishes every request served by next.
+func (h *logHub) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		e := logEvent{
+			Time:       time.Now(),
+			MAC:        macInPath(r.URL.Path),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			Status:     sw.status,
+		}
+		if sw.status >= 400 {
+			e.Error = cctemplate.RedactText(strings.TrimSpace(sw.body.String()))
+		}
+		h.publish(e)
+	})
+}
+
+// streamHandler streams the requests of the node given by ?mac=, or of
+// all nodes, as server-sent events.
+func (h *logHub) streamHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mac := ""
+		if m := r.URL.Query().Get("mac"); len(m) > 0 {
+			hwAddr, err := net.ParseMAC(m)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mac = hwAddr.String()
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		c := h.subscribe(mac)
+		defer h.unsubscribe(c)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e := <-c:
+				b, _ := json.Marshal(e)
+				fmt.Fprintf(w, "data: %s\n\n", b)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// statusWriter records the status and size of a response, and the
+// beginning of its body if it is an error.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	body   bytes.Buffer
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status >= 400 && w.body.Len() < maxLoggedError {
+		n := maxLoggedError - w.body.Len()
+		if n > len(b) {
+			n = len(b)
+		}
+		w.body.Write(b[:n])
+	}
+	n, e := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, e
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
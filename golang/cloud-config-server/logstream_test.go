@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogStream(t *testing.T) {
+	hub := newLogHub()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs/stream", hub.streamHandler())
+	mux.HandleFunc("/cloud-config/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "81") {
+			http.Error(w, "template: no such node", http.StatusInternalServerError)
+		}
+	})
+	s := httptest.NewServer(hub.middleware(mux))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", s.URL+"/logs/stream?mac=00-25-90-C0-F7-81", nil)
+	resp, e := http.DefaultClient.Do(req.WithContext(ctx))
+	assert.Nil(t, e)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	http.Get(s.URL + "/cloud-config/00:25:90:c0:f7:80")
+	http.Get(s.URL + "/cloud-config/00:25:90:c0:f7:81")
+
+	line, e := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, e)
+	assert.Contains(t, line, `"mac":"00:25:90:c0:f7:81"`)
+	assert.Contains(t, line, `"status":500`)
+	assert.Contains(t, line, `"error":"template: no such node"`)
+}
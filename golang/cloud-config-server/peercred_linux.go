@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+func logPeerCred(c net.Conn) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return
+	}
+	raw, e := uc.SyscallConn()
+	if e != nil {
+		glog.Warningf("Cannot get peer credentials: %v", e)
+		return
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	e = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if e != nil || credErr != nil {
+		glog.Warningf("Cannot get peer credentials: %v %v", e, credErr)
+		return
+	}
+	glog.Infof("Accepted Unix socket connection from pid=%d uid=%d gid=%d", cred.Pid, cred.Uid, cred.Gid)
+}
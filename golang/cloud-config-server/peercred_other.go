@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "net"
+
+// logPeerCred is a no-op, as SO_PEERCRED is specific to Linux.
+func logPeerCred(c net.Conn) {}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+const provenanceFile = "provenance.json"
+
+// isPreflight tells whether r asks for a cloud-config with ?preflight
+// only to check that it renders, like push-install does, so the fetch
+// isn't taken for that of the node: no provenance, render record or
+// event is saved, and boot loops don't count it.
+func isPreflight(r *http.Request) bool {
+	_, ok := r.URL.Query()["preflight"]
+	return ok
+}
+
+// saveProvenance keeps p, the provenance of the latest cloud-config
+// served to hwAddr, next to its reports.
+func saveProvenance(reportDir string, hwAddr net.HardwareAddr, p *cctemplate.Provenance) error {
+	dir := nodeReportDir(reportDir, hwAddr)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	fn := path.Join(dir, provenanceFile)
+	if err := ioutil.WriteFile(fn+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// provenanceStatus is the response of /nodes/<mac>/provenance.  A
+// node is Stale if cluster-desc or the templates were edited after
+// it was provisioned.
+type provenanceStatus struct {
+	Provisioned          *cctemplate.Provenance
+	CurrentConfigVersion string
+	Stale                bool
+}
+
+// makeProvenanceHandler generates a HTTP handler, which returns in
+// JSON the provenance of the latest cloud-config served to a node,
+// as rendered into its /etc/motd, and whether it is still current.
+func makeProvenanceHandler(reportDir, ccTemplateDir, clusterDescFile string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		candy.Must(err)
+		b, err := ioutil.ReadFile(path.Join(nodeReportDir(reportDir, hwAddr), provenanceFile))
+		if os.IsNotExist(err) {
+			http.Error(w, "No cloud-config has been served to "+hwAddr.String(), http.StatusNotFound)
+			return
+		}
+		candy.Must(err)
+
+		var s provenanceStatus
+		candy.Must(json.Unmarshal(b, &s.Provisioned))
+		s.CurrentConfigVersion, err = cctemplate.ConfigVersion(ccTemplateDir, clusterDescFile)
+		candy.Must(err)
+		s.Stale = s.Provisioned.ConfigVersion != s.CurrentConfigVersion
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		candy.Must(enc.Encode(s))
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestProvenanceHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	reportDir := path.Join(dir, "reports")
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	b := []byte(`{"bootstrapper": "10.10.14.253", "dockerdomain": "bootstrapper", "nodes": [{"mac": "00:25:90:c0:f7:80"}]}`)
+	candy.Must(ioutil.WriteFile(clusterDescFile, b, 0644))
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", makeCloudConfigHandler(clusterDescFile, templateDir, "", "", reportDir))
+	router.HandleFunc("/nodes/{mac}/provenance", makeProvenanceHandler(reportDir, templateDir, clusterDescFile))
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("/nodes/00:25:90:c0:f7:80/provenance").Code)
+	// Preflight fetches don't count as provisioning the node.
+	assert.Equal(t, http.StatusOK, get("/cloud-config/00:25:90:c0:f7:80?preflight").Code)
+	assert.Equal(t, http.StatusNotFound, get("/nodes/00:25:90:c0:f7:80/provenance").Code)
+
+	cc := get("/cloud-config/00:25:90:c0:f7:80")
+	assert.Equal(t, http.StatusOK, cc.Code, cc.Body.String())
+
+	rr := get("/nodes/00-25-90-c0-f7-80/provenance")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var s provenanceStatus
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &s))
+	assert.Equal(t, "00:25:90:c0:f7:80", s.Provisioned.MAC)
+	assert.Equal(t, "kube-worker", s.Provisioned.Role)
+	assert.Equal(t, "http://10.10.14.253", s.Provisioned.Server)
+	assert.False(t, s.Stale)
+	assert.Contains(t, cc.Body.String(), "Config version: "+s.Provisioned.ConfigVersion)
+
+	candy.Must(ioutil.WriteFile(clusterDescFile, []byte(`{"bootstrapper": "10.10.14.254"}`), 0644))
+	assert.Nil(t, json.Unmarshal(get("/nodes/00:25:90:c0:f7:80/provenance").Body.Bytes(), &s))
+	assert.True(t, s.Stale)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+)
+
+// mirrorProxy proxies GET requests in the form of
+//
+//	/proxy/<host>/<path>
+//
+// to package mirrors, like yum or apt repos and PyPI, on an
+// allowlist, so nodes without Internet access can install packages
+// through the bootstrapper.  Responses are cached in cacheDir, and
+// revalidated with If-Modified-Since, so repo metadata stays fresh
+// and cached packages are served even if the mirror is unreachable.
+// Responses differing by query string are cached separately.
+// Responses are streamed to the client and the cache, never buffered
+// in memory, and those larger than maxCached are not cached.
+type mirrorProxy struct {
+	upstreams map[string]*url.URL // Allowlisted mirrors by host.
+	cacheDir  string
+	maxCached int64        // Bytes, 0 means no limit.
+	limiter   *rateLimiter // Shared by all reads from mirrors.
+	client    *http.Client
+}
+
+// newMirrorProxy returns a mirrorProxy for the comma separated
+// allowlist of base URLs of mirrors, like
+// http://mirrors.163.com,https://pypi.python.org.
+func newMirrorProxy(allowlist, cacheDir string, maxCached, rate int64) (*mirrorProxy, error) {
+	p := &mirrorProxy{
+		upstreams: make(map[string]*url.URL),
+		cacheDir:  cacheDir,
+		maxCached: maxCached,
+		limiter:   &rateLimiter{rate: rate},
+		client:    &http.Client{Timeout: 30 * time.Minute},
+	}
+	for _, s := range strings.Split(allowlist, ",") {
+		if s = strings.TrimSpace(s); len(s) == 0 {
+			continue
+		}
+		u, e := url.Parse(strings.TrimSuffix(s, "/"))
+		if e != nil {
+			return nil, e
+		}
+		p.upstreams[u.Host] = u
+	}
+	return p, nil
+}
+
+func (p *mirrorProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, rel := mux.Vars(r)["host"], path.Clean("/"+mux.Vars(r)["path"])
+	base, ok := p.upstreams[host]
+	if !ok {
+		glog.Warningf("%s was refused proxying to %s, which is not allowlisted", r.RemoteAddr, host)
+		http.Error(w, host+" is not allowlisted", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "only GET is proxied", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cached := path.Join(p.cacheDir, host, rel)
+	if len(r.URL.RawQuery) > 0 {
+		sum := sha256.Sum256([]byte(r.URL.RawQuery))
+		cached += fmt.Sprintf(".query-%x", sum[:8])
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		// Directory listings are not cached.
+		cached = ""
+	}
+	up := *base
+	up.Path = strings.TrimSuffix(base.Path, "/") + rel
+	if strings.HasSuffix(r.URL.Path, "/") {
+		up.Path += "/"
+	}
+	up.RawQuery = r.URL.RawQuery
+
+	req, e := http.NewRequest("GET", up.String(), nil)
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	fi, statErr := os.Stat(cached)
+	if len(cached) > 0 && statErr == nil {
+		req.Header.Set("If-Modified-Since", fi.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, e := p.client.Do(req)
+	switch {
+	case e != nil && statErr == nil && len(cached) > 0:
+		glog.Warningf("Serving %s from cache to %s, as %s is unreachable: %v", rel, r.RemoteAddr, host, e)
+		http.ServeFile(w, r, cached)
+		return
+	case e != nil:
+		http.Error(w, e.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && statErr == nil {
+		glog.Infof("Proxy %s %s%s: cached", r.RemoteAddr, host, rel)
+		http.ServeFile(w, r, cached)
+		return
+	}
+	glog.Infof("Proxy %s %s%s: %s", r.RemoteAddr, host, rel, resp.Status)
+
+	for _, h := range []string{"Content-Type", "Content-Length", "Last-Modified"} {
+		if v := resp.Header.Get(h); len(v) > 0 {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	body := io.Reader(&throttledReader{r: resp.Body, limiter: p.limiter})
+	if resp.StatusCode != http.StatusOK || len(cached) == 0 {
+		io.Copy(w, body)
+		return
+	}
+	if p.maxCached > 0 && resp.ContentLength > p.maxCached {
+		glog.Infof("Not caching %s%s of %d bytes, over -proxy-cache-max-size", host, rel, resp.ContentLength)
+		io.Copy(w, body)
+		return
+	}
+	p.copyAndCache(w, body, cached, resp.Header.Get("Last-Modified"))
+}
+
+// copyAndCache copies body to w and to the cache file, which is
+// replaced only once the whole body is received, and if it is within
+// maxCached.
+func (p *mirrorProxy) copyAndCache(w io.Writer, body io.Reader, cached, lastModified string) {
+	if e := os.MkdirAll(path.Dir(cached), 0755); e != nil {
+		glog.Errorf("Cannot cache %s: %v", cached, e)
+		io.Copy(w, body)
+		return
+	}
+	f, e := ioutil.TempFile(path.Dir(cached), ".proxy")
+	if e != nil {
+		glog.Errorf("Cannot cache %s: %v", cached, e)
+		io.Copy(w, body)
+		return
+	}
+	defer os.Remove(f.Name())
+	c := &cappedWriter{w: f, max: p.maxCached}
+	_, e = io.Copy(io.MultiWriter(w, c), body)
+	f.Close()
+	if e != nil {
+		return
+	}
+	if c.over {
+		glog.Infof("Not caching %s, over -proxy-cache-max-size", cached)
+		return
+	}
+	if t, e := http.ParseTime(lastModified); e == nil {
+		os.Chtimes(f.Name(), t, t)
+	}
+	if e := os.Rename(f.Name(), cached); e != nil {
+		glog.Errorf("Cannot cache %s: %v", cached, e)
+	}
+}
+
+// cappedWriter writes to w up to max bytes, or without limit if max is
+// 0, and discards the rest, so that a body too large to cache still
+// reaches the client through the io.MultiWriter.
+type cappedWriter struct {
+	w    io.Writer
+	max  int64
+	n    int64
+	over bool
+}
+
+func (c *cappedWriter) Write(b []byte) (int, error) {
+	if c.over {
+		return len(b), nil
+	}
+	if c.max > 0 && c.n+int64(len(b)) > c.max {
+		c.over = true
+		return len(b), nil
+	}
+	n, e := c.w.Write(b)
+	c.n += int64(n)
+	return n, e
+}
+
+// rateLimiter limits the total rate of the reads of all the
+// throttledReaders sharing it to rate bytes per second, or not at all
+// if rate is 0.
+type rateLimiter struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time // When the bytes reserved so far are due.
+}
+
+// wait reserves n bytes and sleeps until they are due.
+func (l *rateLimiter) wait(n int) {
+	if l.rate <= 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	due := l.next
+	l.mu.Unlock()
+	time.Sleep(due.Sub(now))
+}
+
+// throttledReader reads from r within the rate of limiter.
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if rate := t.limiter.rate; rate > 0 && int64(len(b)) > rate {
+		b = b[:rate]
+	}
+	n, e := t.r.Read(b)
+	t.limiter.wait(n)
+	return n, e
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestMirrorProxy(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/centos/7/os/big.rpm" {
+			// Chunked, so the size is known only once streamed.
+			w.Write([]byte(strings.Repeat("x", 16)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("x", 16)))
+			return
+		}
+		if r.URL.Path == "/centos/7/os/mirrorlist" {
+			w.Write([]byte(r.URL.Query().Get("arch")))
+			return
+		}
+		if r.URL.Path != "/centos/7/os/repomd.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		if len(r.Header.Get("If-Modified-Since")) > 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2017 15:04:05 GMT")
+		w.Write([]byte("<repomd/>"))
+	}))
+
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	p, e := newMirrorProxy(upstream.URL+"/centos/", dir, 16, 0)
+	candy.Must(e)
+	host := upstream.URL[len("http://"):]
+
+	router := mux.NewRouter()
+	router.Handle("/proxy/{host}/{path:.*}", p)
+	get := func(url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, get("/proxy/evil.example.com/x").Code)
+
+	rr := get("/proxy/" + host + "/7/os/repomd.xml")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "<repomd/>", rr.Body.String())
+
+	// Revalidated against the mirror and served from cache.
+	rr = get("/proxy/" + host + "/7/os/repomd.xml")
+	assert.Equal(t, "<repomd/>", rr.Body.String())
+	assert.Equal(t, 2, hits)
+
+	// Responses differing by query string are cached separately.
+	assert.Equal(t, "x86_64", get("/proxy/"+host+"/7/os/mirrorlist?arch=x86_64").Body.String())
+	assert.Equal(t, "aarch64", get("/proxy/"+host+"/7/os/mirrorlist?arch=aarch64").Body.String())
+
+	// Files over the cache limit are streamed but not cached.
+	assert.Equal(t, strings.Repeat("x", 32), get("/proxy/"+host+"/7/os/big.rpm").Body.String())
+	_, e = os.Stat(path.Join(dir, host, "7/os/big.rpm"))
+	assert.True(t, os.IsNotExist(e))
+
+	// Served from cache if the mirror is down.
+	upstream.Close()
+	rr = get("/proxy/" + host + "/7/os/repomd.xml")
+	assert.Equal(t, "<repomd/>", rr.Body.String())
+	assert.Equal(t, "x86_64", get("/proxy/"+host+"/7/os/mirrorlist?arch=x86_64").Body.String())
+
+	assert.Equal(t, http.StatusBadGateway, get("/proxy/"+host+"/7/os/other.rpm").Code)
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	// Two streams sharing a limiter of 1000 bytes per second take
+	// about a second to read 500 bytes each.
+	l := &rateLimiter{rate: 1000}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ioutil.ReadAll(&throttledReader{r: strings.NewReader(strings.Repeat("x", 500)), limiter: l})
+		}()
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) > 900*time.Millisecond)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+)
+
+// recordRenders wraps h, which renders templateName for the node
+// given by the route variable {mac}, so that every render is saved
+// as a replayable template.Record under recordDir/<hostname>/, where
+// the last keep records are kept, or all if keep is 0.  An empty
+// recordDir disables recording.
+func recordRenders(recordDir string, keep int, templateName, ccTemplateDir, clusterDescFile string, h http.HandlerFunc) http.HandlerFunc {
+	if len(recordDir) == 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) {
+			h(w, r)
+			return
+		}
+		var out bytes.Buffer
+		h(&teeResponseWriter{ResponseWriter: w, out: &out}, r)
+
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		if err != nil {
+			return
+		}
+		rec, err := cctemplate.NewRecord(hwAddr.String(), templateName, ccTemplateDir, clusterDescFile)
+		if err != nil {
+			glog.Warningf("Cannot record render for %s: %v", hwAddr, err)
+			return
+		}
+		rec.RemoteAddr = r.RemoteAddr
+		rec.URL = r.URL.String()
+		rec.Output = out.String()
+		if err := saveRecord(recordDir, rec); err != nil {
+			glog.Warningf("Cannot save render record for %s: %v", hwAddr, err)
+		}
+		if err := pruneRecords(recordDir, rec.MAC, keep); err != nil {
+			glog.Warningf("Cannot prune render records of %s: %v", hwAddr, err)
+		}
+	}
+}
+
+// saveRecord writes rec in JSON, with secrets redacted.  Records are
+// still readable by the owner only, as they describe the cluster.
+func saveRecord(recordDir string, rec *cctemplate.Record) error {
+	dir := path.Join(recordDir, strings.Replace(rec.MAC, ":", "-", -1))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec.Redact(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fn := path.Join(dir, rec.Time.Format("20060102T150405.000000000")+"-"+rec.TemplateName+".json")
+	return ioutil.WriteFile(fn, b, 0600)
+}
+
+// pruneRecords removes all but the last keep records of mac, as a
+// bootstrapper runs for years and nodes are reprovisioned many times.
+func pruneRecords(recordDir, mac string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(path.Join(recordDir, strings.Replace(mac, ":", "-", -1), "*.json"))
+	if err != nil {
+		return err
+	}
+	// Record file names start with the time, so they sort by age.
+	sort.Strings(files)
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// teeResponseWriter copies the response body to out.
+type teeResponseWriter struct {
+	http.ResponseWriter
+	out io.Writer
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	w.out.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestRecordRenders(t *testing.T) {
+	recordDir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(recordDir)
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cloud-config/{mac}", recordRenders(recordDir, 2, "cc-template", templateDir, clusterDescExampleFile,
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("rendered")) }))
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/cloud-config/00:25:90:c0:f7:80", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, "rendered", rr.Body.String())
+
+	files, _ := filepath.Glob(recordDir + "/00-25-90-c0-f7-80/*.json")
+	assert.Len(t, files, 1)
+	b, e := ioutil.ReadFile(files[0])
+	candy.Must(e)
+	var rec cctemplate.Record
+	candy.Must(json.Unmarshal(b, &rec))
+	assert.Equal(t, "rendered", rec.Output)
+	assert.Equal(t, "cc-template", rec.TemplateName)
+	assert.Contains(t, rec.Templates, "cloud-config.template")
+
+	// Only the last 2 records are kept.
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	files, _ = filepath.Glob(recordDir + "/00-25-90-c0-f7-80/*.json")
+	assert.Len(t, files, 2)
+}
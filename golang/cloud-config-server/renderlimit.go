@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// renderLimiter limits how many renders, each generating keys and
+// certs with openssl, run at once.  The limit adapts to pressure:
+// it halves, down to min, whenever pressure reports the server short
+// of memory or CPU, and grows by one, up to max, otherwise, at most
+// once every interval.  Renders beyond the limit queue for up to
+// timeout, so a whole rack powering on at once is served in turns
+// instead of getting the server OOM-killed.
+type renderLimiter struct {
+	min, max int
+	timeout  time.Duration
+	interval time.Duration
+	pressure func() (bool, string)
+	now      func() time.Time
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	adjusted time.Time
+}
+
+func newRenderLimiter(min, max int, timeout time.Duration, pressure func() (bool, string)) *renderLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	l := &renderLimiter{
+		min:      min,
+		max:      max,
+		timeout:  timeout,
+		interval: time.Second,
+		pressure: pressure,
+		now:      time.Now,
+		limit:    min,
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *renderLimiter) adjustLocked() {
+	if l.now().Sub(l.adjusted) < l.interval {
+		return
+	}
+	l.adjusted = l.now()
+	if under, why := l.pressure(); under {
+		if l.limit > l.min {
+			l.limit = l.limit / 2
+			if l.limit < l.min {
+				l.limit = l.min
+			}
+			glog.Warningf("Limiting concurrent renders to %d: %s", l.limit, why)
+		}
+	} else if l.limit < l.max {
+		l.limit++
+		l.cond.Broadcast()
+	}
+}
+
+// acquire waits until a render may run, and returns false if it
+// waited for timeout in vain.
+func (l *renderLimiter) acquire() bool {
+	deadline := l.now().Add(l.timeout)
+	t := time.AfterFunc(l.timeout, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer t.Stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		l.adjustLocked()
+		if l.active < l.limit {
+			l.active++
+			return true
+		}
+		if !l.now().Before(deadline) {
+			return false
+		}
+		l.cond.Wait()
+	}
+}
+
+func (l *renderLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.adjustLocked()
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+// wrap runs h within the limit, or responds 503, asking the node to
+// retry later, if the render queued for too long.
+func (l *renderLimiter) wrap(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(l.timeout/time.Second)))
+			http.Error(w, "The server is busy rendering for other nodes, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.release()
+		h(w, r)
+	}
+}
+
+// systemPressure returns a pressure function for renderLimiter, which
+// reports pressure if the heap of the server exceeds heapLimit bytes,
+// unless it is 0, if less than a tenth of the memory of the system is
+// available, or if the load average exceeds the number of CPUs.
+func systemPressure(heapLimit uint64) func() (bool, string) {
+	return func() (bool, string) {
+		if heapLimit > 0 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > heapLimit {
+				return true, fmt.Sprintf("heap in use %d exceeds %d bytes", m.HeapInuse, heapLimit)
+			}
+		}
+		if total, available, e := meminfo(); e == nil && total > 0 && available < total/10 {
+			return true, fmt.Sprintf("only %d of %d kB of memory available", available, total)
+		}
+		if b, e := ioutil.ReadFile("/proc/loadavg"); e == nil {
+			fields := strings.Fields(string(b))
+			if len(fields) > 0 {
+				if load, e := strconv.ParseFloat(fields[0], 64); e == nil && load > float64(runtime.NumCPU()) {
+					return true, fmt.Sprintf("load average %s exceeds %d CPUs", fields[0], runtime.NumCPU())
+				}
+			}
+		}
+		return false, ""
+	}
+}
+
+// meminfo returns MemTotal and MemAvailable in /proc/meminfo, in kB.
+func meminfo() (total, available uint64, e error) {
+	f, e := os.Open("/proc/meminfo")
+	if e != nil {
+		return 0, 0, e
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return total, available, s.Err()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderLimiterAdapts(t *testing.T) {
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	under := false
+	l := newRenderLimiter(1, 4, time.Millisecond, func() (bool, string) { return under, "test" })
+	l.now = func() time.Time { return now }
+	step := func() {
+		now = now.Add(time.Second)
+		assert.True(t, l.acquire())
+		l.release()
+	}
+
+	for i := 0; i < 10; i++ {
+		step()
+	}
+	assert.Equal(t, 4, l.limit)
+
+	under = true
+	step()
+	assert.Equal(t, 2, l.limit)
+	step()
+	step()
+	assert.Equal(t, 1, l.limit)
+
+	// No more than one adjustment per interval.
+	under = false
+	step()
+	assert.Equal(t, 2, l.limit)
+	assert.True(t, l.acquire())
+	assert.True(t, l.acquire())
+	assert.Equal(t, 2, l.limit)
+}
+
+func TestRenderLimiterQueues(t *testing.T) {
+	l := newRenderLimiter(1, 1, 50*time.Millisecond, func() (bool, string) { return false, "" })
+
+	block := make(chan bool)
+	h := l.wrap(func(w http.ResponseWriter, r *http.Request) { <-block })
+	serve := func() int {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud-config/00:25:90:c0:f7:80", nil)
+		h(rr, req)
+		return rr.Code
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusOK, serve())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, serve())
+
+	// A queued render runs once the running one is done.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, http.StatusOK, serve())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	block <- true
+	block <- true
+	wg.Wait()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+const (
+	firstBootReportFile = "first-boot-report"
+	maxReportSize       = 1 << 20
+)
+
+// nodeReportDir returns the directory under reportDir, which keeps
+// the reports of the node with MAC address hwAddr.
+func nodeReportDir(reportDir string, hwAddr net.HardwareAddr) string {
+	return path.Join(reportDir, clusterdesc.Node{MAC: hwAddr.String()}.Hostname())
+}
+
+// saveUpload streams body to fn, without buffering it in memory.  It
+// writes a temporary file next to fn and renames it, so an upload cut
+// short doesn't replace the previous one.
+func saveUpload(fn string, body io.Reader) error {
+	f, e := ioutil.TempFile(path.Dir(fn), "."+path.Base(fn))
+	if e != nil {
+		return e
+	}
+	defer os.Remove(f.Name())
+	if _, e = io.Copy(f, body); e != nil {
+		f.Close()
+		return e
+	}
+	if e = f.Close(); e != nil {
+		return e
+	}
+	if e = os.Chmod(f.Name(), 0644); e != nil {
+		return e
+	}
+	return os.Rename(f.Name(), fn)
+}
+
+// fromNode tells if r comes from the node with MAC address hwAddr:
+// either from the IP of the node in clusterDescFile, or with the
+// token of the node, see certgen.NodeToken, as a bearer token.
+func fromNode(r *http.Request, hwAddr net.HardwareAddr, clusterDescFile, caKey string) (bool, error) {
+	c, e := cctemplate.LoadClusterDesc(clusterDescFile)
+	if e != nil {
+		return false, e
+	}
+	hostname := clusterdesc.Node{MAC: hwAddr.String()}.Hostname()
+	ip, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil {
+		ip = r.RemoteAddr
+	}
+	for _, n := range c.Nodes {
+		m, e := net.ParseMAC(n.MAC)
+		if e == nil && m.String() == hwAddr.String() && len(n.IP) > 0 && n.IP == ip {
+			return true, nil
+		}
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 || len(caKey) == 0 {
+		return false, nil
+	}
+	want, e := certgen.NodeToken(caKey, hostname)
+	if e != nil {
+		return false, e
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1, nil
+}
+
+// makeFirstBootReportHandler generates a HTTP handler, which saves
+// the first-boot report POSTed by a node, as rendered by
+// /opt/bin/first-boot-report, and serves it back on GET, so that a
+// node that provisioned but isn't ready comes with diagnostics.  Only
+// the node itself may upload its report, see fromNode.
+func makeFirstBootReportHandler(reportDir, clusterDescFile, caKey string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		candy.Must(err)
+		fn := path.Join(nodeReportDir(reportDir, hwAddr), firstBootReportFile)
+
+		if r.Method != "POST" && r.Method != "PUT" {
+			http.ServeFile(w, r, fn)
+			return
+		}
+		ok, err := fromNode(r, hwAddr, clusterDescFile, caKey)
+		candy.Must(err)
+		if !ok {
+			glog.Warningf("Refused the first-boot report of %s from %s", hwAddr, r.RemoteAddr)
+			http.Error(w, "only the node may upload its first-boot report", http.StatusForbidden)
+			return
+		}
+		candy.Must(os.MkdirAll(path.Dir(fn), 0755))
+		err = saveUpload(fn, http.MaxBytesReader(w, r.Body, maxReportSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "the first-boot report is larger than "+strconv.Itoa(maxReportSize)+" bytes", http.StatusRequestEntityTooLarge)
+			return
+		}
+		candy.Must(err)
+		glog.Infof("Received first-boot report of %s", hwAddr)
+		events.publish("node.first-boot-report", hwAddr.String(), nil)
+	})
+}
+
+// readHardware returns the hardware listed in the first-boot report
+// of the node with MAC address hwAddr, and false if there is none.
+func readHardware(reportDir string, hwAddr net.HardwareAddr) (clusterdesc.Hardware, bool) {
+	var hw clusterdesc.Hardware
+	b, e := ioutil.ReadFile(path.Join(nodeReportDir(reportDir, hwAddr), firstBootReportFile))
+	if e != nil {
+		return hw, false
+	}
+	section := ""
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "# ") {
+			section = line
+			continue
+		}
+		fields := strings.Fields(line)
+		if section != "# hardware" || len(fields) != 2 {
+			continue
+		}
+		n, _ := strconv.Atoi(fields[1])
+		switch fields[0] {
+		case "cpus":
+			hw.CPUs = n
+		case "memory_kb":
+			hw.MemoryMB = n / 1024
+		}
+	}
+	return hw, hw.CPUs > 0 && hw.MemoryMB > 0
+}
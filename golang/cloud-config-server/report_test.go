@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestFirstBootReportHandler(t *testing.T) {
+	reportDir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(reportDir)
+	clusterDescFile := path.Join(reportDir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(clusterDescFile, []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80", "ip": "10.10.14.200"}]}`), 0644))
+	caKey, _ := certgen.GenerateRootCA(reportDir)
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/nodes/{mac}/first-boot-report", makeFirstBootReportHandler(reportDir, clusterDescFile, caKey))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/nodes/00-25-90-c0-f7-80/first-boot-report", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Only the node, by its IP or token, may upload its report.
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/nodes/00-25-90-c0-f7-80/first-boot-report", bytes.NewBufferString("forged"))
+	req.RemoteAddr = "10.10.14.201:12345"
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	token, e := certgen.NodeToken(caKey, "0c-c4-7a-82-c5-bc")
+	candy.Must(e)
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/nodes/0c-c4-7a-82-c5-bc/first-boot-report", bytes.NewBufferString("kubelet.service active"))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/nodes/00-25-90-c0-f7-80/first-boot-report", bytes.NewBufferString("kubelet.service active"))
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/nodes/00-25-90-c0-f7-80/first-boot-report", bytes.NewBufferString("kubelet.service active"))
+	req.RemoteAddr = "10.10.14.200:12345"
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/nodes/00:25:90:c0:f7:80/first-boot-report", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, "kubelet.service active", rr.Body.String())
+
+	// An oversized upload fails and keeps the previous report.
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/nodes/00-25-90-c0-f7-80/first-boot-report", bytes.NewReader(make([]byte, maxReportSize+1)))
+	req.RemoteAddr = "10.10.14.200:12345"
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/nodes/00:25:90:c0:f7:80/first-boot-report", nil)
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, "kubelet.service active", rr.Body.String())
+}
+
+func TestReadHardware(t *testing.T) {
+	reportDir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(reportDir)
+
+	hwAddr, _ := net.ParseMAC("00:25:90:c0:f7:80")
+	_, ok := readHardware(reportDir, hwAddr)
+	assert.False(t, ok)
+
+	candy.Must(os.MkdirAll(nodeReportDir(reportDir, hwAddr), 0755))
+	candy.Must(ioutil.WriteFile(path.Join(nodeReportDir(reportDir, hwAddr), firstBootReportFile),
+		[]byte("# units\ncpus 1\n# hardware\ncpus 8\nmemory_kb 16384000\n# files\n"), 0644))
+	hw, ok := readHardware(reportDir, hwAddr)
+	assert.True(t, ok)
+	assert.Equal(t, clusterdesc.Hardware{CPUs: 8, MemoryMB: 16000}, hw)
+}
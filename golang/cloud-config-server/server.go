@@ -1,14 +1,17 @@
 // cloud-config-server starts an HTTP server, which can be accessed
 // via URLs in the form of
 //
-//   http://<addr:port>?mac=aa:bb:cc:dd:ee:ff
+//   http://<addr:port>/cloud-config/aa:bb:cc:dd:ee:ff
 //
 // and returns the cloud-config YAML file specificially tailored for
 // the node whose primary NIC's MAC address matches that specified in
-// above URL.
+// above URL.  Nodes installed by earlier sextant fetch the legacy form
+// http://<addr:port>?mac=aa:bb:cc:dd:ee:ff, served as well unless
+// -legacy-endpoints=false.
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -16,28 +19,72 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path"
+	"runtime"
+	"time"
 
 	"github.com/golang/glog"
 
 	"github.com/gorilla/mux"
 	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/k8sp/sextant/golang/clusterdesc"
 	cctemplate "github.com/k8sp/sextant/golang/template"
 	"github.com/topicai/candy"
 )
 
 func main() {
 	clusterDesc := flag.String("cluster-desc", "./cluster-desc.yml", "Configurations for a k8s cluster.")
-	ccTemplateDir := flag.String("cloud-config-dir", "./cloud-config.template", "cloud-config file template.")
+	ccTemplateDir := flag.String("cloud-config-dir", "./cloud-config.template", "cloud-config file template directories, separated by ':', where later ones override earlier ones.")
 	caCrt := flag.String("ca-crt", "", "CA certificate file, in PEM format")
 	caKey := flag.String("ca-key", "", "CA private key file, in PEM format")
-	addr := flag.String("addr", ":8080", "Listening address")
+	addr := flag.String("addr", ":8080", "Listening address, or unix:<path> to listen on a Unix domain socket")
+	tlsAddr := flag.String("tls-addr", "", "If not empty, also serve https on this address, with -tls-crt and -tls-key, for what nodes must fetch untampered, like the CA bundle.")
+	tlsCrt := flag.String("tls-crt", "", "The certificate of the bootstrapper, signed by -ca-crt, for -tls-addr.")
+	tlsKey := flag.String("tls-key", "", "The private key of -tls-crt.")
 	staticDir := flag.String("dir", "./static/", "The directory to serve files from. Default is ./static/")
+	reportDir := flag.String("report-dir", "./reports", "The directory to save reports uploaded by nodes to.")
+	recordDir := flag.String("record-dir", "", "If not empty, record every render into this directory for replaying. Private keys are redacted from records.")
+	recordKeep := flag.Int("record-keep", 20, "How many render records to keep per node in -record-dir, 0 means all.")
+	proxyAllow := flag.String("proxy-allow", "", "Comma separated base URLs of package mirrors, like http://mirrors.163.com, which nodes may reach via /proxy/<host>/.")
+	proxyCacheDir := flag.String("proxy-cache-dir", "./proxy-cache", "The directory to cache files fetched via /proxy/ in.")
+	proxyCacheMaxSize := flag.Int64("proxy-cache-max-size", 0, "Files larger than this many bytes fetched via /proxy/ are streamed to nodes without being cached, 0 means no limit.")
+	proxyRate := flag.Int64("proxy-rate", 0, "Bytes per second to read from package mirrors, 0 means no limit.")
+	debug := flag.Bool("debug", false, "Serve /debug/render/<mac>, which shows the template variables of nodes, to operators with an admin token, see -admin-tokens.")
+	historyDir := flag.String("history-dir", "", "If not empty, keep versions of cluster-desc and templates edited via HTTP in this directory.")
+	historyKeep := flag.Int("history-keep", 10, "How many versions of each edited file to keep in -history-dir.")
+	bootLoopLimit := flag.Int("boot-loop-limit", 5, "Quarantine a node after it fetched this many cloud-configs within -boot-loop-window, 0 means never.")
+	bootLoopWindow := flag.Duration("boot-loop-window", time.Hour, "See -boot-loop-limit.")
+	alertURL := flag.String("alert-url", "", "If not empty, POST alerts, like a node caught in a boot loop, in JSON to this URL.")
+	sshCertTokens := flag.String("ssh-cert-tokens", "", "If not empty, and -certgen.ssh-ca-key is set, serve /ssh-cert to operators with a bearer token listed in this file, one \"<token> <identity> <principal>,...\" per line.")
+	sshCertTTL := flag.Duration("ssh-cert-ttl", 8*time.Hour, "How long SSH user certificates issued by /ssh-cert are valid.")
+	renderMin := flag.Int("render-min", 1, "The fewest renders to run at once, however short of memory or CPU the server is.")
+	renderMax := flag.Int("render-max", 2*runtime.NumCPU(), "The most renders to run at once.  Within -render-min and this, the limit adapts to memory and CPU pressure.")
+	renderHeapLimit := flag.Uint64("render-heap-limit", 0, "If not 0, limit renders while the heap of the server exceeds this many bytes.")
+	renderQueueTimeout := flag.Duration("render-queue-timeout", 2*time.Minute, "How long a render may queue before the node is asked to retry later.")
+	arpProbeIface := flag.String("arp-probe-iface", "", "If not empty, ARP probe on this interface the fixed IPs of nodes in the background, and list IPs used by other devices in /ip-conflicts.")
+	arpRefuse := flag.Bool("arp-refuse-conflicts", false, "Refuse to serve the config of a node whose fixed IP is used by another device, see -arp-probe-iface.")
+	dnsCheckServer := flag.String("dns-check-server", "", "If not empty, the authoritative DNS server, host[:port], of the external zone of domainname, in which the FQDN and fixed IP of every node are looked up before serving its config, listing records contradicting cluster-desc in /dns-conflicts.")
+	dnsRefuse := flag.Bool("dns-refuse-conflicts", false, "Refuse to serve the config of a node whose records in the external DNS contradict cluster-desc, see -dns-check-server.")
+	freezeFile := flag.String("freeze-file", "./freeze.json", "The file to keep the change freeze set via /freeze in, so it survives restarts.")
+	accessLogFile := flag.String("access-log", "", "If not empty, log requests for configs and artifacts to this file, separately from the application log.")
+	accessLogFormat := flag.String("access-log-format", "clf", "The format of -access-log: clf, the Common Log Format, or json.")
+	accessLogMaxSize := flag.Int64("access-log-max-size", 100<<20, "Rotate -access-log before it exceeds this many bytes, 0 means no limit.")
+	accessLogMaxAge := flag.Duration("access-log-max-age", 24*time.Hour, "Rotate -access-log once it is this old, 0 means no limit.")
+	accessLogKeep := flag.Int("access-log-keep", 7, "How many rotated access logs to keep, 0 means all.")
+	accessLogCompress := flag.Bool("access-log-compress", true, "Gzip rotated access logs.")
+	caBundle := flag.String("ca-bundle", "./ca-bundle.pem", "The PEM bundle of CAs, like those of corporate proxies and internal CAs, that nodes add to their system trust stores, edited via /ca-bundle.")
+	smokeTestEdits := flag.Bool("smoke-test", true, "Render every node with edits of cluster-desc and templates before they go live, and refuse those failing.  Reports are saved in <report-dir>/smoke/.")
+	adminTokens := flag.String("admin-tokens", "", "The file of bearer tokens of operators allowed to change the cluster, like editing cluster-desc and templates, one \"<token> <identity>\" per line.  If empty, such changes are refused.")
+	legacyEndpoints := flag.Bool("legacy-endpoints", true, "Also serve cloud-configs at the legacy ?mac= endpoints, for nodes installed by earlier sextant.  /legacy-usage tells which nodes still use them.")
 	flag.Parse()
 
 	if len(*caCrt) == 0 || len(*caKey) == 0 {
 		glog.Info("No ca.pem or ca-key.pem provided, generating now...")
 		*caKey, *caCrt = certgen.GenerateRootCA("./")
 	}
+	if len(*certgen.SSHCAKey) > 0 {
+		certgen.GenerateSSHCA(*certgen.SSHCAKey)
+	}
 	// valid caKey and caCrt file is ready
 	if err := fileExist(*caCrt); err != nil {
 		glog.Error("No cert of ca.pem has been generated!")
@@ -48,26 +95,131 @@ func main() {
 		log.Panic(err)
 	}
 
+	// Refuse to start with a cluster-desc that the templates can't render.
+	c, e := cctemplate.LoadClusterDesc(*clusterDesc)
+	candy.Must(e)
+	if e := c.CheckKubernetesVersion(); e != nil {
+		glog.Fatal(e)
+	}
+	if e := c.CheckMinSextantVersion(); e != nil {
+		glog.Fatal(e)
+	}
+	if e := cctemplate.CheckTemplateVersions(*ccTemplateDir); e != nil {
+		glog.Fatal(e)
+	}
+
+	// Compute resource reservations from the hardware nodes report.
+	cctemplate.RegisterInventory(func(mac string) (clusterdesc.Hardware, bool) {
+		hwAddr, err := net.ParseMAC(mac)
+		if err != nil {
+			return clusterdesc.Hardware{}, false
+		}
+		return readHardware(*reportDir, hwAddr)
+	})
+
 	glog.Info("Cloud-config server start Listenning...")
-	l, e := net.Listen("tcp", *addr)
+	l, e := listen(*addr)
 	candy.Must(e)
 
 	// start and run the HTTP server
+	history := newEditHistory(*historyDir, *historyKeep)
+	frozen, e := newChangeFreeze(*freezeFile)
+	candy.Must(e)
+	var access *accessLog
+	if len(*accessLogFile) > 0 {
+		access, e = newAccessLog(*accessLogFile, *accessLogFormat, *accessLogMaxSize, *accessLogMaxAge, *accessLogKeep, *accessLogCompress)
+		candy.Must(e)
+	}
+	admin := newAdminAuth(*adminTokens)
 	router := mux.NewRouter().StrictSlash(true)
-	router.HandleFunc("/cloud-config/{mac}", makeCloudConfigHandler(*clusterDesc, *ccTemplateDir, *caKey, *caCrt))
-	router.HandleFunc("/centos/post-script/{mac}", makeCentOSPostScriptHandler(*clusterDesc, *ccTemplateDir, *caKey, *caCrt))
-	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(*staticDir))))
+	logs := newLogHub()
+	router.HandleFunc("/logs/stream", logs.streamHandler())
+	router.HandleFunc("/events", events.streamHandler())
+	watchdog, e := newBootLoopWatchdog(*bootLoopWindow, *bootLoopLimit, *alertURL, path.Join(*reportDir, "boot-loops.json"))
+	candy.Must(e)
+	renders := newRenderLimiter(*renderMin, *renderMax, *renderQueueTimeout, systemPressure(*renderHeapLimit))
+	var arp *arpProber
+	if len(*arpProbeIface) > 0 {
+		arp = newARPProber(*arpProbeIface, *arpRefuse)
+		go arp.sweep(*clusterDesc)
+	}
+	router.HandleFunc("/ip-conflicts", arp.listHandler())
+	var dns *dnsChecker
+	if len(*dnsCheckServer) > 0 {
+		dns = newDNSChecker(*dnsCheckServer, *dnsRefuse)
+	}
+	router.HandleFunc("/dns-conflicts", dns.listHandler())
+	router.HandleFunc("/cloud-config/{mac}", access.wrap(renders.wrap(arp.wrap(*clusterDesc, dns.wrap(*clusterDesc, watchdog.watch(recordRenders(*recordDir, *recordKeep, "cc-template", *ccTemplateDir, *clusterDesc,
+		makeCloudConfigHandler(*clusterDesc, *ccTemplateDir, *caKey, *caCrt, *reportDir))))))))
+	router.HandleFunc("/boot-loops", watchdog.listHandler())
+	router.HandleFunc("/status", makeStatusHandler(*clusterDesc, *ccTemplateDir, *reportDir, watchdog, frozen))
+	router.HandleFunc("/boot-loops/{mac}", admin.require(frozen.guard(watchdog.releaseHandler())))
+	router.HandleFunc("/freeze", admin.guard(frozen.handler()))
+	router.HandleFunc("/centos/post-script/{mac}", access.wrap(renders.wrap(arp.wrap(*clusterDesc, dns.wrap(*clusterDesc, recordRenders(*recordDir, *recordKeep, "centos-post-script", *ccTemplateDir, *clusterDesc,
+		makeCentOSPostScriptHandler(*clusterDesc, *ccTemplateDir, *caKey, *caCrt)))))))
+	router.HandleFunc("/addons/{bundle}", access.wrap(makeAddonsHandler(path.Join(*staticDir, "addons-config"))))
+	if *debug {
+		router.HandleFunc("/debug/render/{mac}", admin.require(makeDebugRenderHandler(*clusterDesc, *ccTemplateDir)))
+	}
+	if len(*certgen.SSHCAKey) > 0 && len(*sshCertTokens) > 0 {
+		router.HandleFunc("/ssh-cert", makeSSHCertHandler(*certgen.SSHCAKey, *sshCertTokens, *sshCertTTL))
+	}
+	if len(*certgen.SIEMSyslog) > 0 && len(*certgen.CertAuditLog) > 0 {
+		router.HandleFunc("/siem/replay", admin.require(makeSIEMReplayHandler()))
+	}
+	router.HandleFunc("/graph", makeGraphHandler(*clusterDesc, *ccTemplateDir, *reportDir, *staticDir))
+	router.HandleFunc("/nodes/{mac}/effective-config", makeEffectiveConfigHandler(*clusterDesc))
+	smoke := newSmokeGate(*ccTemplateDir, *clusterDesc, *reportDir, *smokeTestEdits)
+	router.HandleFunc("/cluster-desc", admin.guard(frozen.guard(makeEditHandler(
+		func(*http.Request) (string, error) { return *clusterDesc, nil }, smoke.clusterDesc, history))))
+	router.HandleFunc("/templates/{name}", admin.guard(frozen.guard(makeEditHandler(templateFileOf(*ccTemplateDir), smoke.template, history))))
+	router.HandleFunc("/smoke/{version}", makeSmokeReportHandler(*reportDir))
+	router.HandleFunc("/ca-bundle", admin.guard(frozen.guard(serveCABundleRemoval(*caBundle, makeEditHandler(
+		func(*http.Request) (string, error) { return *caBundle, nil }, validateCABundle, history)))))
+	router.HandleFunc("/template-origins", makeTemplateOriginsHandler(*ccTemplateDir))
+	router.HandleFunc("/deprecations", makeDeprecationsHandler(*clusterDesc, *ccTemplateDir))
+	router.HandleFunc("/nodes/{mac}/first-boot-report", makeFirstBootReportHandler(*reportDir, *clusterDesc, *caKey))
+	router.HandleFunc("/nodes/{mac}/provenance", makeProvenanceHandler(*reportDir, *ccTemplateDir, *clusterDesc))
+	bringUps := newBringUpTracker(*clusterDesc, *ccTemplateDir, *reportDir)
+	router.HandleFunc("/reports/bringup", bringUps.listHandler())
+	router.HandleFunc("/reports/bringup/{id}", bringUps.reportHandler())
+	proxy, e := newMirrorProxy(*proxyAllow, *proxyCacheDir, *proxyCacheMaxSize, *proxyRate)
+	candy.Must(e)
+	router.Handle("/proxy/{host}/{path:.*}", access.wrap(proxy))
+	artifacts := newArtifactVerifier(*staticDir)
+	router.HandleFunc("/artifacts", artifacts.listHandler())
+	router.PathPrefix("/static/").Handler(access.wrap(http.StripPrefix("/static/", artifacts.fileServer())))
 
-	glog.Fatal(http.Serve(l, router))
+	legacy := newLegacyCompat(*legacyEndpoints)
+	router.HandleFunc("/legacy-usage", legacy.reportHandler())
+
+	handler := legacy.middleware(logs.middleware(bringUps.middleware(router)))
+	if len(*tlsAddr) > 0 {
+		tl, e := net.Listen("tcp", *tlsAddr)
+		candy.Must(e)
+		go func() { glog.Fatal(http.ServeTLS(tl, handler, *tlsCrt, *tlsKey)) }()
+	}
+	glog.Fatal(http.Serve(l, handler))
 }
 
 // makeCloudConfigHandler generate a HTTP server handler to serve cloud-config
-// fetching requests
-func makeCloudConfigHandler(clusterDescFile string, ccTemplateDir string, caKey, caCrt string) http.HandlerFunc {
+// fetching requests.  The provenance of every cloud-config is saved
+// under reportDir, unless it is empty, see makeProvenanceHandler.
+func makeCloudConfigHandler(clusterDescFile string, ccTemplateDir string, caKey, caCrt, reportDir string) http.HandlerFunc {
 	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
 		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
 		candy.Must(err)
-		candy.Must(cctemplate.Execute(w, hwAddr.String(), "cc-template", ccTemplateDir, clusterDescFile, caKey, caCrt))
+		p, err := cctemplate.ExecuteProvenance(w, hwAddr.String(), "cc-template", ccTemplateDir, clusterDescFile, caKey, caCrt)
+		candy.Must(err)
+		if isPreflight(r) {
+			return
+		}
+		events.publish("node.config-rendered", hwAddr.String(), *p)
+		if len(reportDir) > 0 {
+			if err := saveProvenance(reportDir, hwAddr, p); err != nil {
+				glog.Warningf("Cannot save provenance of %s: %v", hwAddr, err)
+			}
+		}
 	})
 }
 
@@ -79,6 +231,23 @@ func makeCentOSPostScriptHandler(clusterDescFile string, ccTemplateDir string, c
 	})
 }
 
+// makeEffectiveConfigHandler generates a HTTP handler, which returns
+// the data the templates are executed with for a node in JSON.
+func makeEffectiveConfigHandler(clusterDescFile string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		hwAddr, err := net.ParseMAC(mux.Vars(r)["mac"])
+		candy.Must(err)
+		c, err := cctemplate.EffectiveConfig(hwAddr.String(), clusterDescFile)
+		candy.Must(err)
+		redacted, err := cctemplate.Redact(c)
+		candy.Must(err)
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		candy.Must(enc.Encode(redacted))
+	})
+}
+
 func makeSafeHandler(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"log"
@@ -54,7 +55,7 @@ func TestCloudConfigHandler(t *testing.T) {
 	// TODO: put route setups in a common function
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/cloud-config/{mac}",
-		makeCloudConfigHandler(clusterDescExampleFile, templateDir, caKey, caCrt))
+		makeCloudConfigHandler(clusterDescExampleFile, templateDir, caKey, caCrt, ""))
 	router.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
@@ -82,3 +83,26 @@ func TestCloudConfigHandler(t *testing.T) {
 		t.Errorf("cloud-config empty.")
 	}
 }
+
+func TestEffectiveConfigHandler(t *testing.T) {
+	f, e := ioutil.TempFile("", "")
+	candy.Must(e)
+	defer os.Remove(f.Name())
+	_, e = f.WriteString(`{"dockerdomain": "bootstrapper", "nodes": [{"mac": "00:25:90:c0:f7:80", "ip": "10.10.14.2"}]}`)
+	candy.Must(e)
+	f.Close()
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/nodes/00:25:90:C0:F7:80/effective-config", nil)
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/nodes/{mac}/effective-config", makeEffectiveConfigHandler(f.Name()))
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	c := make(map[string]interface{})
+	candy.Must(json.Unmarshal(rr.Body.Bytes(), &c))
+	assert.Equal(t, "00-25-90-c0-f7-80", c["Hostname"])
+	assert.Equal(t, "10.10.14.2", c["IP"])
+	assert.Equal(t, "bootstrapper", c["Dockerdomain"])
+	assert.Equal(t, "", c["Key"])
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/topicai/candy"
+)
+
+// makeSIEMReplayHandler generates a HTTP handler, which sends the
+// certificate events in the audit log issued after the RFC 3339 time
+// in query parameter since to the SIEM again, and responds with how
+// many it sent and the time of the last one, to be the since of the
+// next replay if this one is cut short.
+func makeSIEMReplayHandler() http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST to replay certificate events", http.StatusMethodNotAllowed)
+			return
+		}
+		var since time.Time
+		if s := r.URL.Query().Get("since"); len(s) > 0 {
+			t, e := time.Parse(time.RFC3339Nano, s)
+			if e != nil {
+				http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+		n, last, e := certgen.ReplayCertEvents(since)
+		if e != nil {
+			glog.Warningf("Replayed %d certificate events since %v by %s, then: %v", n, since, authorOf(r), e)
+			http.Error(w, e.Error(), http.StatusBadGateway)
+			return
+		}
+		glog.Infof("Replayed %d certificate events since %v by %s", n, since, authorOf(r))
+		w.Header().Set("Content-Type", "application/json")
+		candy.Must(json.NewEncoder(w).Encode(struct {
+			Replayed int
+			Last     time.Time
+		}{n, last}))
+	})
+}
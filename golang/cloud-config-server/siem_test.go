@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestSIEMReplayHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	l, e := net.ListenPacket("udp", "127.0.0.1:0")
+	candy.Must(e)
+	defer l.Close()
+	auditLog := path.Join(dir, "cert-audit.log")
+	candy.Must(ioutil.WriteFile(auditLog, []byte(
+		"2017-06-01T00:00:00Z CEF:0|k8sp|sextant|1.0|cert-issue|Certificate issued|3|dhost=00-25-90-c0-f7-80\n"+
+			"2017-06-02T00:00:00Z CEF:0|k8sp|sextant|1.0|cert-issue|Certificate issued|3|dhost=00-25-90-c0-f7-81\n"), 0600))
+	savedSyslog, savedLog := *certgen.SIEMSyslog, *certgen.CertAuditLog
+	defer func() { *certgen.SIEMSyslog, *certgen.CertAuditLog = savedSyslog, savedLog }()
+	*certgen.SIEMSyslog, *certgen.CertAuditLog = "udp://"+l.LocalAddr().String(), auditLog
+
+	h := makeSIEMReplayHandler()
+	post := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/siem/replay"+query, nil)
+		h(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("?since=yesterday").Code)
+
+	rr := post("?since=2017-06-01T00:00:00Z")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Replayed int
+		Last     time.Time
+	}
+	candy.Must(json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Replayed)
+	assert.Equal(t, "2017-06-02T00:00:00Z", resp.Last.Format(time.RFC3339))
+	buf := make([]byte, 4096)
+	candy.Must(l.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	n, _, e := l.ReadFrom(buf)
+	if assert.Nil(t, e) {
+		assert.True(t, strings.Contains(string(buf[:n]), "dhost=00-25-90-c0-f7-81"))
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/siem/replay", nil)
+	h(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+// smokeResult is the result of rendering a template for a node.
+type smokeResult struct {
+	MAC      string
+	Hostname string
+	Template string
+	Error    string `json:",omitempty"`
+}
+
+// smokeReport is the result of smoke testing a version of a file.
+type smokeReport struct {
+	File    string
+	Version string // The sha256 prefix, as in the edit history.
+	Time    time.Time
+	Passed  bool
+	Results []smokeResult
+}
+
+var smokeVersion = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// smokeTest renders the templates in ccTemplateDir for every node in
+// clusterDescFile, without certs, through the render path of nodes,
+// and checks that the renders succeed, that cloud-configs are YAML,
+// and that the templates refer to no variable undefined.
+func smokeTest(ccTemplateDir, clusterDescFile string) []smokeResult {
+	c, err := cctemplate.LoadClusterDesc(clusterDescFile)
+	if err != nil {
+		return []smokeResult{{Template: "cluster-desc", Error: err.Error()}}
+	}
+	// Nodes are looked up by MAC in every render, so an invalid MAC
+	// fails all of them.
+	var results []smokeResult
+	for _, n := range c.Nodes {
+		if _, err := net.ParseMAC(n.MAC); err != nil {
+			results = append(results, smokeResult{MAC: n.MAC, Template: "cluster-desc", Error: err.Error()})
+		}
+	}
+	if len(results) > 0 {
+		return results
+	}
+
+	if undefined, _, err := cctemplate.CheckVariables(ccTemplateDir, c); err != nil {
+		results = append(results, smokeResult{Template: "lint", Error: err.Error()})
+	} else if len(undefined) > 0 {
+		results = append(results, smokeResult{Template: "lint", Error: "undefined: " + strings.Join(undefined, ", ")})
+	}
+
+	for _, n := range c.Nodes {
+		templates := []string{"cc-template"}
+		if c.OSName == "CentOS" {
+			templates = append(templates, "centos-post-script")
+		}
+		for _, name := range templates {
+			r := smokeResult{MAC: n.Mac(), Hostname: n.Hostname(), Template: name}
+			var buf bytes.Buffer
+			_, err := cctemplate.ExecuteProvenance(&buf, n.Mac(), name, ccTemplateDir, clusterDescFile, "", "")
+			if err == nil && name == "cc-template" {
+				err = yaml.Unmarshal(buf.Bytes(), &map[string]interface{}{})
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// smokeGate smoke tests edits of cluster-desc and templates with the
+// rest of the config in use, see smokeTest, and refuses those that
+// fail, so an edit goes live only if it renders for every node.  The
+// report of every edit tested is saved as reportDir/smoke/<version>.json,
+// where version is that of the edit history.  A nil smokeGate only
+// validates edits.
+type smokeGate struct {
+	ccTemplateDir   string
+	clusterDescFile string
+	reportDir       string
+}
+
+func newSmokeGate(ccTemplateDir, clusterDescFile, reportDir string, enabled bool) *smokeGate {
+	if !enabled {
+		return nil
+	}
+	return &smokeGate{ccTemplateDir: ccTemplateDir, clusterDescFile: clusterDescFile, reportDir: reportDir}
+}
+
+// clusterDesc validates and smoke tests b as cluster-desc.
+func (g *smokeGate) clusterDesc(fn string, b []byte) error {
+	if err := validateClusterDesc(fn, b); err != nil || g == nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "cluster-desc")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return g.check(fn, b, smokeTest(g.ccTemplateDir, f.Name()))
+}
+
+// template validates and smoke tests b as the template file fn, by
+// overlaying it on the templates in use.
+func (g *smokeGate) template(fn string, b []byte) error {
+	if err := validateTemplate(fn, b); err != nil || g == nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, path.Base(fn)), b, 0644); err != nil {
+		return err
+	}
+	return g.check(fn, b, smokeTest(g.ccTemplateDir+":"+dir, g.clusterDescFile))
+}
+
+// check saves the report of results and returns an error listing the
+// failures, if any.
+func (g *smokeGate) check(fn string, b []byte, results []smokeResult) error {
+	report := smokeReport{
+		File:    path.Base(fn),
+		Version: fmt.Sprintf("%x", sha256.Sum256(b))[:12],
+		Time:    time.Now().UTC(),
+		Passed:  true,
+		Results: results,
+	}
+	var failures []string
+	for _, r := range results {
+		if len(r.Error) > 0 {
+			report.Passed = false
+			failures = append(failures, fmt.Sprintf("%s %s: %s", r.Template, r.MAC, r.Error))
+		}
+	}
+
+	dir := path.Join(g.reportDir, "smoke")
+	js, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		glog.Warningf("Cannot save the smoke test report of %s: %v", fn, err)
+	} else if err := ioutil.WriteFile(path.Join(dir, report.Version+".json"), js, 0644); err != nil {
+		glog.Warningf("Cannot save the smoke test report of %s: %v", fn, err)
+	}
+
+	events.publish("config.smoke-test", "", map[string]interface{}{"file": report.File, "version": report.Version, "passed": report.Passed})
+	if !report.Passed {
+		return fmt.Errorf("smoke test of version %s failed:\n%s", report.Version, strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// makeSmokeReportHandler generates a HTTP handler, which returns the
+// smoke test report of the version given by {version}.
+func makeSmokeReportHandler(reportDir string) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		version := mux.Vars(r)["version"]
+		if !smokeVersion.MatchString(version) {
+			http.Error(w, "invalid version "+version, http.StatusBadRequest)
+			return
+		}
+		b, err := ioutil.ReadFile(path.Join(reportDir, "smoke", version+".json"))
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		candy.Must(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSmokeGate(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	tmplDir := path.Join(dir, "templatefiles")
+	candy.Must(os.Mkdir(tmplDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "cc.template"),
+		[]byte(`{{ define "cc-template" }}{"hostname": "{{ .Hostname }}"}{{ end }}`), 0644))
+	desc := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(desc, []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80"}]}`), 0644))
+	reportDir := path.Join(dir, "reports")
+
+	smoke := newSmokeGate(tmplDir, desc, reportDir, true)
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/cluster-desc", makeEditHandler(
+		func(*http.Request) (string, error) { return desc, nil }, smoke.clusterDesc, nil))
+	router.HandleFunc("/templates/{name}", makeEditHandler(templateFileOf(tmplDir), smoke.template, nil))
+	router.HandleFunc("/smoke/{version}", makeSmokeReportHandler(reportDir))
+	do := func(method, url, body, ifMatch string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("If-Match", ifMatch)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	current := func(url string) string { return do("GET", url, "", "").Header().Get("ETag") }
+
+	// A template rendering invalid YAML doesn't go live.
+	rr := do("PUT", "/templates/cc.template", `{{ define "cc-template" }}{"hostname": {{ end }}`, current("/templates/cc.template"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cc-template 00:25:90:c0:f7:80")
+	assert.Contains(t, do("GET", "/templates/cc.template", "", "").Body.String(), `"{{ .Hostname }}"`)
+
+	// Neither does one referring to an undefined variable.
+	rr = do("PUT", "/templates/cc.template", `{{ define "cc-template" }}{"hostname": "{{ .NoSuchField }}"}{{ end }}`, current("/templates/cc.template"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "lint")
+
+	rr = do("PUT", "/templates/cc.template", `{{ define "cc-template" }}{"name": "{{ .Hostname }}"}{{ end }}`, current("/templates/cc.template"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusOK, do("PUT", "/cluster-desc", `{"nodes": [{"mac": "00:25:90:c0:f7:81"}]}`, current("/cluster-desc")).Code)
+
+	// The report of every version tested is kept.
+	rr = do("GET", "/smoke/"+rr.Header().Get("ETag")[1:13], "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var report smokeReport
+	candy.Must(json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.True(t, report.Passed)
+	assert.Equal(t, "cc.template", report.File)
+	assert.Equal(t, []smokeResult{{MAC: "00:25:90:c0:f7:80", Hostname: "00-25-90-c0-f7-80", Template: "cc-template"}}, report.Results)
+	files, _ := ioutil.ReadDir(path.Join(reportDir, "smoke"))
+	assert.Equal(t, 4, len(files))
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/smoke/000000000000", "", "").Code)
+	// The router would clean a path with "..", so the version is set
+	// directly to reach the validation of the handler.
+	for _, version := range []string{"..", "../x", "a b"} {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/smoke/x", nil)
+		makeSmokeReportHandler(reportDir)(rr, mux.SetURLVars(req, map[string]string{"version": version}))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, version)
+	}
+
+	// A cluster-desc failing the checks of renders, or with an invalid
+	// MAC, doesn't go live either.
+	b, e := yaml.Marshal(clusterdesc.Cluster{
+		SystemdDropIns: map[string]clusterdesc.DropIn{"docker": {"Service": {"Restart": {"always"}}}},
+		Nodes:          []clusterdesc.Node{{MAC: "00:25:90:c0:f7:81"}},
+	})
+	candy.Must(e)
+	rr = do("PUT", "/cluster-desc", string(b), current("/cluster-desc"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"docker" is not a systemd unit name`)
+	rr = do("PUT", "/cluster-desc", `{"nodes": [{"mac": "00:25:90:c0:f7:81"}, {"mac": "00:25:90:c0:f7"}]}`, current("/cluster-desc"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cluster-desc 00:25:90:c0:f7:")
+}
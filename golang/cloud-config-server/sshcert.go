@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/topicai/candy"
+)
+
+const maxSSHPublicKeySize = 16 << 10
+
+// sshCertGrant is what an operator presenting a token to /ssh-cert
+// may get a certificate for.
+type sshCertGrant struct {
+	Identity   string
+	Principals []string
+}
+
+// readSSHCertTokens reads tokensFile, with lines like
+//
+//	<token> <identity> <principal>[,<principal>...]
+//
+// for example "9f8e... alice core,root", where lines starting with #
+// are comments, and returns the grants by token.
+func readSSHCertTokens(tokensFile string) (map[string]sshCertGrant, error) {
+	f, e := os.Open(tokensFile)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	grants := make(map[string]sshCertGrant)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		grants[fields[0]] = sshCertGrant{Identity: fields[1], Principals: strings.Split(fields[2], ",")}
+	}
+	return grants, s.Err()
+}
+
+// grantOf returns the grant of the bearer token of r, if any.
+func grantOf(r *http.Request, grants map[string]sshCertGrant) (sshCertGrant, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 {
+		return sshCertGrant{}, false
+	}
+	for t, g := range grants {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return g, true
+		}
+	}
+	return sshCertGrant{}, false
+}
+
+// makeSSHCertHandler generates a HTTP handler, which signs the SSH
+// public key POSTed by an operator with the SSH CA caKey into a user
+// certificate valid for ttl.  The operator authenticates with a
+// bearer token listed in tokensFile, which also determines the
+// identity and principals of the certificate, so nodes need no
+// authorized_keys for operators.
+func makeSSHCertHandler(caKey, tokensFile string, ttl time.Duration) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST an SSH public key", http.StatusMethodNotAllowed)
+			return
+		}
+		grants, err := readSSHCertTokens(tokensFile)
+		candy.Must(err)
+		g, ok := grantOf(r, grants)
+		if !ok {
+			glog.Warningf("Refused an SSH certificate to %s: invalid token", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "A valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+
+		pub, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSSHPublicKeySize))
+		candy.Must(err)
+		if !strings.HasPrefix(string(pub), "ssh-") && !strings.HasPrefix(string(pub), "ecdsa-") {
+			http.Error(w, "Not an SSH public key", http.StatusBadRequest)
+			return
+		}
+		crt, err := certgen.SignSSHUser(caKey, pub, g.Identity, g.Principals, ttl)
+		candy.Must(err)
+		glog.Infof("Issued an SSH certificate to %s from %s for %s, valid for %s", g.Identity, r.RemoteAddr, strings.Join(g.Principals, ","), ttl)
+		events.publish("cert.ssh-user", "", map[string]interface{}{"identity": g.Identity, "principals": g.Principals, "ttl": ttl.String()})
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(crt)
+	})
+}
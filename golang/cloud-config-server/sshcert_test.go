@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestSSHCertHandler(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	caKey := path.Join(dir, "ssh-ca")
+	certgen.GenerateSSHCA(caKey)
+	tokens := path.Join(dir, "tokens")
+	candy.Must(ioutil.WriteFile(tokens, []byte("# token identity principals\ns3cret alice core,root\n"), 0600))
+	userKey := path.Join(dir, "id_rsa")
+	certgen.Run("ssh-keygen", "-q", "-t", "rsa", "-b", "2048", "-N", "", "-f", userKey)
+	pub, e := ioutil.ReadFile(userKey + ".pub")
+	candy.Must(e)
+
+	h := makeSSHCertHandler(caKey, tokens, time.Hour)
+	post := func(token, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/ssh-cert", strings.NewReader(body))
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		h(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("", string(pub)).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("guess", string(pub)).Code)
+	assert.Equal(t, http.StatusBadRequest, post("s3cret", "hello").Code)
+
+	rr := post("s3cret", string(pub))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "ssh-rsa-cert-v01@openssh.com "))
+}
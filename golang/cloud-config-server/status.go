@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// incident is what last went wrong, without naming nodes, as /status
+// is public.
+type incident struct {
+	Time time.Time
+	What string
+}
+
+// clusterStatus is the coarse bring-up progress served by /status.
+type clusterStatus struct {
+	Nodes         int // Enlisted in cluster-desc and not quarantined.
+	Reported      int // Of Nodes, uploaded a first-boot report.
+	Ready         int // Of Reported, with no failed units.
+	Quarantined   int
+	ConfigVersion string
+	LastIncident  *incident
+	Freeze        *freeze // The change freeze in effect, without its author.
+}
+
+// readFirstBootReport tells if the node with the reports in dir
+// uploaded a first-boot report, and when, and if it lists failed
+// units, see /opt/bin/first-boot-report.
+func readFirstBootReport(dir string) (reported bool, modTime time.Time, failed bool) {
+	fn := path.Join(dir, firstBootReportFile)
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return false, time.Time{}, false
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return false, time.Time{}, false
+	}
+	i := bytes.Index(b, []byte("# failed units\n"))
+	return true, fi.ModTime(), i >= 0 && len(bytes.TrimSpace(b[i+len("# failed units\n"):])) > 0
+}
+
+func buildStatus(c *clusterdesc.Cluster, version, reportDir string, loop *bootLoop, z *freeze) clusterStatus {
+	s := clusterStatus{ConfigVersion: version}
+	if z != nil {
+		s.Freeze = &freeze{Reason: z.Reason, Until: z.Until}
+	}
+	if loop != nil {
+		s.LastIncident = &incident{Time: loop.Since, What: "A node was caught in a boot loop"}
+	}
+	for _, n := range c.Nodes {
+		if n.Quarantined() {
+			s.Quarantined++
+			continue
+		}
+		s.Nodes++
+		reported, t, failed := readFirstBootReport(path.Join(reportDir, n.Hostname()))
+		if !reported {
+			continue
+		}
+		s.Reported++
+		if !failed {
+			s.Ready++
+		} else if s.LastIncident == nil || t.After(s.LastIncident.Time) {
+			s.LastIncident = &incident{Time: t, What: "A node reported failed units on first boot"}
+		}
+	}
+	return s
+}
+
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="30">
+<title>Cluster bring-up</title>
+</head>
+<body>
+<h1>{{ .Ready }} of {{ .Nodes }} nodes ready</h1>
+<p>{{ .Reported }} reported first boot{{ if .Quarantined }}, {{ .Quarantined }} quarantined{{ end }}.</p>
+<p>Config version {{ .ConfigVersion }}</p>
+{{- with .Freeze }}
+<p>Changes are frozen until {{ .Until.Format "2006-01-02 15:04:05 MST" }}: {{ .Reason }}</p>
+{{- end }}
+{{- with .LastIncident }}
+<p>Last incident: {{ .What }}, {{ .Time.Format "2006-01-02 15:04:05 MST" }}</p>
+{{- end }}
+</body>
+</html>
+`))
+
+// makeStatusHandler generates a HTTP handler, which serves the
+// bring-up progress as a page for wallboards, or in JSON with
+// ?format=json.  It needs no authentication, so it tells only counts.
+func makeStatusHandler(clusterDescFile, ccTemplateDir, reportDir string, watchdog *bootLoopWatchdog, frozen *changeFreeze) http.HandlerFunc {
+	return makeSafeHandler(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cctemplate.LoadClusterDesc(clusterDescFile)
+		candy.Must(err)
+		version, err := cctemplate.ConfigVersion(ccTemplateDir, clusterDescFile)
+		candy.Must(err)
+		s := buildStatus(c, version, reportDir, watchdog.lastLoop(), frozen.current())
+
+		if strings.ToLower(r.URL.Query().Get("format")) == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			candy.Must(json.NewEncoder(w).Encode(s))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		candy.Must(statusPage.Execute(w, s))
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestBuildStatus(t *testing.T) {
+	reportDir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(reportDir)
+	report := func(host, content string) {
+		candy.Must(os.MkdirAll(path.Join(reportDir, host), 0755))
+		candy.Must(ioutil.WriteFile(path.Join(reportDir, host, firstBootReportFile), []byte(content), 0644))
+	}
+	report("00-00-00-00-00-01", "# units\nkubelet.service active\n# files\n# failed units\n")
+	report("00-00-00-00-00-02", "# units\nkubelet.service failed\n# files\n# failed units\n-- Logs begin\n")
+
+	c := &clusterdesc.Cluster{Nodes: []clusterdesc.Node{
+		{MAC: "00:00:00:00:00:01"},
+		{MAC: "00:00:00:00:00:02"},
+		{MAC: "00:00:00:00:00:03"},
+		{MAC: "00:00:00:00:00:04", Quarantine: "burn-in"},
+	}}
+	s := buildStatus(c, "0123456789ab", reportDir, nil, nil)
+	assert.Equal(t, 3, s.Nodes)
+	assert.Equal(t, 2, s.Reported)
+	assert.Equal(t, 1, s.Ready)
+	assert.Equal(t, 1, s.Quarantined)
+	assert.Equal(t, "0123456789ab", s.ConfigVersion)
+	if assert.NotNil(t, s.LastIncident) {
+		assert.Contains(t, s.LastIncident.What, "failed units")
+	}
+
+	// A later boot loop is the last incident.
+	s = buildStatus(c, "0123456789ab", reportDir, &bootLoop{MAC: "00:00:00:00:00:03", Since: time.Now().Add(time.Hour)}, nil)
+	assert.Contains(t, s.LastIncident.What, "boot loop")
+	assert.NotContains(t, s.LastIncident.What, "00:00:00:00:00:03")
+	assert.Nil(t, s.Freeze)
+
+	s = buildStatus(c, "0123456789ab", reportDir, nil, &freeze{Reason: "release", Until: time.Now().Add(time.Hour), Author: "alice"})
+	if assert.NotNil(t, s.Freeze) {
+		assert.Equal(t, "release", s.Freeze.Reason)
+		assert.Empty(t, s.Freeze.Author)
+	}
+}
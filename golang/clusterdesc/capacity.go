@@ -0,0 +1,99 @@
+package clusterdesc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// ipv4 parses s as an IPv4 address and returns it as an integer, so
+// addresses can be compared and counted.
+func ipv4(field, s string) (uint32, error) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("%s %q is not an IPv4 address", field, s)
+	}
+	return binary.BigEndian.Uint32(ip), nil
+}
+
+// CheckCapacity makes sure that the nodes enlisted in Nodes fit in
+// the network: the DHCP range [IPLow, IPHigh] lies in Subnet and has
+// room for every node without a fixed IP, fixed IPs are in Subnet,
+// outside of the DHCP range and not taken by another node or the
+// bootstrapper, and no two nodes share a MAC address, and thus a
+// hostname.  The network is not checked if any of Subnet, Netmask,
+// IPLow and IPHigh is unset, as sextant doesn't serve DHCP then.
+func (c *Cluster) CheckCapacity() error {
+	hostnames := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if _, e := net.ParseMAC(n.MAC); e != nil {
+			return fmt.Errorf("mac %q of a node is invalid: %v", n.MAC, e)
+		}
+		if hostnames[n.Hostname()] {
+			return fmt.Errorf("node %s is enlisted more than once", n.Hostname())
+		}
+		hostnames[n.Hostname()] = true
+	}
+
+	if len(c.Subnet) == 0 || len(c.Netmask) == 0 || len(c.IPLow) == 0 || len(c.IPHigh) == 0 {
+		return nil
+	}
+	subnet, e := ipv4("subnet", c.Subnet)
+	if e != nil {
+		return e
+	}
+	mask, e := ipv4("netmask", c.Netmask)
+	if e != nil {
+		return e
+	}
+	low, e := ipv4("iplow", c.IPLow)
+	if e != nil {
+		return e
+	}
+	high, e := ipv4("iphigh", c.IPHigh)
+	if e != nil {
+		return e
+	}
+	if low&mask != subnet || high&mask != subnet {
+		return fmt.Errorf("DHCP range %s-%s is not in subnet %s/%s", c.IPLow, c.IPHigh, c.Subnet, c.Netmask)
+	}
+	if low > high {
+		return fmt.Errorf("iplow %s is greater than iphigh %s", c.IPLow, c.IPHigh)
+	}
+
+	taken := make(map[uint32]string)
+	if len(c.Bootstrapper) > 0 {
+		bs, e := ipv4("bootstrapper", c.Bootstrapper)
+		if e != nil {
+			return e
+		}
+		taken[bs] = "the bootstrapper"
+	}
+
+	dynamic := uint32(0)
+	for _, n := range c.Nodes {
+		if len(n.IP) == 0 {
+			dynamic++
+			continue
+		}
+		ip, e := ipv4("ip of node "+n.Hostname(), n.IP)
+		if e != nil {
+			return e
+		}
+		if ip&mask != subnet {
+			return fmt.Errorf("ip %s of node %s is not in subnet %s/%s", n.IP, n.Hostname(), c.Subnet, c.Netmask)
+		}
+		if low <= ip && ip <= high {
+			return fmt.Errorf("ip %s of node %s is in the DHCP range %s-%s", n.IP, n.Hostname(), c.IPLow, c.IPHigh)
+		}
+		if owner, ok := taken[ip]; ok {
+			return fmt.Errorf("ip %s of node %s is taken by %s", n.IP, n.Hostname(), owner)
+		}
+		taken[ip] = "node " + n.Hostname()
+	}
+
+	if size := high - low + 1; dynamic > size {
+		return fmt.Errorf("DHCP range %s-%s has %d addresses, but %d nodes need one", c.IPLow, c.IPHigh, size, dynamic)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCapacity(t *testing.T) {
+	c := &Cluster{
+		Bootstrapper: "10.10.14.253",
+		Subnet:       "10.10.14.0",
+		Netmask:      "255.255.255.0",
+		IPLow:        "10.10.14.1",
+		IPHigh:       "10.10.14.2",
+		Nodes: []Node{
+			{MAC: "00:25:90:c0:f7:80", IP: "10.10.14.200"},
+			{MAC: "0c:c4:7a:82:c5:bc"},
+			{MAC: "0c:c4:7a:82:c5:b8"},
+		},
+	}
+	assert.Nil(t, c.CheckCapacity())
+
+	c.Nodes = append(c.Nodes, Node{MAC: "00:25:90:c0:f6:ee"})
+	assert.NotNil(t, c.CheckCapacity()) // DHCP range exhausted
+
+	c.Nodes[3].IP = "10.10.14.253"
+	assert.NotNil(t, c.CheckCapacity()) // taken by the bootstrapper
+
+	c.Nodes[3].IP = "10.10.14.2"
+	assert.NotNil(t, c.CheckCapacity()) // in the DHCP range
+
+	c.Nodes[3].IP = "10.10.15.2"
+	assert.NotNil(t, c.CheckCapacity()) // out of subnet
+
+	c.Nodes[3] = Node{MAC: "0c:c4:7a:82:c5:b8", IP: "10.10.14.201"}
+	assert.NotNil(t, c.CheckCapacity()) // duplicated MAC
+
+	c.Nodes[3] = Node{MAC: "00:25:90:c0:f6:ee", IP: "10.10.14.201"}
+	assert.Nil(t, c.CheckCapacity())
+
+	c.Nodes[3] = Node{MAC: "00:25:90:c0:f6"}
+	assert.NotNil(t, c.CheckCapacity()) // invalid MAC
+
+	// Without a DHCP range, only the nodes are checked.
+	c.Nodes = c.Nodes[:3]
+	c.IPLow, c.IPHigh = "", ""
+	assert.Nil(t, c.CheckCapacity())
+	c.Nodes = append(c.Nodes, Node{MAC: "0c:c4:7a:82:c5:b8"})
+	assert.NotNil(t, c.CheckCapacity())
+}
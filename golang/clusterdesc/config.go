@@ -35,6 +35,10 @@ type Cluster struct {
 	IPLow, IPHigh       string // The IP address range of woker nodes.
 	Nodes               []Node // Enlist nodes that run Kubernetes/etcd/Ceph masters.
 
+	// MaxMastersPerRack limits how many Kubernetes masters may
+	// share one Node.Rack.  Zero means no limit.
+	MaxMastersPerRack int `yaml:"max_masters_per_rack"`
+
 	CoreOSChannel string `yaml:"coreos_channel"`
 
 	NginxRootDir string `yaml:"nginx_root_dir"`
@@ -56,6 +60,59 @@ type Cluster struct {
 	DNSMASQSetNTP            bool     `yaml:"set_ntp"`
 	DNSMASQLease             string   `yaml:"lease"`
 	CentOSYumRepo            string   `yaml:"set_yum_repo"`
+
+	// GPU drivers are proprietary; they are linked into the
+	// config of nodes with Node.GPU only once their license has
+	// been accepted for this cluster.
+	GPUDriversLicenseAccepted bool `yaml:"gpu_drivers_license_accepted"`
+
+	// KubernetesVersion, like 1.6 or v1.6.4, selects the flags
+	// rendered into the configs, see CheckKubernetesVersion.
+	KubernetesVersion string `yaml:"kubernetes_version"`
+
+	// ExternalURL, like http://pxe.example.com:8080, is how nodes
+	// reach the bootstrapper if it sits behind a NAT or a load
+	// balancer.  It defaults to http://<Bootstrapper>.
+	ExternalURL string `yaml:"external_url"`
+
+	// K8sPodNetwork is the flannel network pods get their IPs
+	// from, K8sNodePortRange, like 30000-32767, the range of
+	// NodePort services, and KubeProxyMode the --proxy-mode of
+	// kube-proxy.  See CheckNetworks.
+	K8sPodNetwork    string `yaml:"k8s_pod_network"`
+	K8sNodePortRange string `yaml:"k8s_service_node_port_range"`
+	KubeProxyMode    string `yaml:"kube_proxy_mode"`
+
+	// ImageDigests pins Images, by the same keys, to digests like
+	// sha256:..., as printed by pin-images, so every node runs the
+	// same image even if its tag is moved.  See PinnedImages.
+	ImageDigests map[string]string `yaml:"image_digests"`
+
+	// Firewall, if enabled, drops traffic to ports nodes don't
+	// need open.  See FirewallPorts.
+	Firewall Firewall
+
+	// SystemdDropIns override options of systemd units on all
+	// nodes, by unit name, so site tweaks don't need copies of
+	// whole units in the templates.  See DropIns.
+	SystemdDropIns map[string]DropIn `yaml:"systemd_dropins"`
+
+	// MinSextantVersion, like 1.1, if not empty, is the oldest
+	// sextant which supports what this cluster-desc uses.  See
+	// CheckMinSextantVersion.
+	MinSextantVersion string `yaml:"min_sextant_version"`
+
+	// KubeReserved and SystemReserved, like cpu=500m,memory=1Gi,
+	// override the --kube-reserved and --system-reserved of
+	// kubelets computed from the hardware of nodes.  See
+	// Reservations.
+	KubeReserved   string `yaml:"kube_reserved"`
+	SystemReserved string `yaml:"system_reserved"`
+
+	// Sysctl sets kernel parameters on nodes, by role like
+	// Firewall.AllowedPorts, over a default profile.  See Sysctls.
+	Sysctl map[string]map[string]string
+	Swap   Swap
 }
 
 // CoreOS defines the system related operations, such as: system updates.
@@ -80,11 +137,36 @@ type Ceph struct {
 // Cluster.IPLow and Cluster.IPHigh.
 type Node struct {
 	MAC          string
+	IP           string // Fixed IP bound to MAC by DHCP, optional.
 	IngressLabel bool
 	CephMonitor  bool   `yaml:"ceph_monitor"`
 	KubeMaster   bool   `yaml:"kube_master"`
 	EtcdMember   bool   `yaml:"etcd_member"`
 	FlannelIface string `yaml:"flannel_iface"`
+	Rack         string // The failure domain of the node, optional.
+	GPU          bool   // The node needs GPU drivers installed.
+
+	// Quarantine, if not empty, is the reason why the node failed
+	// attestation or burn-in.  A quarantined node boots a
+	// diagnostic profile and takes no role in the cluster until an
+	// admin releases it by removing the reason.
+	Quarantine string
+
+	// SystemdDropIns override those of the cluster for this node.
+	SystemdDropIns map[string]DropIn `yaml:"systemd_dropins"`
+
+	// Hardware declares the CPUs and memory of the node, until they
+	// are collected by its first-boot report.
+	Hardware Hardware
+
+	// KubeReserved and SystemReserved override those of the cluster
+	// for this node.
+	KubeReserved   string `yaml:"kube_reserved"`
+	SystemReserved string `yaml:"system_reserved"`
+
+	// Sysctl overrides the kernel parameters of the cluster for
+	// this node.
+	Sysctl map[string]string
 }
 
 // Join is defined as a method of Cluster, so can be called in
@@ -93,17 +175,76 @@ func (c Cluster) Join(s []string) string {
 	return strings.Join(s, ", ")
 }
 
+// BootstrapperURL returns the URL prefix, without the trailing slash,
+// which nodes use to fetch configs and files from the bootstrapper.
+func (c Cluster) BootstrapperURL() string {
+	if len(c.ExternalURL) > 0 {
+		return strings.TrimSuffix(c.ExternalURL, "/")
+	}
+	return "http://" + c.Bootstrapper
+}
+
+// BootstrapperHTTPSPort is the port the bootstrapper serves https
+// on, with the certificate of the bootstrapper signed by the sextant
+// CA, see docker/entrypoint.sh.
+const BootstrapperHTTPSPort = "8443"
+
+// BootstrapperHTTPSURL returns the URL prefix, without the trailing
+// slash, which nodes use to fetch what they must verify came from the
+// bootstrapper, like the CA bundle: ExternalURL if it is https, or
+// Dockerdomain, which the certificate of the bootstrapper is issued
+// for, as for the Docker registry.
+func (c Cluster) BootstrapperHTTPSURL() string {
+	if strings.HasPrefix(c.ExternalURL, "https://") {
+		return strings.TrimSuffix(c.ExternalURL, "/")
+	}
+	return "https://" + c.Dockerdomain + ":" + BootstrapperHTTPSPort
+}
+
+// PinnedImages returns Images, with those that have a digest in
+// ImageDigests referenced by the digest instead of the tag.
+func (c Cluster) PinnedImages() map[string]string {
+	images := make(map[string]string, len(c.Images))
+	for k, image := range c.Images {
+		images[k] = image
+		if d, ok := c.ImageDigests[k]; ok && len(d) > 0 {
+			images[k] = ImageRepository(image) + "@" + d
+		}
+	}
+	return images
+}
+
+// ImageRepository returns image, like pineking/hyperkube-amd64:2169be,
+// without the tag or digest.
+func ImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash starts the tag; one before is a
+	// registry port.
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
 // GetIngressReplicas return replica number of the ingress node
 func (c Cluster) GetIngressReplicas() int {
 	var cnt = 0
 	for _, n := range c.Nodes {
-		if n.IngressLabel {
+		if n.IngressLabel && !n.Quarantined() {
 			cnt++
 		}
 	}
 	return cnt
 }
 
+// Quarantined is defined as a method of Node, so can be called in
+// templates.
+func (n Node) Quarantined() bool {
+	return len(n.Quarantine) > 0
+}
+
 // Hostname is defined as a method of Node, so can be call in
 // template.  For more details, refer to const tmplDHCPConf.
 func (n Node) Hostname() string {
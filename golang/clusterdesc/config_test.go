@@ -5,6 +5,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/topicai/candy"
 	"gopkg.in/yaml.v2"
 )
@@ -16,3 +17,31 @@ func TestDefaultValues(t *testing.T) {
 	candy.Must(yaml.Unmarshal([]byte(clusterDescExample), c))
 
 }
+
+func TestBootstrapperURL(t *testing.T) {
+	c := &Cluster{Bootstrapper: "10.10.14.253", Dockerdomain: "bootstrapper"}
+	assert.Equal(t, "http://10.10.14.253", c.BootstrapperURL())
+	assert.Equal(t, "https://bootstrapper:8443", c.BootstrapperHTTPSURL())
+	c.ExternalURL = "https://pxe.example.com:8443/"
+	assert.Equal(t, "https://pxe.example.com:8443", c.BootstrapperURL())
+	assert.Equal(t, "https://pxe.example.com:8443", c.BootstrapperHTTPSURL())
+}
+
+func TestPinnedImages(t *testing.T) {
+	c := Cluster{
+		Images: map[string]string{
+			"hyperkube": "pineking/hyperkube-amd64:2169be",
+			"ntp":       "redaphid/docker-ntp-server",
+			"pause":     "localhost:5000/pause-amd64:3.0",
+		},
+		ImageDigests: map[string]string{"hyperkube": "sha256:ab", "ntp": "sha256:cd", "pause": "sha256:ef"},
+	}
+	assert.Equal(t, map[string]string{
+		"hyperkube": "pineking/hyperkube-amd64@sha256:ab",
+		"ntp":       "redaphid/docker-ntp-server@sha256:cd",
+		"pause":     "localhost:5000/pause-amd64@sha256:ef",
+	}, c.PinnedImages())
+
+	c.ImageDigests = nil
+	assert.Equal(t, c.Images, c.PinnedImages())
+}
@@ -0,0 +1,24 @@
+package clusterdesc
+
+// Deprecation is a construct of cluster-desc or of the templates,
+// which still works, but is going to be removed.
+type Deprecation struct {
+	Construct string
+	Advice    string
+}
+
+// Deprecations returns the deprecated constructs of c that the config
+// of n is rendered from.  Quarantined nodes use none of them.
+func (c Cluster) Deprecations(n Node) []Deprecation {
+	var d []Deprecation
+	if n.Quarantined() {
+		return d
+	}
+	if c.kubernetesMinor() == "1.5" {
+		d = append(d, Deprecation{"kubernetes_version: " + c.KubernetesVersion, "Kubernetes 1.5 lacks the GPU feature gate and will no longer be rendered; use 1.6 or 1.7."})
+	}
+	if c.FlannelBackend == "udp" {
+		d = append(d, Deprecation{"flannel_backend: udp", "The udp backend is for debugging only and will be removed by flannel; use vxlan or host-gw."})
+	}
+	return d
+}
@@ -0,0 +1,20 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecations(t *testing.T) {
+	c := Cluster{KubernetesVersion: "v1.6.4", FlannelBackend: "vxlan"}
+	assert.Empty(t, c.Deprecations(Node{}))
+
+	c = Cluster{KubernetesVersion: "1.5", FlannelBackend: "udp"}
+	d := c.Deprecations(Node{})
+	if assert.Len(t, d, 2) {
+		assert.Equal(t, "kubernetes_version: 1.5", d[0].Construct)
+		assert.Equal(t, "flannel_backend: udp", d[1].Construct)
+	}
+	assert.Empty(t, c.Deprecations(Node{Quarantine: "burn-in"}))
+}
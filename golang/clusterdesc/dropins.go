@@ -0,0 +1,130 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DropIn overrides options of a systemd unit, by section and key.
+// Every value of a key becomes a line Key=value, so a key can be
+// reset before it is set again, like ExecStart: ["", "/usr/bin/foo"].
+type DropIn map[string]map[string][]string
+
+// UnitDropIn is the drop-in of Unit, rendered into Lines, as written
+// to /etc/systemd/system/<Unit>.d/50-sextant.conf.
+type UnitDropIn struct {
+	Unit  string
+	Lines []string
+}
+
+var (
+	unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+\.(service|socket|timer|mount|path|slice|target)$`)
+	unitKeyPattern  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+	dropInSections  = map[string]bool{"Unit": true, "Service": true, "Install": true, "Socket": true, "Timer": true, "Mount": true, "Path": true, "Slice": true}
+)
+
+// mergeDropIns returns the drop-ins of Cluster.SystemdDropIns, with
+// the keys in Node.SystemdDropIns replacing those of the cluster.
+func mergeDropIns(cluster, node map[string]DropIn) map[string]DropIn {
+	merged := make(map[string]DropIn)
+	for _, m := range []map[string]DropIn{cluster, node} {
+		for unit, d := range m {
+			if merged[unit] == nil {
+				merged[unit] = make(DropIn)
+			}
+			for section, keys := range d {
+				if merged[unit][section] == nil {
+					merged[unit][section] = make(map[string][]string)
+				}
+				for k, v := range keys {
+					merged[unit][section][k] = v
+				}
+			}
+		}
+	}
+	return merged
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]DropIn:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case DropIn:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string][]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DropIns returns the systemd drop-ins of n, sorted by unit, with
+// sections and keys sorted too, so renders are stable.
+func (c Cluster) DropIns(n Node) []UnitDropIn {
+	merged := mergeDropIns(c.SystemdDropIns, n.SystemdDropIns)
+	var dropIns []UnitDropIn
+	for _, unit := range sortedKeys(merged) {
+		d := UnitDropIn{Unit: unit}
+		for _, section := range sortedKeys(merged[unit]) {
+			if len(d.Lines) > 0 {
+				d.Lines = append(d.Lines, "")
+			}
+			d.Lines = append(d.Lines, "["+section+"]")
+			keys := merged[unit][section]
+			for _, k := range sortedKeys(keys) {
+				for _, v := range keys[k] {
+					d.Lines = append(d.Lines, k+"="+v)
+				}
+			}
+		}
+		dropIns = append(dropIns, d)
+	}
+	return dropIns
+}
+
+func checkDropIns(where string, dropIns map[string]DropIn) error {
+	for unit, d := range dropIns {
+		if !unitNamePattern.MatchString(unit) {
+			return fmt.Errorf("%s: %q is not a systemd unit name", where, unit)
+		}
+		for section, keys := range d {
+			if !dropInSections[section] {
+				return fmt.Errorf("%s: %s has unknown section [%s]", where, unit, section)
+			}
+			for k, values := range keys {
+				if !unitKeyPattern.MatchString(k) {
+					return fmt.Errorf("%s: %s [%s] has invalid key %q", where, unit, section, k)
+				}
+				for _, v := range values {
+					if strings.ContainsAny(v, "\r\n") {
+						return fmt.Errorf("%s: %s [%s] %s has a multi-line value", where, unit, section, k)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckSystemdDropIns validates the drop-ins of the cluster and of
+// every node.
+func (c Cluster) CheckSystemdDropIns() error {
+	if e := checkDropIns("systemd_dropins", c.SystemdDropIns); e != nil {
+		return e
+	}
+	for _, n := range c.Nodes {
+		if e := checkDropIns(n.MAC+" systemd_dropins", n.SystemdDropIns); e != nil {
+			return e
+		}
+	}
+	return nil
+}
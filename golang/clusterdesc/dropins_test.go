@@ -0,0 +1,57 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropIns(t *testing.T) {
+	c := Cluster{
+		SystemdDropIns: map[string]DropIn{
+			"docker.service": {
+				"Service": {
+					"Environment": {"HTTP_PROXY=http://proxy:3128", "NO_PROXY=localhost"},
+					"LimitNOFILE": {"1048576"},
+				},
+			},
+		},
+		Nodes: []Node{{
+			MAC: "00:25:90:c0:f7:80",
+			SystemdDropIns: map[string]DropIn{
+				"docker.service":  {"Service": {"LimitNOFILE": {"65536"}}},
+				"kubelet.service": {"Unit": {"After": {"docker.service"}}, "Service": {"ExecStart": {"", "/opt/bin/kubelet"}}},
+			},
+		}},
+	}
+	assert.Nil(t, c.CheckSystemdDropIns())
+
+	assert.Equal(t, []UnitDropIn{{
+		Unit:  "docker.service",
+		Lines: []string{"[Service]", "Environment=HTTP_PROXY=http://proxy:3128", "Environment=NO_PROXY=localhost", "LimitNOFILE=1048576"},
+	}}, c.DropIns(Node{}))
+
+	assert.Equal(t, []UnitDropIn{{
+		Unit:  "docker.service",
+		Lines: []string{"[Service]", "Environment=HTTP_PROXY=http://proxy:3128", "Environment=NO_PROXY=localhost", "LimitNOFILE=65536"},
+	}, {
+		Unit:  "kubelet.service",
+		Lines: []string{"[Service]", "ExecStart=", "ExecStart=/opt/bin/kubelet", "", "[Unit]", "After=docker.service"},
+	}}, c.DropIns(c.Nodes[0]))
+
+	// The node's drop-ins don't leak into the cluster's.
+	assert.Equal(t, []string{"1048576"}, c.SystemdDropIns["docker.service"]["Service"]["LimitNOFILE"])
+}
+
+func TestCheckSystemdDropIns(t *testing.T) {
+	for _, d := range []map[string]DropIn{
+		{"docker": {"Service": {"LimitNOFILE": {"1"}}}},
+		{"../docker.service": {"Service": {"LimitNOFILE": {"1"}}}},
+		{"docker.service": {"service": {"LimitNOFILE": {"1"}}}},
+		{"docker.service": {"Service": {"Limit NOFILE": {"1"}}}},
+		{"docker.service": {"Service": {"ExecStartPre": {"/bin/true\nExecStart=/bin/sh"}}}},
+	} {
+		assert.NotNil(t, Cluster{SystemdDropIns: d}.CheckSystemdDropIns())
+		assert.NotNil(t, Cluster{Nodes: []Node{{MAC: "00:25:90:c0:f7:80", SystemdDropIns: d}}}.CheckSystemdDropIns())
+	}
+}
@@ -6,10 +6,13 @@ import (
 )
 
 // SelectNodes input node role condition,
-// ouptut hostname range
+// ouptut hostname range.  Quarantined nodes are never selected.
 func (c *Cluster) SelectNodes(f func(n *Node) string) string {
 	var ret []string
 	for i := range c.Nodes {
+		if c.Nodes[i].Quarantined() {
+			continue
+		}
 		t := f(&(c.Nodes[i]))
 		if len(t) > 0 {
 			ret = append(ret, t)
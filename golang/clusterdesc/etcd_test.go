@@ -5,6 +5,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/topicai/candy"
 	"gopkg.in/yaml.v2"
 )
@@ -26,3 +27,13 @@ func TestGetEtcdMachines(t *testing.T) {
 	candy.Must(e)
 	candy.Must(yaml.Unmarshal([]byte(clusterDescExample), c))
 }
+
+func TestSelectNodesSkipsQuarantined(t *testing.T) {
+	c := &Cluster{
+		Nodes: []Node{
+			{MAC: "00:25:90:c0:f7:80", EtcdMember: true},
+			{MAC: "0c:c4:7a:82:c5:bc", EtcdMember: true, Quarantine: "attestation failed"},
+		},
+	}
+	assert.Equal(t, "http://00-25-90-c0-f7-80:2379", c.GetEtcdMachines())
+}
@@ -0,0 +1,31 @@
+package clusterdesc
+
+import "fmt"
+
+// CheckFailureDomains makes sure that the roles declared in Nodes are
+// spread over failure domains, as given by Node.Rack: no two etcd
+// members may share a rack, and no rack may hold more than
+// MaxMastersPerRack Kubernetes masters.  Nodes without a rack, and
+// quarantined nodes, which serve no role, are not checked.
+func (c *Cluster) CheckFailureDomains() error {
+	etcdMembers := make(map[string]string)
+	masters := make(map[string]int)
+	for _, n := range c.Nodes {
+		if len(n.Rack) == 0 || n.Quarantined() {
+			continue
+		}
+		if n.EtcdMember {
+			if other, ok := etcdMembers[n.Rack]; ok {
+				return fmt.Errorf("etcd members %s and %s are both in rack %s", other, n.Hostname(), n.Rack)
+			}
+			etcdMembers[n.Rack] = n.Hostname()
+		}
+		if n.KubeMaster {
+			masters[n.Rack]++
+			if c.MaxMastersPerRack > 0 && masters[n.Rack] > c.MaxMastersPerRack {
+				return fmt.Errorf("rack %s has more than %d kube masters", n.Rack, c.MaxMastersPerRack)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFailureDomains(t *testing.T) {
+	c := &Cluster{
+		MaxMastersPerRack: 1,
+		Nodes: []Node{
+			{MAC: "00:25:90:c0:f7:80", EtcdMember: true, KubeMaster: true, Rack: "r1"},
+			{MAC: "0c:c4:7a:82:c5:bc", EtcdMember: true, Rack: "r2"},
+			{MAC: "0c:c4:7a:82:c5:b8", EtcdMember: true},
+		},
+	}
+	assert.Nil(t, c.CheckFailureDomains())
+
+	c.Nodes[1].Rack = "r1"
+	assert.NotNil(t, c.CheckFailureDomains())
+
+	c.Nodes[1].Rack = "r2"
+	c.Nodes = append(c.Nodes, Node{MAC: "00:25:90:c0:f6:ee", KubeMaster: true, Rack: "r1"})
+	assert.NotNil(t, c.CheckFailureDomains())
+
+	// A quarantined node doesn't count against its rack.
+	c.Nodes[3].Quarantine = "bad DIMM"
+	assert.Nil(t, c.CheckFailureDomains())
+	c.Nodes[3].Quarantine = ""
+
+	c.MaxMastersPerRack = 0
+	assert.Nil(t, c.CheckFailureDomains())
+}
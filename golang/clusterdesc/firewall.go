@@ -0,0 +1,160 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Firewall configures the iptables rules rendered into every node.
+// Traffic from ManagementCIDRs, the node subnet and the pod network is
+// accepted; from elsewhere, only to the ports a node needs for its
+// roles and the ports in AllowedPorts for those roles.  Keys of
+// AllowedPorts are all, master, worker, etcd, ingress and
+// ceph_monitor; ports are like 9100/tcp or 6800-7300/tcp.
+type Firewall struct {
+	Enabled         bool
+	ManagementCIDRs []string            `yaml:"management_cidrs"`
+	AllowedPorts    map[string][]string `yaml:"allowed_ports"`
+}
+
+// FirewallPort is a port, or a range like 6800:7300, in the form
+// iptables --dport takes it.
+type FirewallPort struct {
+	Proto string
+	Port  string
+}
+
+var firewallRoles = map[string]bool{"all": true, "master": true, "worker": true, "etcd": true, "ingress": true, "ceph_monitor": true}
+
+// firewallRolesOf returns the keys of Firewall.AllowedPorts that
+// apply to n.
+func firewallRolesOf(n Node) []string {
+	roles := []string{"all"}
+	if n.KubeMaster {
+		roles = append(roles, "master")
+	} else {
+		roles = append(roles, "worker")
+	}
+	if n.EtcdMember {
+		roles = append(roles, "etcd")
+	}
+	if n.IngressLabel {
+		roles = append(roles, "ingress")
+	}
+	if n.CephMonitor {
+		roles = append(roles, "ceph_monitor")
+	}
+	return roles
+}
+
+// requiredPorts returns the ports the cluster components on n listen
+// to for other nodes, so they are never blocked by mistake.  SSH is
+// always open, so a wrong firewall config doesn't lock admins out.
+func (c Cluster) requiredPorts(n Node) []string {
+	ports := []string{"22/tcp", "10250/tcp", "8472/udp", "8285/udp"}
+	nodePorts := "30000-32767"
+	if len(c.K8sNodePortRange) > 0 {
+		nodePorts = c.K8sNodePortRange
+	}
+	ports = append(ports, nodePorts+"/tcp")
+	if n.KubeMaster {
+		ports = append(ports, "443/tcp", "8080/tcp")
+	}
+	if n.EtcdMember {
+		ports = append(ports, "2379/tcp", "2380/tcp", "4001/tcp")
+	}
+	if n.IngressLabel && c.IngressHostNetwork {
+		ports = append(ports, "80/tcp", "443/tcp")
+	}
+	if n.CephMonitor {
+		ports = append(ports, "6789/tcp")
+	}
+	if c.Ceph.ZapAndStartOSD {
+		ports = append(ports, "6800-7300/tcp")
+	}
+	return ports
+}
+
+func parseFirewallPort(s string) (FirewallPort, error) {
+	p := strings.Split(s, "/")
+	if len(p) != 2 || (p[1] != "tcp" && p[1] != "udp") {
+		return FirewallPort{}, fmt.Errorf("firewall port %q is not like 9100/tcp", s)
+	}
+	r := strings.Split(p[0], "-")
+	for _, n := range r {
+		if i, e := strconv.Atoi(n); e != nil || i < 1 || i > 65535 || len(r) > 2 {
+			return FirewallPort{}, fmt.Errorf("firewall port %q is not like 9100/tcp or 6800-7300/tcp", s)
+		}
+	}
+	return FirewallPort{Proto: p[1], Port: strings.Join(r, ":")}, nil
+}
+
+// FirewallPorts returns the ports open on n to hosts outside of the
+// cluster and the management networks, or an error if a port is
+// invalid, see CheckFirewall.
+func (c Cluster) FirewallPorts(n Node) ([]FirewallPort, error) {
+	specs := c.requiredPorts(n)
+	for _, r := range firewallRolesOf(n) {
+		specs = append(specs, c.Firewall.AllowedPorts[r]...)
+	}
+	seen := make(map[FirewallPort]bool)
+	var ports []FirewallPort
+	for _, s := range specs {
+		p, e := parseFirewallPort(s)
+		if e != nil {
+			return nil, e
+		}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Proto != ports[j].Proto {
+			return ports[i].Proto < ports[j].Proto
+		}
+		return ports[i].Port < ports[j].Port
+	})
+	return ports, nil
+}
+
+// FirewallTrustedCIDRs returns the networks from which all traffic
+// is accepted: the management networks, the node subnet and the pod
+// network.
+func (c Cluster) FirewallTrustedCIDRs() []string {
+	cidrs := append([]string{}, c.Firewall.ManagementCIDRs...)
+	if subnet := c.SubnetCIDR(); len(subnet) > 0 {
+		cidrs = append(cidrs, subnet)
+	}
+	return append(cidrs, c.PodNetwork())
+}
+
+// CheckFirewall validates Firewall, and the ports the nodes need, like
+// k8s_service_node_port_range.
+func (c *Cluster) CheckFirewall() error {
+	all := Node{KubeMaster: true, EtcdMember: true, IngressLabel: true, CephMonitor: true}
+	for _, p := range c.requiredPorts(all) {
+		if _, e := parseFirewallPort(p); e != nil {
+			return e
+		}
+	}
+	for _, cidr := range c.Firewall.ManagementCIDRs {
+		if _, _, e := net.ParseCIDR(cidr); e != nil {
+			return fmt.Errorf("firewall management_cidrs %q is not a CIDR", cidr)
+		}
+	}
+	for role, ports := range c.Firewall.AllowedPorts {
+		if !firewallRoles[role] {
+			return fmt.Errorf("firewall allowed_ports has unknown role %q", role)
+		}
+		for _, p := range ports {
+			if _, e := parseFirewallPort(p); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirewallPorts(t *testing.T) {
+	c := Cluster{
+		Subnet:  "10.10.14.0",
+		Netmask: "255.255.255.0",
+		Firewall: Firewall{
+			Enabled:         true,
+			ManagementCIDRs: []string{"192.168.0.0/16"},
+			AllowedPorts: map[string][]string{
+				"all":    {"9100/tcp"},
+				"master": {"443/tcp", "6443/tcp"},
+			},
+		},
+	}
+	has := func(ports []FirewallPort, p FirewallPort) bool {
+		for _, q := range ports {
+			if q == p {
+				return true
+			}
+		}
+		return false
+	}
+
+	master, e := c.FirewallPorts(Node{KubeMaster: true, EtcdMember: true})
+	assert.Nil(t, e)
+	for _, p := range []FirewallPort{{"tcp", "22"}, {"tcp", "443"}, {"tcp", "6443"}, {"tcp", "2379"}, {"tcp", "9100"}, {"udp", "8472"}, {"tcp", "30000:32767"}} {
+		assert.True(t, has(master, p), p.Port)
+	}
+	n := 0
+	for _, p := range master {
+		if p.Port == "443" {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n)
+
+	worker, e := c.FirewallPorts(Node{})
+	assert.Nil(t, e)
+	assert.True(t, has(worker, FirewallPort{"tcp", "9100"}))
+	assert.False(t, has(worker, FirewallPort{"tcp", "6443"}))
+	assert.False(t, has(worker, FirewallPort{"tcp", "2379"}))
+
+	assert.Equal(t, []string{"192.168.0.0/16", "10.10.14.0/24", DefaultPodNetwork}, c.FirewallTrustedCIDRs())
+}
+
+func TestCheckFirewall(t *testing.T) {
+	c := &Cluster{Firewall: Firewall{
+		ManagementCIDRs: []string{"192.168.0.0/16"},
+		AllowedPorts:    map[string][]string{"ingress": {"8443/tcp", "6800-7300/tcp"}},
+	}}
+	assert.Nil(t, c.CheckFirewall())
+
+	c.Firewall.ManagementCIDRs = []string{"192.168.0.0"}
+	assert.Contains(t, c.CheckFirewall().Error(), "management_cidrs")
+
+	c.Firewall.ManagementCIDRs = nil
+	for _, p := range []string{"8443", "8443/icmp", "0/tcp", "1-2-3/tcp", "x/udp"} {
+		c.Firewall.AllowedPorts = map[string][]string{"all": {p}}
+		assert.NotNil(t, c.CheckFirewall(), p)
+		_, e := c.FirewallPorts(Node{})
+		assert.NotNil(t, e, p)
+	}
+
+	c.Firewall.AllowedPorts = nil
+	c.K8sNodePortRange = "30000:32767"
+	assert.NotNil(t, c.CheckFirewall())
+	c.K8sNodePortRange = ""
+
+	c.Firewall.AllowedPorts = map[string][]string{"gateway": {"80/tcp"}}
+	assert.Contains(t, c.CheckFirewall().Error(), "unknown role")
+}
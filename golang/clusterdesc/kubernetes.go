@@ -0,0 +1,74 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultKubernetesVersion is used if cluster-desc doesn't specify
+// kubernetes_version.  It is the version of the kubelet bsroot.sh
+// downloads.
+const DefaultKubernetesVersion = "1.6"
+
+// KubernetesFeatures describes how the templates have to differ for
+// a Kubernetes minor version.
+type KubernetesFeatures struct {
+	// AcceleratorsGate tells if kubelet knows the Accelerators
+	// feature gate, which exposes GPUs to pods.
+	AcceleratorsGate bool
+	// StorageBackend is the --storage-backend of the apiserver, or
+	// empty if its default, etcd2, fits.  From 1.6 on, the default
+	// is etcd3, but the etcd members of the templates run etcd2.
+	StorageBackend string
+	// DeploymentAPIVersion is the apiVersion of the Deployments in
+	// the addon manifests.  apps/v1beta1 replaced
+	// extensions/v1beta1 in 1.6.
+	DeploymentAPIVersion string
+}
+
+// kubernetesVersions is the matrix of Kubernetes minor versions the
+// templates support.  Versions from 1.8 on are missing, as kubelet
+// dropped --api-servers, which the templates rely on.
+var kubernetesVersions = map[string]KubernetesFeatures{
+	"1.5": {AcceleratorsGate: false, DeploymentAPIVersion: "extensions/v1beta1"},
+	"1.6": {AcceleratorsGate: true, StorageBackend: "etcd2", DeploymentAPIVersion: "apps/v1beta1"},
+	"1.7": {AcceleratorsGate: true, StorageBackend: "etcd2", DeploymentAPIVersion: "apps/v1beta1"},
+}
+
+// kubernetesMinor returns the minor version, like 1.6, of
+// KubernetesVersion, which may also be a patch version like v1.6.4.
+func (c Cluster) kubernetesMinor() string {
+	if len(c.KubernetesVersion) == 0 {
+		return DefaultKubernetesVersion
+	}
+	v := strings.Split(strings.TrimPrefix(c.KubernetesVersion, "v"), ".")
+	if len(v) < 2 {
+		return c.KubernetesVersion
+	}
+	return v[0] + "." + v[1]
+}
+
+// CheckKubernetesVersion returns an error if the templates don't
+// support KubernetesVersion.
+func (c Cluster) CheckKubernetesVersion() error {
+	if _, ok := kubernetesVersions[c.kubernetesMinor()]; !ok {
+		var supported []string
+		for v := range kubernetesVersions {
+			supported = append(supported, v)
+		}
+		sort.Strings(supported)
+		return fmt.Errorf("kubernetes_version %s is not supported, use one of %s",
+			c.KubernetesVersion, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// Kubernetes returns the features of KubernetesVersion, or of
+// DefaultKubernetesVersion if it is not supported.
+func (c Cluster) Kubernetes() KubernetesFeatures {
+	if f, ok := kubernetesVersions[c.kubernetesMinor()]; ok {
+		return f
+	}
+	return kubernetesVersions[DefaultKubernetesVersion]
+}
@@ -0,0 +1,24 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubernetesVersion(t *testing.T) {
+	c := Cluster{}
+	assert.Nil(t, c.CheckKubernetesVersion())
+	assert.True(t, c.Kubernetes().AcceleratorsGate)
+	assert.Equal(t, "etcd2", c.Kubernetes().StorageBackend)
+	assert.Equal(t, "apps/v1beta1", c.Kubernetes().DeploymentAPIVersion)
+
+	c.KubernetesVersion = "v1.5.7"
+	assert.Nil(t, c.CheckKubernetesVersion())
+	assert.False(t, c.Kubernetes().AcceleratorsGate)
+	assert.Equal(t, "", c.Kubernetes().StorageBackend)
+	assert.Equal(t, "extensions/v1beta1", c.Kubernetes().DeploymentAPIVersion)
+
+	c.KubernetesVersion = "1.9"
+	assert.NotNil(t, c.CheckKubernetesVersion())
+}
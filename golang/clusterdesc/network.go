@@ -0,0 +1,115 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPodNetwork is used if cluster-desc doesn't specify
+	// k8s_pod_network.
+	DefaultPodNetwork = "10.1.0.0/16"
+	// DefaultKubeProxyMode is used if cluster-desc doesn't specify
+	// kube_proxy_mode.
+	DefaultKubeProxyMode = "iptables"
+)
+
+// PodNetwork is defined as a method of Cluster, so can be called in
+// templates.
+func (c Cluster) PodNetwork() string {
+	if len(c.K8sPodNetwork) == 0 {
+		return DefaultPodNetwork
+	}
+	return c.K8sPodNetwork
+}
+
+// ProxyMode is defined as a method of Cluster, so can be called in
+// templates.
+func (c Cluster) ProxyMode() string {
+	if len(c.KubeProxyMode) == 0 {
+		return DefaultKubeProxyMode
+	}
+	return c.KubeProxyMode
+}
+
+// SubnetCIDR returns the node subnet, given by Subnet and Netmask,
+// like 192.168.2.0/24, or "" if either is missing.
+func (c Cluster) SubnetCIDR() string {
+	ip, mask := net.ParseIP(c.Subnet).To4(), net.ParseIP(c.Netmask).To4()
+	if ip == nil || mask == nil {
+		return ""
+	}
+	n := net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+	return n.String()
+}
+
+func overlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CheckNetworks makes sure that the pod network, the service IP
+// range and the node subnet don't overlap, that the cluster DNS is
+// a service IP, that the NodePort range is sane and that kube-proxy
+// supports KubeProxyMode.  Mismatches here would otherwise show up
+// only as networking failures long after the cluster is up.
+func (c *Cluster) CheckNetworks() error {
+	_, pods, e := net.ParseCIDR(c.PodNetwork())
+	if e != nil {
+		return fmt.Errorf("k8s_pod_network %q is not a CIDR", c.PodNetwork())
+	}
+	_, services, e := net.ParseCIDR(c.K8sServiceClusterIPRange)
+	if e != nil {
+		return fmt.Errorf("k8s_service_cluster_ip_range %q is not a CIDR", c.K8sServiceClusterIPRange)
+	}
+	if overlap(pods, services) {
+		return fmt.Errorf("k8s_pod_network %s overlaps k8s_service_cluster_ip_range %s", pods, services)
+	}
+
+	if ip, mask := net.ParseIP(c.Subnet), net.ParseIP(c.Netmask); ip != nil && mask != nil {
+		nodes := &net.IPNet{IP: ip.Mask(net.IPMask(mask.To4())), Mask: net.IPMask(mask.To4())}
+		if overlap(nodes, pods) {
+			return fmt.Errorf("k8s_pod_network %s overlaps the node subnet %s", pods, nodes)
+		}
+		if overlap(nodes, services) {
+			return fmt.Errorf("k8s_service_cluster_ip_range %s overlaps the node subnet %s", services, nodes)
+		}
+	}
+
+	if len(c.K8sClusterDNS) > 0 && !services.Contains(net.ParseIP(c.K8sClusterDNS)) {
+		return fmt.Errorf("k8s_cluster_dns %s is not in k8s_service_cluster_ip_range %s", c.K8sClusterDNS, services)
+	}
+
+	if len(c.K8sNodePortRange) > 0 {
+		r := strings.Split(c.K8sNodePortRange, "-")
+		if len(r) != 2 {
+			return fmt.Errorf("k8s_service_node_port_range %q is not like 30000-32767", c.K8sNodePortRange)
+		}
+		low, e1 := strconv.Atoi(r[0])
+		high, e2 := strconv.Atoi(r[1])
+		if e1 != nil || e2 != nil || low > high {
+			return fmt.Errorf("k8s_service_node_port_range %q is not like 30000-32767", c.K8sNodePortRange)
+		}
+		// Node ports are opened on every node, so they must
+		// not take the well-known ports, or those of etcd and
+		// kubelet.
+		if low < 1024 || high > 65535 {
+			return fmt.Errorf("k8s_service_node_port_range %s is not within 1024-65535", c.K8sNodePortRange)
+		}
+		for _, p := range []int{2379, 2380, 4001, 8080, 10250, 10251, 10252, 10255} {
+			if low <= p && p <= high {
+				return fmt.Errorf("k8s_service_node_port_range %s includes port %d used by cluster components", c.K8sNodePortRange, p)
+			}
+		}
+	}
+
+	switch c.ProxyMode() {
+	case "iptables", "userspace":
+	case "ipvs":
+		return fmt.Errorf("kube_proxy_mode ipvs needs Kubernetes 1.8 or later, which the templates don't support yet")
+	default:
+		return fmt.Errorf("kube_proxy_mode %q should be iptables or userspace", c.KubeProxyMode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNetworks(t *testing.T) {
+	ok := func() *Cluster {
+		return &Cluster{
+			Subnet:                   "10.10.14.0",
+			Netmask:                  "255.255.255.0",
+			K8sServiceClusterIPRange: "10.100.0.0/24",
+			K8sClusterDNS:            "10.100.0.10",
+		}
+	}
+	assert.Nil(t, ok().CheckNetworks())
+	assert.Equal(t, DefaultPodNetwork, ok().PodNetwork())
+	assert.Equal(t, DefaultKubeProxyMode, ok().ProxyMode())
+
+	c := ok()
+	c.K8sPodNetwork = "10.100.0.0/16"
+	assert.Contains(t, c.CheckNetworks().Error(), "overlaps k8s_service_cluster_ip_range")
+
+	c = ok()
+	c.K8sPodNetwork = "10.10.0.0/16"
+	assert.Contains(t, c.CheckNetworks().Error(), "overlaps the node subnet")
+
+	c = ok()
+	c.K8sClusterDNS = "10.101.0.10"
+	assert.Contains(t, c.CheckNetworks().Error(), "k8s_cluster_dns")
+
+	c = ok()
+	c.K8sNodePortRange = "30000-32767"
+	assert.Nil(t, c.CheckNetworks())
+	for _, r := range []string{"32767-30000", "30000", "80-1000", "2000-3000"} {
+		c.K8sNodePortRange = r
+		assert.NotNil(t, c.CheckNetworks(), r)
+	}
+
+	c = ok()
+	c.KubeProxyMode = "userspace"
+	assert.Nil(t, c.CheckNetworks())
+	c.KubeProxyMode = "ipvs"
+	assert.Contains(t, c.CheckNetworks().Error(), "1.8")
+	c.KubeProxyMode = "bogus"
+	assert.NotNil(t, c.CheckNetworks())
+}
@@ -0,0 +1,83 @@
+package clusterdesc
+
+import "fmt"
+
+// Hardware is the inventory of a node that resource reservations are
+// computed from.  Zero means unknown.
+type Hardware struct {
+	CPUs     int
+	MemoryMB int `yaml:"memory_mb"`
+}
+
+// tier reserves per of every unit in the next size units.
+type tier struct {
+	size, per float64
+}
+
+// Like GKE: of CPU, in millicores per core, 6% of the first core, 1%
+// of the next, 0.5% of the next 2 and 0.25% of the rest; of memory,
+// in MiB per MiB, 25% of the first 4GiB, 20% of the next 4GiB, 10% of
+// the next 8GiB, 6% of the next 112GiB and 2% of the rest.
+var (
+	kubeCPUTiers    = []tier{{1, 60}, {1, 10}, {2, 5}, {1e9, 2.5}}
+	kubeMemoryTiers = []tier{{4096, .25}, {4096, .2}, {8192, .1}, {114688, .06}, {1e12, .02}}
+)
+
+func tiered(amount float64, tiers []tier) int {
+	r := 0.0
+	for _, t := range tiers {
+		if amount <= 0 {
+			break
+		}
+		n := amount
+		if n > t.size {
+			n = t.size
+		}
+		r += n * t.per
+		amount -= n
+	}
+	return int(r)
+}
+
+// Reservations returns the --kube-reserved and --system-reserved of
+// the kubelet of n, like cpu=80m,memory=1843Mi, for hardware hw.  The
+// reservations in cluster-desc, of n or else of the cluster, override
+// those computed.  Of the latter, system-reserved grows with the
+// daemons n runs outside of Kubernetes, like etcd and Ceph.  Neither
+// is computed if hw is unknown.
+func (c Cluster) Reservations(n Node, hw Hardware) (kube, system string) {
+	kube, system = n.KubeReserved, n.SystemReserved
+	if len(kube) == 0 {
+		kube = c.KubeReserved
+	}
+	if len(system) == 0 {
+		system = c.SystemReserved
+	}
+	if hw.CPUs <= 0 || hw.MemoryMB <= 0 {
+		return kube, system
+	}
+
+	if len(kube) == 0 {
+		kube = fmt.Sprintf("cpu=%dm,memory=%dMi",
+			tiered(float64(hw.CPUs), kubeCPUTiers), tiered(float64(hw.MemoryMB), kubeMemoryTiers))
+	}
+	if len(system) == 0 {
+		cpu, memory := 100, hw.MemoryMB/20
+		if memory < 256 {
+			memory = 256
+		} else if memory > 2048 {
+			memory = 2048
+		}
+		if n.EtcdMember {
+			cpu, memory = cpu+250, memory+512
+		}
+		if n.CephMonitor {
+			cpu, memory = cpu+250, memory+512
+		}
+		if c.Ceph.ZapAndStartOSD {
+			cpu, memory = cpu+500, memory+1024
+		}
+		system = fmt.Sprintf("cpu=%dm,memory=%dMi", cpu, memory)
+	}
+	return kube, system
+}
@@ -0,0 +1,34 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservations(t *testing.T) {
+	c := Cluster{}
+
+	kube, system := c.Reservations(Node{}, Hardware{})
+	assert.Empty(t, kube)
+	assert.Empty(t, system)
+
+	// 60+10+2*5+4*2.5 millicores, 1024+819+... MiB.
+	kube, system = c.Reservations(Node{}, Hardware{CPUs: 8, MemoryMB: 32768})
+	assert.Equal(t, "cpu=90m,memory=3645Mi", kube)
+	assert.Equal(t, "cpu=100m,memory=1638Mi", system)
+
+	kube, system = c.Reservations(Node{}, Hardware{CPUs: 1, MemoryMB: 2048})
+	assert.Equal(t, "cpu=60m,memory=512Mi", kube)
+	assert.Equal(t, "cpu=100m,memory=256Mi", system)
+
+	// Daemons outside of Kubernetes need more for the system.
+	_, system = c.Reservations(Node{EtcdMember: true, CephMonitor: true}, Hardware{CPUs: 64, MemoryMB: 262144})
+	assert.Equal(t, "cpu=600m,memory=3072Mi", system)
+
+	// cluster-desc overrides, the node over the cluster.
+	c.KubeReserved, c.SystemReserved = "cpu=1,memory=2Gi", "cpu=500m,memory=1Gi"
+	kube, system = c.Reservations(Node{SystemReserved: "cpu=2"}, Hardware{})
+	assert.Equal(t, "cpu=1,memory=2Gi", kube)
+	assert.Equal(t, "cpu=2", system)
+}
@@ -0,0 +1,204 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Swap configures swap on nodes.  Mode is empty, which leaves swap
+// as the OS set it up, off, which turns off all swap, or zram, which
+// swaps to compressed memory only, ZramPercent (default 25) of the
+// memory large, compressed with ZramAlgorithm (default lz4).
+type Swap struct {
+	Mode          string
+	ZramPercent   int    `yaml:"zram_percent"`
+	ZramAlgorithm string `yaml:"zram_algorithm"`
+}
+
+// Sysctl is a kernel parameter, as written to /etc/sysctl.d.
+type Sysctl struct {
+	Key   string
+	Value string
+}
+
+// sysctlRange is the valid values of a kernel parameter: n integers,
+// like the two of net.ipv4.ip_local_port_range, from min to max.
+type sysctlRange struct {
+	min, max int64
+	n        int
+}
+
+// sysctlKeys are the kernel parameters cluster-desc may set.  Keys are
+// checked against them, so a typo fails validation instead of being
+// skipped by systemd-sysctl at boot.  Add parameters here as needed.
+var sysctlKeys = map[string]sysctlRange{
+	"fs.file-max":                         {65536, 1 << 31, 1},
+	"fs.inotify.max_user_instances":       {128, 1 << 20, 1},
+	"fs.inotify.max_user_watches":         {8192, 1 << 24, 1},
+	"kernel.panic":                        {0, 3600, 1},
+	"kernel.panic_on_oops":                {0, 1, 1},
+	"kernel.pid_max":                      {32768, 4194304, 1},
+	"net.bridge.bridge-nf-call-ip6tables": {0, 1, 1},
+	"net.bridge.bridge-nf-call-iptables":  {0, 1, 1},
+	"net.core.netdev_max_backlog":         {1000, 1 << 20, 1},
+	"net.core.rmem_max":                   {212992, 1 << 30, 1},
+	"net.core.somaxconn":                  {128, 65535, 1},
+	"net.core.wmem_max":                   {212992, 1 << 30, 1},
+	"net.ipv4.ip_forward":                 {0, 1, 1},
+	"net.ipv4.ip_local_port_range":        {1024, 65535, 2},
+	"net.ipv4.neigh.default.gc_thresh1":   {128, 1 << 20, 1},
+	"net.ipv4.neigh.default.gc_thresh2":   {512, 1 << 20, 1},
+	"net.ipv4.neigh.default.gc_thresh3":   {1024, 1 << 20, 1},
+	"net.ipv4.tcp_keepalive_time":         {60, 7200, 1},
+	"net.ipv4.tcp_max_syn_backlog":        {128, 1 << 20, 1},
+	"net.netfilter.nf_conntrack_max":      {65536, 1 << 24, 1},
+	"vm.max_map_count":                    {65530, 1 << 24, 1},
+	"vm.overcommit_memory":                {0, 2, 1},
+	"vm.swappiness":                       {0, 100, 1},
+}
+
+// defaultSysctl is the profile every cluster starts from, by the
+// roles of Firewall.AllowedPorts; Cluster.Sysctl overrides it.  Pods
+// watching files, like kubelet itself, exhaust the inotify defaults,
+// and the API server gets bursts of connections from all nodes.
+var defaultSysctl = map[string]map[string]string{
+	"all": {
+		"net.ipv4.ip_forward":           "1",
+		"fs.inotify.max_user_watches":   "524288",
+		"fs.inotify.max_user_instances": "8192",
+	},
+	"master": {
+		"net.core.somaxconn": "32768",
+	},
+}
+
+// Sysctls returns the kernel parameters of n, sorted by key: those of
+// the default profile and of Cluster.Sysctl for the roles of n, where
+// later roles in all, master or worker, etcd, ingress and
+// ceph_monitor override earlier ones, and then those of Node.Sysctl.
+func (c Cluster) Sysctls(n Node) []Sysctl {
+	merged := make(map[string]string)
+	for _, profile := range []map[string]map[string]string{defaultSysctl, c.Sysctl} {
+		for _, r := range firewallRolesOf(n) {
+			for k, v := range profile[r] {
+				merged[k] = v
+			}
+		}
+	}
+	for k, v := range n.Sysctl {
+		merged[k] = v
+	}
+	var sysctls []Sysctl
+	for k, v := range merged {
+		sysctls = append(sysctls, Sysctl{Key: k, Value: v})
+	}
+	sort.Slice(sysctls, func(i, j int) bool { return sysctls[i].Key < sysctls[j].Key })
+	return sysctls
+}
+
+// SwapPolicy returns Swap with the defaults filled in.
+func (c Cluster) SwapPolicy() Swap {
+	s := c.Swap
+	if s.Mode == "zram" {
+		if s.ZramPercent == 0 {
+			s.ZramPercent = 25
+		}
+		if len(s.ZramAlgorithm) == 0 {
+			s.ZramAlgorithm = "lz4"
+		}
+	}
+	return s
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	d := make([]int, len(b)+1)
+	for j := range d {
+		d[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := d[0]
+		d[0] = i
+		for j := 1; j <= len(b); j++ {
+			cur := d[j]
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[j] = prev + cost
+			if d[j-1]+1 < d[j] {
+				d[j] = d[j-1] + 1
+			}
+			if cur+1 < d[j] {
+				d[j] = cur + 1
+			}
+			prev = cur
+		}
+	}
+	return d[len(b)]
+}
+
+func checkSysctl(key, value string) error {
+	r, ok := sysctlKeys[key]
+	if !ok {
+		best, distance := "", 4
+		for k := range sysctlKeys {
+			if d := editDistance(key, k); d < distance || d == distance && k < best {
+				best, distance = k, d
+			}
+		}
+		if len(best) > 0 {
+			return fmt.Errorf("unknown kernel parameter %s, did you mean %s?", key, best)
+		}
+		return fmt.Errorf("unknown kernel parameter %s", key)
+	}
+	fields := strings.Fields(value)
+	if len(fields) != r.n {
+		return fmt.Errorf("%s = %q, want %d integers", key, value, r.n)
+	}
+	for _, f := range fields {
+		i, e := strconv.ParseInt(f, 10, 64)
+		if e != nil || i < r.min || i > r.max {
+			return fmt.Errorf("%s = %q, want integers from %d to %d", key, value, r.min, r.max)
+		}
+	}
+	return nil
+}
+
+// CheckSysctl validates Sysctl, those of nodes, and Swap.
+func (c Cluster) CheckSysctl() error {
+	for role, params := range c.Sysctl {
+		if !firewallRoles[role] {
+			return fmt.Errorf("sysctl has unknown role %q", role)
+		}
+		for k, v := range params {
+			if e := checkSysctl(k, v); e != nil {
+				return fmt.Errorf("sysctl %s: %v", role, e)
+			}
+		}
+	}
+	for _, n := range c.Nodes {
+		for k, v := range n.Sysctl {
+			if e := checkSysctl(k, v); e != nil {
+				return fmt.Errorf("sysctl of node %s: %v", n.MAC, e)
+			}
+		}
+	}
+
+	switch c.Swap.Mode {
+	case "", "off", "zram":
+	default:
+		return fmt.Errorf("swap mode %q is not off or zram", c.Swap.Mode)
+	}
+	if c.Swap.ZramPercent < 0 || c.Swap.ZramPercent > 100 {
+		return fmt.Errorf("swap zram_percent %d is not from 1 to 100", c.Swap.ZramPercent)
+	}
+	switch c.Swap.ZramAlgorithm {
+	case "", "lzo", "lz4", "zstd":
+	default:
+		return fmt.Errorf("swap zram_algorithm %q is not lzo, lz4 or zstd", c.Swap.ZramAlgorithm)
+	}
+	return nil
+}
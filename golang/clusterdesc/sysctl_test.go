@@ -0,0 +1,59 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSysctls(t *testing.T) {
+	c := Cluster{
+		Sysctl: map[string]map[string]string{
+			"all":  {"vm.swappiness": "10", "fs.inotify.max_user_watches": "1048576"},
+			"etcd": {"vm.swappiness": "0"},
+		},
+	}
+	assert.Equal(t, []Sysctl{
+		{"fs.inotify.max_user_instances", "8192"},
+		{"fs.inotify.max_user_watches", "1048576"},
+		{"net.core.somaxconn", "32768"},
+		{"net.ipv4.ip_forward", "1"},
+		{"vm.swappiness", "0"},
+	}, c.Sysctls(Node{KubeMaster: true, EtcdMember: true}))
+
+	worker := c.Sysctls(Node{Sysctl: map[string]string{"vm.swappiness": "60"}})
+	assert.Equal(t, 4, len(worker))
+	assert.Equal(t, Sysctl{"vm.swappiness", "60"}, worker[3])
+}
+
+func TestCheckSysctl(t *testing.T) {
+	c := Cluster{Sysctl: map[string]map[string]string{
+		"all":    {"net.ipv4.ip_local_port_range": "10240 65000"},
+		"worker": {"vm.max_map_count": "262144"},
+	}}
+	assert.Nil(t, c.CheckSysctl())
+
+	c.Sysctl["all"]["vm.swapiness"] = "10"
+	if e := c.CheckSysctl(); assert.Error(t, e) {
+		assert.Equal(t, "sysctl all: unknown kernel parameter vm.swapiness, did you mean vm.swappiness?", e.Error())
+	}
+	delete(c.Sysctl["all"], "vm.swapiness")
+
+	c.Nodes = []Node{{MAC: "00:25:90:c0:f7:80", Sysctl: map[string]string{"net.ipv4.ip_local_port_range": "1024"}}}
+	assert.Error(t, c.CheckSysctl())
+	c.Nodes[0].Sysctl = map[string]string{"vm.overcommit_memory": "3"}
+	assert.Error(t, c.CheckSysctl())
+	c.Nodes = nil
+
+	c.Sysctl["masters"] = map[string]string{}
+	assert.Error(t, c.CheckSysctl())
+	delete(c.Sysctl, "masters")
+
+	c.Swap = Swap{Mode: "zram", ZramAlgorithm: "gzip"}
+	assert.Error(t, c.CheckSysctl())
+	c.Swap = Swap{Mode: "zram"}
+	assert.Nil(t, c.CheckSysctl())
+	assert.Equal(t, Swap{Mode: "zram", ZramPercent: 25, ZramAlgorithm: "lz4"}, c.SwapPolicy())
+	c.Swap = Swap{Mode: "on"}
+	assert.Error(t, c.CheckSysctl())
+}
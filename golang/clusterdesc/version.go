@@ -0,0 +1,83 @@
+package clusterdesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of the features of cluster-desc and the
+// templates this sextant supports.  Bump it with every such feature
+// added, so cluster-desc and templates using the feature can declare
+// it as their minimum, see CheckVersion.  Versions added:
+//
+//	1.1  min_sextant_version
+//	1.2  hardware, kube_reserved and system_reserved
+//	1.3  the trusted CA bundle served to nodes
+//	1.4  sysctl and swap
+const Version = "1.4"
+
+// parseVersion parses a version like 1.1 or v1.1.
+func parseVersion(v string) ([]int, error) {
+	var parts []int
+	for _, s := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+		i, e := strconv.Atoi(s)
+		if e != nil || i < 0 {
+			return nil, fmt.Errorf("%q is not a version like %s", v, Version)
+		}
+		parts = append(parts, i)
+	}
+	return parts, nil
+}
+
+// CompareVersions returns -1, 0 or 1 if version a is less than, equal
+// to or greater than b.
+func CompareVersions(a, b string) (int, error) {
+	va, e := parseVersion(a)
+	if e != nil {
+		return 0, e
+	}
+	vb, e := parseVersion(b)
+	if e != nil {
+		return 0, e
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		x, y := 0, 0
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// CheckVersion returns an error if what, like cluster-desc, requires
+// a version of sextant newer than Version.  Rendering it anyway
+// would silently drop what it uses that this sextant doesn't know.
+func CheckVersion(what, required string) error {
+	if len(required) == 0 {
+		return nil
+	}
+	cmp, e := CompareVersions(required, Version)
+	if e != nil {
+		return fmt.Errorf("%s: min_sextant_version %v", what, e)
+	}
+	if cmp > 0 {
+		return fmt.Errorf("%s requires sextant %s or newer, but this is sextant %s; upgrade it before using this config", what, required, Version)
+	}
+	return nil
+}
+
+// CheckMinSextantVersion returns an error if cluster-desc requires a
+// newer sextant, see MinSextantVersion.
+func (c Cluster) CheckMinSextantVersion() error {
+	return CheckVersion("cluster-desc", c.MinSextantVersion)
+}
@@ -0,0 +1,37 @@
+package clusterdesc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.1", "1.1", 0},
+		{"v1.1", "1.1.0", 0},
+		{"1.2", "1.10", -1},
+		{"2.0", "1.10", 1},
+	} {
+		cmp, e := CompareVersions(c.a, c.b)
+		assert.Nil(t, e)
+		assert.Equal(t, c.cmp, cmp, "%s vs %s", c.a, c.b)
+	}
+	_, e := CompareVersions("1.x", "1.1")
+	assert.NotNil(t, e)
+}
+
+func TestCheckMinSextantVersion(t *testing.T) {
+	assert.Nil(t, Cluster{}.CheckMinSextantVersion())
+	assert.Nil(t, Cluster{MinSextantVersion: Version}.CheckMinSextantVersion())
+	assert.Nil(t, Cluster{MinSextantVersion: "1.0"}.CheckMinSextantVersion())
+
+	e := Cluster{MinSextantVersion: "99.0"}.CheckMinSextantVersion()
+	if assert.NotNil(t, e) {
+		assert.Contains(t, e.Error(), "cluster-desc requires sextant 99.0 or newer, but this is sextant "+Version)
+	}
+	assert.NotNil(t, Cluster{MinSextantVersion: "latest"}.CheckMinSextantVersion())
+}
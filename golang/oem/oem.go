@@ -0,0 +1,165 @@
+// oem generates the contents of the CoreOS OEM partition for a batch
+// of machines imaged once at the factory:
+//
+//	oem -url https://sextant.example.com -ca ca.pem -batch 2017-06 -out oem/
+//
+// The machines then fetch their cloud-config from the sextant server
+// at -url on boot, instead of relying on DHCP options, which can't be
+// controlled at customer sites.  grub.cfg points Ignition at
+// config.ign on the OEM partition, and images still running
+// coreos-cloudinit read cloud-config.yml instead; both start
+// fetch-cloud-config, which trusts the sextant CA given by -ca.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/topicai/candy"
+)
+
+type oemConfig struct {
+	URL   string
+	Batch string
+	CA    []byte // The PEM of the CA of the sextant server, for https.
+}
+
+// oemMount is where the OEM partition is mounted on a running node.
+const oemMount = "/usr/share/oem"
+
+// fetchUnit starts fetch-cloud-config on boot, retrying until the
+// sextant server is reachable.
+const fetchUnit = `[Unit]
+Description=Apply the cloud-config of this node from sextant
+Wants=network-online.target
+After=network-online.target
+[Service]
+Type=simple
+Restart=on-failure
+RestartSec=30
+ExecStart=` + oemMount + `/fetch-cloud-config
+[Install]
+WantedBy=multi-user.target
+`
+
+// oemFiles are written to the OEM partition, with their modes.  CoreOS
+// reads grub.cfg from it at boot, and cloud-config.yml on every boot.
+var oemFiles = map[string]struct {
+	mode    os.FileMode
+	content string
+}{
+	"grub.cfg": {0644, `# OEM partition of sextant batch {{ .Batch }}.
+set oem_id="sextant"
+set linux_append="$linux_append coreos.config.url=oem:///config.ign"
+`},
+	"fetch-cloud-config": {0755, `#!/bin/sh
+# Fetch and apply the cloud-config of this node from sextant batch
+# {{ .Batch }}, identified by the MAC address of the default interface.
+set -e
+iface=$(ip route show default | awk '{print $5; exit}')
+mac=$(cat /sys/class/net/$iface/address)
+curl -fsS {{ if .CA }}--cacert ` + oemMount + `/sextant-ca.pem {{ end }}-o /run/sextant-cloud-config.yml {{ .URL }}/cloud-config/$mac
+exec /usr/bin/coreos-cloudinit --from-file=/run/sextant-cloud-config.yml
+`},
+	"cloud-config.yml": {0644, `#cloud-config
+# OEM partition of sextant batch {{ .Batch }}.
+coreos:
+  units:
+    - name: sextant-cloud-config.service
+      command: start
+      content: |
+{{ indent 8 .Unit }}`},
+}
+
+// ignitionConfig is the subset of an Ignition 2.1 config that
+// config.ign uses.
+type ignitionConfig struct {
+	Ignition struct {
+		Version string `json:"version"`
+	} `json:"ignition"`
+	Systemd struct {
+		Units []ignitionUnit `json:"units"`
+	} `json:"systemd"`
+}
+
+type ignitionUnit struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Contents string `json:"contents"`
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(strings.TrimSuffix(s, "\n"), "\n", "\n"+pad, -1) + "\n"
+}
+
+func main() {
+	url := flag.String("url", "", "URL of the sextant server the machines fetch their cloud-config from, like https://sextant.example.com.")
+	ca := flag.String("ca", "", "The CA certificate of the sextant server, in PEM format, required if -url is https.")
+	batch := flag.String("batch", "", "Name of the batch of machines, recorded in the generated files.")
+	out := flag.String("out", "./oem", "The directory to write the OEM partition contents to.")
+	flag.Parse()
+
+	c := oemConfig{URL: *url, Batch: *batch}
+	if len(*ca) > 0 {
+		var e error
+		c.CA, e = ioutil.ReadFile(*ca)
+		candy.Must(e)
+	}
+	candy.Must(generate(*out, c))
+}
+
+func generate(dir string, c oemConfig) error {
+	if len(c.URL) == 0 {
+		return errors.New("-url is required")
+	}
+	if strings.HasPrefix(c.URL, "https://") && len(c.CA) == 0 {
+		return errors.New("-ca is required with an https -url")
+	}
+	c.URL = strings.TrimSuffix(c.URL, "/")
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return e
+	}
+	data := struct {
+		oemConfig
+		Unit string
+	}{c, fetchUnit}
+	for name, f := range oemFiles {
+		t, e := template.New(name).Funcs(template.FuncMap{"indent": indent}).Parse(f.content)
+		if e != nil {
+			return e
+		}
+		out, e := os.OpenFile(path.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.mode)
+		if e != nil {
+			return e
+		}
+		e = t.Execute(out, data)
+		if e2 := out.Close(); e == nil {
+			e = e2
+		}
+		if e != nil {
+			return e
+		}
+	}
+
+	var ign ignitionConfig
+	ign.Ignition.Version = "2.1.0"
+	ign.Systemd.Units = []ignitionUnit{{Name: "sextant-cloud-config.service", Enabled: true, Contents: fetchUnit}}
+	b, e := json.MarshalIndent(ign, "", "  ")
+	if e != nil {
+		return e
+	}
+	if e := ioutil.WriteFile(path.Join(dir, "config.ign"), b, 0644); e != nil {
+		return e
+	}
+	if len(c.CA) > 0 {
+		return ioutil.WriteFile(path.Join(dir, "sextant-ca.pem"), c.CA, 0644)
+	}
+	return nil
+}
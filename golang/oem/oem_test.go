@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+
+	assert.NotNil(t, generate(dir, oemConfig{}))
+	assert.NotNil(t, generate(dir, oemConfig{URL: "https://sextant.example.com/"}))
+	ca := []byte("-----BEGIN CERTIFICATE-----\n...\n-----END CERTIFICATE-----\n")
+	assert.Nil(t, generate(dir, oemConfig{URL: "https://sextant.example.com/", Batch: "2017-06", CA: ca}))
+
+	read := func(name string) string {
+		b, e := ioutil.ReadFile(path.Join(dir, name))
+		candy.Must(e)
+		return string(b)
+	}
+	fetch := read("fetch-cloud-config")
+	assert.Contains(t, fetch, "--cacert /usr/share/oem/sextant-ca.pem -o /run/sextant-cloud-config.yml https://sextant.example.com/cloud-config/$mac")
+	assert.Contains(t, fetch, "batch\n# 2017-06")
+	fi, e := os.Stat(path.Join(dir, "fetch-cloud-config"))
+	candy.Must(e)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+	assert.Equal(t, string(ca), read("sextant-ca.pem"))
+
+	// Ignition is pointed at config.ign, and coreos-cloudinit reads
+	// cloud-config.yml, both starting the same unit.
+	assert.Contains(t, read("grub.cfg"), "coreos.config.url=oem:///config.ign")
+	var ign ignitionConfig
+	candy.Must(json.Unmarshal([]byte(read("config.ign")), &ign))
+	assert.Equal(t, "2.1.0", ign.Ignition.Version)
+	if assert.Equal(t, 1, len(ign.Systemd.Units)) {
+		assert.Equal(t, fetchUnit, ign.Systemd.Units[0].Contents)
+		assert.Contains(t, fetchUnit, "Type=simple")
+	}
+	assert.Contains(t, read("cloud-config.yml"), "\n        ExecStart=/usr/share/oem/fetch-cloud-config\n")
+}
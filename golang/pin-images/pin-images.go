@@ -0,0 +1,99 @@
+// pin-images resolves the tags of the images in cluster-desc to
+// digests in the bootstrapper's registry, and prints them as the
+// image_digests section of cluster-desc:
+//
+//	pin-images -cluster-desc cluster-desc.yml -ca-crt /bsroot/tls/ca.pem
+//
+// With image_digests in cluster-desc, nodes are configured to run the
+// images by digest, so all nodes run the same images even if their
+// tags are pushed again.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+const manifestV2 = "application/vnd.docker.distribution.manifest.v2+json"
+
+func main() {
+	clusterDesc := flag.String("cluster-desc", "./cluster-desc.yml", "Configurations for a k8s cluster.")
+	registry := flag.String("registry", "", "URL of the registry, https://<dockerdomain>:5000 by default.")
+	caCrt := flag.String("ca-crt", "", "CA certificate file of the registry, in PEM format.")
+	flag.Parse()
+
+	b, e := ioutil.ReadFile(*clusterDesc)
+	candy.Must(e)
+	c := &clusterdesc.Cluster{}
+	candy.Must(yaml.Unmarshal(b, c))
+	if len(*registry) == 0 {
+		*registry = "https://" + c.Dockerdomain + ":5000"
+	}
+
+	client := &http.Client{}
+	if len(*caCrt) > 0 {
+		pem, e := ioutil.ReadFile(*caCrt)
+		candy.Must(e)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			candy.Must(errors.New("no certificate in " + *caCrt))
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+
+	digests, e := resolve(client, *registry, c.Images)
+	candy.Must(e)
+	out, e := yaml.Marshal(map[string]map[string]string{"image_digests": digests})
+	candy.Must(e)
+	os.Stdout.Write(out)
+}
+
+// resolve returns the digest of each of images in registry.
+func resolve(client *http.Client, registry string, images map[string]string) (map[string]string, error) {
+	var keys []string
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	digests := make(map[string]string)
+	for _, k := range keys {
+		repo, tag := clusterdesc.ImageRepository(images[k]), "latest"
+		if i := strings.Index(images[k], "@"); i >= 0 {
+			digests[k] = images[k][i+1:] // Pinned in images already.
+			continue
+		}
+		if len(repo) < len(images[k]) {
+			tag = images[k][len(repo)+1:]
+		}
+
+		req, e := http.NewRequest("HEAD", strings.TrimSuffix(registry, "/")+"/v2/"+repo+"/manifests/"+tag, nil)
+		if e != nil {
+			return nil, e
+		}
+		req.Header.Set("Accept", manifestV2)
+		resp, e := client.Do(req)
+		if e != nil {
+			return nil, e
+		}
+		resp.Body.Close()
+		d := resp.Header.Get("Docker-Content-Digest")
+		if resp.StatusCode != http.StatusOK || len(d) == 0 {
+			return nil, fmt.Errorf("cannot resolve %s (%s): %s", k, images[k], resp.Status)
+		}
+		digests[k] = d
+	}
+	return digests, nil
+}
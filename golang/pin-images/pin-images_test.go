@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/pineking/hyperkube-amd64/manifests/2169be":
+			w.Header().Set("Docker-Content-Digest", "sha256:ab")
+		case "/v2/redaphid/docker-ntp-server/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:cd")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	d, e := resolve(http.DefaultClient, registry.URL, map[string]string{
+		"hyperkube": "pineking/hyperkube-amd64:2169be",
+		"ntp":       "redaphid/docker-ntp-server",
+		"pause":     "typhoon1986/pause-amd64@sha256:ef",
+	})
+	assert.Nil(t, e)
+	assert.Equal(t, map[string]string{"hyperkube": "sha256:ab", "ntp": "sha256:cd", "pause": "sha256:ef"}, d)
+
+	_, e = resolve(http.DefaultClient, registry.URL, map[string]string{"flannel": "typhoon1986/flannel:0.5.5"})
+	assert.NotNil(t, e)
+}
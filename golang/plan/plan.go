@@ -0,0 +1,175 @@
+// plan reports the impact of applying a modified cluster-desc before
+// it replaces the current one, like
+//
+//	plan -cluster-desc cluster-desc.yml -new cluster-desc.new.yml \
+//	     -cloud-config-dir templatefiles
+//
+// For every node it tells whether the rendered cloud-config changes,
+// which takes reprovisioning, as nodes apply their cloud-config only
+// when installed, and whether only DHCP/DNS, which the bootstrapper
+// refreshes live, changes.  It also lists reissued certs and changed
+// IPs.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+// unlistedMAC stands for the nodes which are not enlisted in
+// cluster-desc and get IPs from the DHCP range.
+const unlistedMAC = "00:00:00:00:00:00"
+
+func main() {
+	clusterDesc := flag.String("cluster-desc", "./cluster-desc.yml", "The current cluster-desc.")
+	newClusterDesc := flag.String("new", "./cluster-desc.new.yml", "The modified cluster-desc.")
+	ccTemplateDir := flag.String("cloud-config-dir", "./cloud-config.template", "cloud-config file template directories, separated by ':', where later ones override earlier ones.")
+	flag.Parse()
+
+	candy.Must(plan(os.Stdout, *clusterDesc, *newClusterDesc, *ccTemplateDir))
+}
+
+func plan(w io.Writer, curFile, newFile, ccTemplateDir string) error {
+	// LoadClusterDesc shares its result, so copy it before
+	// loading the other file.
+	c, e := cctemplate.LoadClusterDesc(curFile)
+	if e != nil {
+		return e
+	}
+	cur := *c
+	n, e := cctemplate.LoadClusterDesc(newFile)
+	if e != nil {
+		return e
+	}
+	next := *n
+
+	curNodes, nextNodes := nodesByMAC(&cur), nodesByMAC(&next)
+	macs := []string{}
+	for mac := range curNodes {
+		macs = append(macs, mac)
+	}
+	for mac := range nextNodes {
+		if _, ok := curNodes[mac]; !ok {
+			macs = append(macs, mac)
+		}
+	}
+	sort.Strings(macs)
+	macs = append(macs, unlistedMAC)
+
+	changes := 0
+	for _, mac := range macs {
+		name := clusterdesc.Node{MAC: mac}.Hostname()
+		if mac == unlistedMAC {
+			name = "nodes not enlisted"
+		}
+		o, curOK := curNodes[mac]
+		nn, nextOK := nextNodes[mac]
+		switch {
+		case !nextOK && mac != unlistedMAC:
+			fmt.Fprintf(w, "- %s: removed\n", name)
+			changes++
+			continue
+		case !curOK && mac != unlistedMAC:
+			fmt.Fprintf(w, "+ %s: added, provision it\n", name)
+			changes++
+			continue
+		}
+
+		before, e := render(mac, ccTemplateDir, curFile)
+		if e != nil {
+			return e
+		}
+		after, e := render(mac, ccTemplateDir, newFile)
+		if e != nil {
+			return e
+		}
+
+		var notes []string
+		if o.IP != nn.IP {
+			notes = append(notes, fmt.Sprintf("IP %q -> %q", o.IP, nn.IP))
+		}
+		if o.KubeMaster != nn.KubeMaster || (nn.KubeMaster &&
+			(!reflect.DeepEqual(cur.KubeMasterIP, next.KubeMasterIP) || !reflect.DeepEqual(cur.KubeMasterDNS, next.KubeMasterDNS))) {
+			notes = append(notes, "cert reissued")
+		}
+		detail := ""
+		if len(notes) > 0 {
+			detail = " (" + strings.Join(notes, ", ") + ")"
+		}
+		switch {
+		case before != after:
+			fmt.Fprintf(w, "~ %s: cloud-config changes, reprovision it%s\n", name, detail)
+			diff(w, before, after)
+		case len(notes) > 0:
+			fmt.Fprintf(w, "~ %s: live refresh of DHCP/DNS%s\n", name, detail)
+		default:
+			continue
+		}
+		changes++
+	}
+	fmt.Fprintf(w, "%d nodes to change.\n", changes)
+	return nil
+}
+
+func nodesByMAC(c *clusterdesc.Cluster) map[string]clusterdesc.Node {
+	m := make(map[string]clusterdesc.Node)
+	for _, n := range c.Nodes {
+		m[n.Mac()] = n
+	}
+	return m
+}
+
+// render renders the cloud-config of mac, without certs, which are
+// generated anew on every render.
+func render(mac, ccTemplateDir, clusterDescFile string) (string, error) {
+	var b bytes.Buffer
+	e := cctemplate.Execute(&b, mac, "cc-template", ccTemplateDir, clusterDescFile, "", "")
+	return b.String(), e
+}
+
+// diff prints the lines removed from and added to a rendered config,
+// in the order of the config, by the longest common subsequence of
+// the lines before and after.
+func diff(w io.Writer, before, after string) {
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(w, "    -%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(w, "    +%s\n", b[j])
+			j++
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestPlan(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	tmplDir := path.Join(dir, "templatefiles")
+	candy.Must(os.Mkdir(tmplDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "cc"),
+		[]byte(`{{ define "cc-template" }}hostname: {{ .Hostname }}
+registry: {{ .Dockerdomain }}{{ end }}`), 0644))
+
+	write := func(name, desc string) string {
+		fn := path.Join(dir, name)
+		candy.Must(ioutil.WriteFile(fn, []byte(desc), 0644))
+		return fn
+	}
+	cur := write("cur.yml", `{"dockerdomain": "bootstrapper", "nodes": [
+{"mac": "00:25:90:c0:f7:80"},
+{"mac": "00:25:90:c0:f7:81", "ip": "10.10.14.2"},
+{"mac": "00:25:90:c0:f7:82"}]}`)
+	next := write("next.yml", `{"dockerdomain": "registry", "nodes": [
+{"mac": "00:25:90:c0:f7:80"},
+{"mac": "00:25:90:c0:f7:81", "ip": "10.10.14.3"},
+{"mac": "00:25:90:c0:f7:83"}]}`)
+
+	var b bytes.Buffer
+	assert.Nil(t, plan(&b, cur, cur, tmplDir))
+	assert.Equal(t, "0 nodes to change.\n", b.String())
+
+	b.Reset()
+	assert.Nil(t, plan(&b, cur, next, tmplDir))
+	assert.Equal(t, `~ 00-25-90-c0-f7-80: cloud-config changes, reprovision it
+    -registry: bootstrapper
+    +registry: registry
+~ 00-25-90-c0-f7-81: cloud-config changes, reprovision it (IP "10.10.14.2" -> "10.10.14.3")
+    -registry: bootstrapper
+    +registry: registry
+- 00-25-90-c0-f7-82: removed
++ 00-25-90-c0-f7-83: added, provision it
+~ nodes not enlisted: cloud-config changes, reprovision it
+    -registry: bootstrapper
+    +registry: registry
+5 nodes to change.
+`, b.String())
+}
+
+func TestDiff(t *testing.T) {
+	var b bytes.Buffer
+	diff(&b, "a\nb\nc\nb\nd", "a\nc\nb\nx\nd")
+	assert.Equal(t, "    -b\n    +x\n", b.String())
+
+	// Moved lines are shown where they moved from and to.
+	b.Reset()
+	diff(&b, "x\ny\nz", "y\nz\nx")
+	assert.Equal(t, "    -x\n    +x\n", b.String())
+}
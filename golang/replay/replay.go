@@ -0,0 +1,38 @@
+// replay re-renders a cloud-config recorded by cloud-config-server
+// -record-dir against the current code, so that the config a node
+// booted with can be debugged after the fact.
+//
+//	replay -record <record-dir>/00-25-90-c0-f7-80/<time>-cc-template.json
+//
+// prints the re-rendered config; with -recorded it prints the config
+// that was actually served instead, with private keys redacted, for
+// diffing.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/topicai/candy"
+)
+
+func main() {
+	recordFile := flag.String("record", "", "A render record saved by cloud-config-server -record-dir.")
+	recorded := flag.Bool("recorded", false, "Print the recorded output instead of re-rendering.")
+	flag.Parse()
+
+	b, e := ioutil.ReadFile(*recordFile)
+	candy.Must(e)
+	rec := &cctemplate.Record{}
+	candy.Must(json.Unmarshal(b, rec))
+
+	if *recorded {
+		_, e = os.Stdout.WriteString(rec.Output)
+		candy.Must(e)
+		return
+	}
+	candy.Must(rec.Replay(os.Stdout))
+}
@@ -0,0 +1,64 @@
+// Package sextanttest provides test doubles of the interfaces through
+// which the sextant libraries reach outside systems, so code embedding
+// them can be unit tested without those systems: ContextProvider,
+// which feeds site data like from a CMDB into templates, and Signer,
+// which issues certificates and node tokens.
+package sextanttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// ContextProvider is a template.ContextProvider that returns Contexts
+// by node MAC address, after Delay, or Err if it is not nil.  It is
+// safe to use concurrently, as renders ask providers concurrently,
+// and returns the error of the context once it is done.
+type ContextProvider struct {
+	ProviderName string
+	Contexts     map[string]map[string]interface{}
+	Delay        time.Duration
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+// Name implements template.ContextProvider.
+func (p *ContextProvider) Name() string { return p.ProviderName }
+
+// Context implements template.ContextProvider.
+func (p *ContextProvider) Context(ctx context.Context, node clusterdesc.Node) (map[string]interface{}, error) {
+	p.mu.Lock()
+	p.calls++
+	err := p.err
+	p.mu.Unlock()
+
+	select {
+	case <-time.After(p.Delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.Contexts[node.Mac()], nil
+}
+
+// SetErr makes the following calls of Context fail with err, or
+// succeed again if err is nil.
+func (p *ContextProvider) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Calls returns how many times Context was called.
+func (p *ContextProvider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
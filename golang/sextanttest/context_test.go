@@ -0,0 +1,36 @@
+package sextanttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextProvider(t *testing.T) {
+	p := &ContextProvider{
+		ProviderName: "cmdb",
+		Contexts:     map[string]map[string]interface{}{"00:25:90:c0:f7:80": {"asset": "A-1"}},
+	}
+	var _ cctemplate.ContextProvider = p
+
+	c, err := p.Context(context.Background(), clusterdesc.Node{MAC: "00:25:90:C0:F7:80"})
+	assert.Nil(t, err)
+	assert.Equal(t, "A-1", c["asset"])
+
+	p.SetErr(errors.New("CMDB down"))
+	_, err = p.Context(context.Background(), clusterdesc.Node{MAC: "00:25:90:c0:f7:80"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, p.Calls())
+
+	// Rendering reads the provider through the registry.
+	p.SetErr(nil)
+	cctemplate.RegisterContextProvider(p, time.Second, 0)
+	data, err := cctemplate.GetConfigDataByMac("00:25:90:c0:f7:80", &clusterdesc.Cluster{}, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "A-1", data.Extra["cmdb"]["asset"])
+}
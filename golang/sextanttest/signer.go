@@ -0,0 +1,74 @@
+package sextanttest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signer is a certgen.Signer that signs nothing: it returns
+// placeholder keys, certificates and tokens naming what they were
+// issued for, or fails with Err if it is not nil, so code issuing
+// certificates can be tested without openssl, ssh-keygen or CA keys.
+// Like certgen.Gen, its Gen panics for errors.  Install it with
+// certgen.SetSigner.
+type Signer struct {
+	mu     sync.Mutex
+	err    error
+	issued []string
+}
+
+// Gen implements certgen.Signer.
+func (s *Signer) Gen(master bool, hostname, caKey, caCrt string, kubeMasterIP, kubeMasterDNS []string) ([]byte, []byte) {
+	if e := s.record("tls " + hostname); e != nil {
+		panic(e)
+	}
+	role := "worker"
+	if master {
+		role = "master"
+	}
+	return []byte("fake key of " + hostname), []byte(fmt.Sprintf("fake %s certificate of %s", role, hostname))
+}
+
+// NodeToken implements certgen.Signer.
+func (s *Signer) NodeToken(caKey, hostname string) (string, error) {
+	if e := s.record("token " + hostname); e != nil {
+		return "", e
+	}
+	return "fake-token-" + hostname, nil
+}
+
+// SignSSHUser implements certgen.Signer.
+func (s *Signer) SignSSHUser(caKey string, pub []byte, identity string, principals []string, ttl time.Duration) ([]byte, error) {
+	if e := s.record("ssh " + identity); e != nil {
+		return nil, e
+	}
+	return []byte(fmt.Sprintf("fake ssh certificate of %s for %s valid %v\n", identity, strings.Join(principals, ","), ttl)), nil
+}
+
+func (s *Signer) record(what string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.issued = append(s.issued, what)
+	return nil
+}
+
+// SetErr makes the following calls fail with err, or succeed again if
+// err is nil.
+func (s *Signer) SetErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Issued returns what was issued so far, in order, like "tls <hostname>",
+// "token <hostname>" or "ssh <identity>".
+func (s *Signer) Issued() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.issued...)
+}
@@ -0,0 +1,44 @@
+package sextanttest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/certgen"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	cctemplate "github.com/k8sp/sextant/golang/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestSigner(t *testing.T) {
+	s := &Signer{}
+	var _ certgen.Signer = s
+	defer certgen.SetSigner(certgen.SetSigner(s))
+
+	crt, e := certgen.SignSSHUser("ssh-ca", []byte("ssh-rsa AAAA"), "alice", []string{"core", "root"}, time.Hour)
+	assert.Nil(t, e)
+	assert.Equal(t, "fake ssh certificate of alice for core,root valid 1h0m0s\n", string(crt))
+
+	// Rendering issues the node certificate and token through the signer.
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	caCrt := path.Join(dir, "ca.pem")
+	candy.Must(ioutil.WriteFile(caCrt, []byte("fake CA"), 0600))
+	c := &clusterdesc.Cluster{Nodes: []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80", KubeMaster: true}}}
+	data, e := cctemplate.GetConfigDataByMac("00:25:90:c0:f7:80", c, path.Join(dir, "ca-key.pem"), caCrt)
+	assert.Nil(t, e)
+	assert.Equal(t, "fake master certificate of 00-25-90-c0-f7-80", data.Crt)
+	assert.Equal(t, "fake-token-00-25-90-c0-f7-80", data.NodeToken)
+	assert.Equal(t, []string{"ssh alice", "tls 00-25-90-c0-f7-80", "tls 00-25-90-c0-f7-80", "token 00-25-90-c0-f7-80"}, s.Issued())
+
+	s.SetErr(errors.New("CA offline"))
+	_, e = certgen.NodeToken("ca-key.pem", "00-25-90-c0-f7-80")
+	assert.NotNil(t, e)
+	assert.Panics(t, func() { certgen.Gen(false, "00-25-90-c0-f7-80", "ca-key.pem", caCrt, nil, nil) })
+}
@@ -0,0 +1,120 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// ContextProvider contributes site-specific data, for example from a
+// CMDB, to the template context of a node, so that such data doesn't
+// have to be copied into cluster-desc.  Templates access the data
+// returned by a provider named cmdb as {{ .Extra.cmdb.<key> }}.
+// Context should return once ctx is done, which it is when the render
+// stops waiting for it.
+type ContextProvider interface {
+	Name() string
+	Context(ctx context.Context, node clusterdesc.Node) (map[string]interface{}, error)
+}
+
+type registeredProvider struct {
+	ContextProvider
+	timeout time.Duration
+	ttl     time.Duration
+}
+
+type cachedContext struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+var providers struct {
+	sync.Mutex
+	list  []registeredProvider
+	cache map[string]cachedContext // By provider name and MAC.
+}
+
+// RegisterContextProvider registers p, which is then asked for the
+// context of every node rendered.  A render waits for p at most
+// timeout, and reuses what p returned for a node for ttl.  If p fails
+// or times out, the last context it returned for the node is used,
+// even if expired, or none at all.
+func RegisterContextProvider(p ContextProvider, timeout, ttl time.Duration) {
+	providers.Lock()
+	defer providers.Unlock()
+	providers.list = append(providers.list, registeredProvider{p, timeout, ttl})
+	if providers.cache == nil {
+		providers.cache = make(map[string]cachedContext)
+	}
+}
+
+// extraContext resolves the context of node from all registered
+// providers concurrently.
+func extraContext(node clusterdesc.Node) map[string]map[string]interface{} {
+	providers.Lock()
+	list := providers.list
+	providers.Unlock()
+
+	extra := make(map[string]map[string]interface{})
+	if len(list) == 0 {
+		return extra
+	}
+	results := make([]map[string]interface{}, len(list))
+	var wg sync.WaitGroup
+	for i, p := range list {
+		wg.Add(1)
+		go func(i int, p registeredProvider) {
+			defer wg.Done()
+			results[i] = resolveContext(p, node)
+		}(i, p)
+	}
+	wg.Wait()
+	for i, p := range list {
+		if results[i] != nil {
+			extra[p.Name()] = results[i]
+		}
+	}
+	return extra
+}
+
+func resolveContext(p registeredProvider, node clusterdesc.Node) map[string]interface{} {
+	key := p.Name() + "/" + node.MAC
+	providers.Lock()
+	cached, ok := providers.cache[key]
+	providers.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.data
+	}
+
+	type result struct {
+		data map[string]interface{}
+		err  error
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	c := make(chan result, 1)
+	go func() {
+		d, e := p.Context(ctx, node)
+		c <- result{d, e}
+	}()
+
+	var r result
+	select {
+	case r = <-c:
+	case <-ctx.Done():
+		r.err = fmt.Errorf("timed out after %v", p.timeout)
+	}
+	if r.err != nil {
+		glog.Warningf("Context provider %s failed for %s: %v", p.Name(), node.MAC, r.err)
+		return cached.data
+	}
+
+	providers.Lock()
+	providers.cache[key] = cachedContext{r.data, time.Now().Add(p.ttl)}
+	providers.Unlock()
+	return r.data
+}
@@ -0,0 +1,65 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	name      string
+	calls     int32
+	cancelled int32
+	delay     time.Duration
+	err       atomic.Value
+}
+
+func (f *fakeProvider) Name() string { return f.name }
+
+func (f *fakeProvider) Context(ctx context.Context, node clusterdesc.Node) (map[string]interface{}, error) {
+	atomic.AddInt32(&f.calls, 1)
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		atomic.AddInt32(&f.cancelled, 1)
+		return nil, ctx.Err()
+	}
+	if e, ok := f.err.Load().(error); ok {
+		return nil, e
+	}
+	return map[string]interface{}{"asset": "A-" + node.MAC}, nil
+}
+
+func TestContextProviders(t *testing.T) {
+	defer func() { providers.list = nil }()
+	cmdb := &fakeProvider{name: "cmdb"}
+	slow := &fakeProvider{name: "slow", delay: time.Second}
+	RegisterContextProvider(cmdb, time.Second, time.Hour)
+	RegisterContextProvider(slow, 10*time.Millisecond, time.Hour)
+
+	node := clusterdesc.Node{MAC: "00:25:90:c0:f7:80"}
+	extra := extraContext(node)
+	assert.Equal(t, "A-00:25:90:c0:f7:80", extra["cmdb"]["asset"])
+	_, ok := extra["slow"]
+	assert.False(t, ok)
+	// The slow provider is cancelled rather than left running.
+	for i := 0; i < 100 && atomic.LoadInt32(&slow.cancelled) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slow.cancelled))
+
+	// Cached within ttl.
+	extraContext(node)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cmdb.calls))
+
+	// Expired, but the provider fails: the last context is reused.
+	providers.cache["cmdb/"+node.MAC] = cachedContext{extra["cmdb"], time.Now()}
+	cmdb.err.Store(errors.New("CMDB down"))
+	assert.Equal(t, "A-00:25:90:c0:f7:80", extraContext(node)["cmdb"]["asset"])
+	assert.Equal(t, int32(2), atomic.LoadInt32(&cmdb.calls))
+}
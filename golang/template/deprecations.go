@@ -0,0 +1,106 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// deprecatedFields are the fields of ExecutionConfig that templates
+// should no longer use, with advice.
+var deprecatedFields = map[string]string{
+	"MasterIP": "MasterIP is never set; use MasterHostname.",
+}
+
+// templateDeprecationsCache memoizes TemplateDeprecations by the
+// names, sizes and modification times of the template files, as
+// Deprecations is called for every node rendered and recorded.
+var templateDeprecationsCache struct {
+	sync.Mutex
+	stamp        string
+	deprecations []clusterdesc.Deprecation
+}
+
+// templateFilesStamp returns what changes whenever a template file in
+// ccTemplateDir is added, removed or modified.
+func templateFilesStamp(ccTemplateDir string) (string, error) {
+	files, e := sortedTemplateFiles(ccTemplateDir)
+	if e != nil {
+		return "", e
+	}
+	stamp := ccTemplateDir
+	for _, f := range files {
+		fi, e := os.Stat(f)
+		if e != nil {
+			return "", e
+		}
+		stamp += fmt.Sprintf("\x00%s %d %d", f, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// TemplateDeprecations returns the uses of deprecated variables in
+// the templates in ccTemplateDir, like those of site overlays.  The
+// templates are parsed again only if a template file changed.
+func TemplateDeprecations(ccTemplateDir string) ([]clusterdesc.Deprecation, error) {
+	stamp, err := templateFilesStamp(ccTemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	templateDeprecationsCache.Lock()
+	defer templateDeprecationsCache.Unlock()
+	if templateDeprecationsCache.stamp != stamp {
+		d, err := templateDeprecations(ccTemplateDir)
+		if err != nil {
+			return nil, err
+		}
+		templateDeprecationsCache.stamp = stamp
+		templateDeprecationsCache.deprecations = d
+	}
+	return append([]clusterdesc.Deprecation(nil), templateDeprecationsCache.deprecations...), nil
+}
+
+func templateDeprecations(ccTemplateDir string) ([]clusterdesc.Deprecation, error) {
+	t, err := parseTemplates(ccTemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	var uses []fieldUse
+	var calls []templateCall
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			collectFields(tmpl.Tree, tmpl.Tree.Root, true, true, &uses, &calls)
+		}
+	}
+	var d []clusterdesc.Deprecation
+	for _, root := range legacyRoots(ccTemplateDir) {
+		d = append(d, clusterdesc.Deprecation{Construct: "template root " + root + " is a file", Advice: "The single-file layout will no longer be loaded; move the file into a template directory, as cc-template.template defining cc-template."})
+	}
+	for _, f := range uses {
+		if advice, ok := deprecatedFields[f.path[0]]; ok {
+			d = append(d, clusterdesc.Deprecation{Construct: fmt.Sprintf("%s: .%s", f.location, f.path[0]), Advice: advice})
+		}
+	}
+	return d, nil
+}
+
+// Deprecations returns the deprecated constructs the config of mac is
+// rendered from, in cluster-desc and in the templates.
+func Deprecations(mac, ccTemplateDir, clusterDescFile string) ([]clusterdesc.Deprecation, error) {
+	c, e := LoadClusterDesc(clusterDescFile)
+	if e != nil {
+		return nil, e
+	}
+	n := getNodeByMAC(c, mac)
+	d := c.Deprecations(n)
+	if n.Quarantined() {
+		return d, nil
+	}
+	t, e := TemplateDeprecations(ccTemplateDir)
+	if e != nil {
+		return nil, e
+	}
+	return append(d, t...), nil
+}
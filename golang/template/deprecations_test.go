@@ -0,0 +1,36 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestTemplateDeprecationsCached(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "cc.template")
+	candy.Must(ioutil.WriteFile(fn, []byte(`{{ define "cc-template" }}{{ .MasterIP }}{{ end }}`), 0644))
+
+	d, e := TemplateDeprecations(dir)
+	assert.Nil(t, e)
+	assert.Equal(t, 1, len(d))
+	d[0].Advice = "changed by the caller"
+	d, e = TemplateDeprecations(dir)
+	assert.Nil(t, e)
+	assert.Equal(t, deprecatedFields["MasterIP"], d[0].Advice)
+
+	// Edits are picked up by their modification time.
+	candy.Must(ioutil.WriteFile(fn, []byte(`{{ define "cc-template" }}{{ .MasterHostname }}{{ end }}`), 0644))
+	later := time.Now().Add(time.Minute)
+	candy.Must(os.Chtimes(fn, later, later))
+	d, e = TemplateDeprecations(dir)
+	assert.Nil(t, e)
+	assert.Equal(t, 0, len(d))
+}
@@ -0,0 +1,39 @@
+package template
+
+import (
+	"sync"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// Inventory returns the hardware collected from the node with a MAC
+// address, and false if none has been.
+type Inventory func(mac string) (clusterdesc.Hardware, bool)
+
+var inventory struct {
+	sync.Mutex
+	f Inventory
+}
+
+// RegisterInventory makes renders compute resource reservations from
+// the hardware collected by f, which overrides that declared in
+// cluster-desc.
+func RegisterInventory(f Inventory) {
+	inventory.Lock()
+	defer inventory.Unlock()
+	inventory.f = f
+}
+
+// hardwareOf returns the hardware collected from node, or else that
+// declared in cluster-desc.
+func hardwareOf(node clusterdesc.Node) clusterdesc.Hardware {
+	inventory.Lock()
+	f := inventory.f
+	inventory.Unlock()
+	if f != nil {
+		if hw, ok := f(node.MAC); ok {
+			return hw
+		}
+	}
+	return node.Hardware
+}
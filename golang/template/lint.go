@@ -0,0 +1,209 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// certFields and Provenance are filled only when serving a node, and
+// Extra only by context providers, so they are empty when checking
+// variables.
+var certFields = map[string]bool{"CaCrt": true, "Crt": true, "Key": true, "Extra": true, "Provenance": true,
+	"SSHCA": true, "SSHHostKey": true, "SSHHostCert": true}
+
+type fieldUse struct {
+	template      string
+	path          []string
+	location      string
+	unconditional bool // Output regardless of if, with and range.
+}
+
+type templateCall struct {
+	caller, callee string
+	unconditional  bool
+}
+
+// CheckVariables cross-references the variables the templates in
+// ccTemplateDir refer to against the data of the nodes in c.  It
+// returns the variables that are undefined, which render as errors
+// or as "<no value>", and those output unconditionally but empty for
+// every node, which is likely a missing key in cluster-desc.
+func CheckVariables(ccTemplateDir string, c *clusterdesc.Cluster) (undefined, empty []string, err error) {
+	t, err := parseTemplates(ccTemplateDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var uses []fieldUse
+	var calls []templateCall
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			collectFields(tmpl.Tree, tmpl.Tree.Root, true, true, &uses, &calls)
+		}
+	}
+	always := alwaysExecuted(calls)
+
+	var data []reflect.Value
+	for _, n := range append(c.Nodes, clusterdesc.Node{MAC: "00:00:00:00:00:00"}) {
+		if !n.Quarantined() {
+			d, e := GetConfigDataByMac(n.Mac(), c, "", "")
+			if e != nil {
+				return nil, nil, e
+			}
+			data = append(data, reflect.ValueOf(*d))
+		}
+	}
+
+	u, e := make(map[string]bool), make(map[string]bool)
+	for _, f := range uses {
+		if certFields[f.path[0]] {
+			continue
+		}
+		name := fmt.Sprintf("%s: .%s", f.location, strings.Join(f.path, "."))
+		defined, nonEmpty := false, false
+		for _, d := range data {
+			v, ok := lookup(d, f.path)
+			defined = defined || ok
+			nonEmpty = nonEmpty || (ok && !isEmpty(v))
+		}
+		switch {
+		case !defined:
+			u[name] = true
+		case f.unconditional && always(f.template) && !nonEmpty:
+			e[name] = true
+		}
+	}
+	return sortedKeys(u), sortedKeys(e), nil
+}
+
+// alwaysExecuted returns whether a template is executed whenever the
+// templates not called by others are, like cc-template, as opposed
+// to only if some condition holds, like quarantine.
+func alwaysExecuted(calls []templateCall) func(name string) bool {
+	callers := make(map[string][]templateCall)
+	for _, c := range calls {
+		callers[c.callee] = append(callers[c.callee], c)
+	}
+	memo := make(map[string]bool)
+	var always func(name string) bool
+	always = func(name string) bool {
+		if a, ok := memo[name]; ok {
+			return a
+		}
+		memo[name] = false // Guards against recursive templates.
+		a := len(callers[name]) == 0
+		for _, c := range callers[name] {
+			a = a || (c.unconditional && always(c.caller))
+		}
+		memo[name] = a
+		return a
+	}
+	return always
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var s []string
+	for k := range m {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// lookup follows path from v through struct fields, methods and map
+// keys.
+func lookup(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, p := range path {
+		switch {
+		case v.Kind() == reflect.Struct && v.FieldByName(p).IsValid():
+			v = v.FieldByName(p)
+		case v.MethodByName(p).IsValid() && v.MethodByName(p).Type().NumIn() == 0:
+			v = v.MethodByName(p).Call(nil)[0]
+		case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			v = v.MapIndex(reflect.ValueOf(p))
+			if !v.IsValid() {
+				return v, false
+			}
+		default:
+			return v, false
+		}
+	}
+	return v, true
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// collectFields appends the fields of dot referred to in n.  Fields
+// within range and with refer to another dot and are skipped, except
+// those referred to via $.
+func collectFields(tree *parse.Tree, n parse.Node, dotIsRoot, unconditional bool, uses *[]fieldUse, calls *[]templateCall) {
+	add := func(node parse.Node, path []string, uncond bool) {
+		// Keep file:line of the file:line:col location.
+		location, _ := tree.ErrorContext(node)
+		if i := strings.LastIndex(location, ":"); i > 0 {
+			location = location[:i]
+		}
+		*uses = append(*uses, fieldUse{template: tree.Name, path: path, location: location, unconditional: uncond})
+	}
+	var pipe func(p *parse.PipeNode, uncond bool)
+	pipe = func(p *parse.PipeNode, uncond bool) {
+		if p == nil {
+			return
+		}
+		for _, cmd := range p.Cmds {
+			for _, arg := range cmd.Args {
+				switch a := arg.(type) {
+				case *parse.FieldNode:
+					if dotIsRoot {
+						add(a, a.Ident, uncond)
+					}
+				case *parse.VariableNode:
+					if len(a.Ident) > 1 && a.Ident[0] == "$" {
+						add(a, a.Ident[1:], uncond)
+					}
+				case *parse.PipeNode:
+					pipe(a, false)
+				}
+			}
+		}
+	}
+
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectFields(tree, c, dotIsRoot, unconditional, uses, calls)
+		}
+	case *parse.ActionNode:
+		// Only plain output, not function calls like or or
+		// default, is reported as empty.
+		pipe(n.Pipe, unconditional && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1)
+	case *parse.TemplateNode:
+		pipe(n.Pipe, false)
+		*calls = append(*calls, templateCall{tree.Name, n.Name, unconditional})
+	case *parse.IfNode:
+		pipe(n.Pipe, false)
+		collectFields(tree, n.List, dotIsRoot, false, uses, calls)
+		collectFields(tree, n.ElseList, dotIsRoot, false, uses, calls)
+	case *parse.RangeNode:
+		pipe(n.Pipe, false)
+		collectFields(tree, n.List, false, false, uses, calls)
+		collectFields(tree, n.ElseList, dotIsRoot, false, uses, calls)
+	case *parse.WithNode:
+		pipe(n.Pipe, false)
+		collectFields(tree, n.List, false, false, uses, calls)
+		collectFields(tree, n.ElseList, dotIsRoot, false, uses, calls)
+	}
+}
@@ -0,0 +1,45 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestCheckVariables(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "a.template"), []byte(`{{ define "cc-template" }}
+hostname: {{ .Hostname }}
+image: {{ .Images.hyperkube }}
+typo: {{ .Hostnmae }}
+missing: {{ .Images.flannel }}
+repo: {{ .CentOSYumRepo }}
+{{- if .GPU }}
+drivers: {{ .GPUDriversVersion }}
+{{- end }}
+{{- range .Images }}{{ .NoSuchField }}{{ $.Dockerdomain }}{{ end }}
+key: {{ .Key }}
+{{- if .Quarantine }}{{ template "quarantine" . }}{{ end }}
+{{- end }}
+{{ define "quarantine" }}reason: {{ .Quarantine }}{{ end }}`), 0644))
+
+	c := &clusterdesc.Cluster{
+		Dockerdomain: "bootstrapper",
+		Images:       map[string]string{"hyperkube": "pineking/hyperkube-amd64:2169be"},
+		Nodes:        []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80"}},
+	}
+	undefined, empty, e := CheckVariables(dir, c)
+	assert.Nil(t, e)
+	assert.Equal(t, []string{
+		"a.template:4: .Hostnmae",
+		"a.template:5: .Images.flannel",
+	}, undefined)
+	assert.Equal(t, []string{"a.template:6: .CentOSYumRepo"}, empty)
+}
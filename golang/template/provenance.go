@@ -0,0 +1,70 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// Provenance tells what a node is supposed to be: the config it was
+// rendered from, when, and by which bootstrapper.  It is rendered
+// into /etc/motd and /etc/issue of the node, but for Rendered, which
+// is left zero in the template data, so that rendering the same
+// config again gives the same output, see Record.Replay.
+type Provenance struct {
+	MAC           string
+	Hostname      string
+	Role          string
+	ConfigVersion string // See ConfigVersion.
+	Rendered      time.Time
+	Server        string // The URL of the bootstrapper.
+}
+
+// ConfigVersion returns a short hash of the content of
+// clusterDescFile and the template files in ccTemplateDir, which
+// changes whenever any of them is edited.
+func ConfigVersion(ccTemplateDir, clusterDescFile string) (string, error) {
+	files, e := sortedTemplateFiles(ccTemplateDir)
+	if e != nil {
+		return "", e
+	}
+	h := sha256.New()
+	for _, f := range append([]string{clusterDescFile}, files...) {
+		b, e := ioutil.ReadFile(f)
+		if e != nil {
+			return "", e
+		}
+		io.WriteString(h, path.Base(f)+"\x00")
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// roleOf describes the roles of n, like "kube-master,etcd".
+func roleOf(n clusterdesc.Node) string {
+	if n.Quarantined() {
+		return "quarantined"
+	}
+	var r []string
+	if n.KubeMaster {
+		r = append(r, "kube-master")
+	} else {
+		r = append(r, "kube-worker")
+	}
+	if n.EtcdMember {
+		r = append(r, "etcd")
+	}
+	if n.CephMonitor {
+		r = append(r, "ceph-monitor")
+	}
+	if n.IngressLabel {
+		r = append(r, "ingress")
+	}
+	return strings.Join(r, ",")
+}
@@ -0,0 +1,36 @@
+package template
+
+import "sync"
+
+// quarantines keeps the nodes quarantined at runtime, in addition to
+// those quarantined in cluster-desc, by MAC address.
+var quarantines struct {
+	sync.Mutex
+	reasons map[string]string
+}
+
+// Quarantine makes the node with MAC address mac render the
+// quarantine profile, as if its Node.Quarantine were reason, until
+// Release.  cloud-config-server uses it to stop nodes that boot loop
+// without editing cluster-desc.
+func Quarantine(mac, reason string) {
+	quarantines.Lock()
+	defer quarantines.Unlock()
+	if quarantines.reasons == nil {
+		quarantines.reasons = make(map[string]string)
+	}
+	quarantines.reasons[mac] = reason
+}
+
+// Release undoes Quarantine.
+func Release(mac string) {
+	quarantines.Lock()
+	defer quarantines.Unlock()
+	delete(quarantines.reasons, mac)
+}
+
+func quarantineOf(mac string) string {
+	quarantines.Lock()
+	defer quarantines.Unlock()
+	return quarantines.reasons[mac]
+}
@@ -0,0 +1,96 @@
+package template
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// Record captures the inputs of rendering a template for a node,
+// together with the output, so that the render can be replayed
+// later against the current code.
+type Record struct {
+	Time         time.Time
+	RemoteAddr   string
+	URL          string
+	MAC          string
+	TemplateName string
+	ClusterDesc  string            // Content of the cluster-desc file.
+	Templates    map[string]string // Template file name -> content.
+	Output       string
+	Deprecations []clusterdesc.Deprecation // Used by the render.
+}
+
+// NewRecord reads the render inputs of mac from clusterDescFile and
+// the template files in ccTemplateDir.
+func NewRecord(mac, templateName, ccTemplateDir, clusterDescFile string) (*Record, error) {
+	c, e := ioutil.ReadFile(clusterDescFile)
+	if e != nil {
+		return nil, e
+	}
+	files, e := sortedTemplateFiles(ccTemplateDir)
+	if e != nil {
+		return nil, e
+	}
+	tmpls := make(map[string]string)
+	for _, f := range files {
+		b, e := ioutil.ReadFile(f)
+		if e != nil {
+			return nil, e
+		}
+		tmpls[path.Base(f)] = string(b)
+	}
+	// Renders that failed for a broken cluster-desc are recorded
+	// too, without deprecations.
+	d, _ := Deprecations(mac, ccTemplateDir, clusterDescFile)
+	return &Record{
+		Time:         time.Now(),
+		MAC:          mac,
+		TemplateName: templateName,
+		ClusterDesc:  string(c),
+		Templates:    tmpls,
+		Deprecations: d,
+	}, nil
+}
+
+// Redact returns r with private keys and passwords in URLs masked by
+// RedactText, so records can be handed to auditors as they are.
+func (r Record) Redact() Record {
+	r.ClusterDesc = RedactText(r.ClusterDesc)
+	r.Output = RedactText(r.Output)
+	tmpls := make(map[string]string, len(r.Templates))
+	for f, content := range r.Templates {
+		tmpls[f] = RedactText(content)
+	}
+	r.Templates = tmpls
+	return r
+}
+
+// Replay renders the recorded inputs again into w.  Certificates
+// are not recorded, so they are rendered empty.
+func (r *Record) Replay(w io.Writer) error {
+	dir, e := ioutil.TempDir("", "")
+	if e != nil {
+		return e
+	}
+	defer os.RemoveAll(dir)
+
+	tmplDir := path.Join(dir, "templatefiles")
+	if e := os.Mkdir(tmplDir, 0755); e != nil {
+		return e
+	}
+	for f, content := range r.Templates {
+		if e := ioutil.WriteFile(path.Join(tmplDir, f), []byte(content), 0644); e != nil {
+			return e
+		}
+	}
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	if e := ioutil.WriteFile(clusterDescFile, []byte(r.ClusterDesc), 0644); e != nil {
+		return e
+	}
+	return Execute(w, r.MAC, r.TemplateName, tmplDir, clusterDescFile, "", "")
+}
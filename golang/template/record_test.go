@@ -0,0 +1,56 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	candy.Must(ioutil.WriteFile(path.Join(dir, "cluster-desc.yml"), []byte(`{"bootstrapper": "10.0.0.1"}`), 0644))
+	tmplDir := path.Join(dir, "templatefiles")
+	candy.Must(os.Mkdir(tmplDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "hello.template"), []byte(`{{ define "hello" }}{{ .Hostname }} {{ .BootstrapperIP }}{{ end }}`), 0644))
+
+	r, e := NewRecord("00:25:90:c0:f7:80", "hello", tmplDir, path.Join(dir, "cluster-desc.yml"))
+	assert.Nil(t, e)
+	assert.Contains(t, r.Templates, "hello.template")
+
+	var out bytes.Buffer
+	assert.Nil(t, r.Replay(&out))
+	assert.Equal(t, "00-25-90-c0-f7-80 10.0.0.1", out.String())
+}
+
+func TestReplayReproducesOutput(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	desc := path.Join(dir, "cluster-desc.yml")
+	b, e := yaml.Marshal(clusterdesc.Cluster{
+		Bootstrapper: "10.0.0.1",
+		Nodes:        []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80", KubeMaster: true}},
+	})
+	candy.Must(e)
+	candy.Must(ioutil.WriteFile(desc, b, 0644))
+
+	var out bytes.Buffer
+	p, e := ExecuteProvenance(&out, "00:25:90:c0:f7:80", "cc-template", "./templatefiles", desc, "", "")
+	candy.Must(e)
+	assert.False(t, p.Rendered.IsZero())
+
+	r, e := NewRecord("00:25:90:c0:f7:80", "cc-template", "./templatefiles", desc)
+	candy.Must(e)
+	var replayed bytes.Buffer
+	assert.Nil(t, r.Replay(&replayed))
+	assert.Equal(t, out.String(), replayed.String())
+}
@@ -0,0 +1,110 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateRoots splits ccTemplateDir, a list of template directories
+// separated by ":", like upstream:org-overlay:cluster-overlay.
+func TemplateRoots(ccTemplateDir string) []string {
+	var roots []string
+	for _, r := range filepath.SplitList(ccTemplateDir) {
+		if len(r) > 0 {
+			roots = append(roots, r)
+		}
+	}
+	return roots
+}
+
+// legacyRoots returns the roots of ccTemplateDir that are files rather
+// than directories.  Before templates were split into files, sextant
+// loaded a single file, like cloud-config.template, whose top level is
+// the cloud-config.  Such roots are still loaded, so deployments
+// migrate to template directories node by node, see parseTemplates.
+func legacyRoots(ccTemplateDir string) []string {
+	var roots []string
+	for _, root := range TemplateRoots(ccTemplateDir) {
+		if fi, e := os.Stat(root); e == nil && fi.Mode().IsRegular() {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// TemplateFiles returns the template files in the roots listed in
+// ccTemplateDir, by file name.  A file in a later root overrides the
+// file of the same name in earlier roots, so sites customize the
+// upstream templates without forking them.  A root that is a file, of
+// the legacy layout, is itself a template file.
+func TemplateFiles(ccTemplateDir string) (map[string]string, error) {
+	files := make(map[string]string)
+	legacy := make(map[string]bool)
+	for _, root := range legacyRoots(ccTemplateDir) {
+		legacy[root] = true
+	}
+	for _, root := range TemplateRoots(ccTemplateDir) {
+		if legacy[root] {
+			files[path.Base(root)] = root
+			continue
+		}
+		matches, e := filepath.Glob(root + "/*")
+		if e != nil {
+			return nil, e
+		}
+		for _, f := range matches {
+			files[path.Base(f)] = f
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no template files in %s", strings.Join(TemplateRoots(ccTemplateDir), ", "))
+	}
+	return files, nil
+}
+
+// sortedTemplateFiles returns the paths of TemplateFiles sorted by
+// file name.
+func sortedTemplateFiles(ccTemplateDir string) ([]string, error) {
+	files, e := TemplateFiles(ccTemplateDir)
+	if e != nil {
+		return nil, e
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = files[name]
+	}
+	return paths, nil
+}
+
+// parseTemplates parses the TemplateFiles of ccTemplateDir.  Unless a
+// template file defines cc-template, the top level of the last legacy
+// root is cc-template.
+func parseTemplates(ccTemplateDir string) (*template.Template, error) {
+	files, e := sortedTemplateFiles(ccTemplateDir)
+	if e != nil {
+		return nil, e
+	}
+	t, e := template.ParseFiles(files...)
+	if e != nil {
+		return nil, e
+	}
+	legacy := legacyRoots(ccTemplateDir)
+	if len(legacy) > 0 && t.Lookup("cc-template") == nil {
+		if l := t.Lookup(path.Base(legacy[len(legacy)-1])); l != nil && l.Tree != nil {
+			if _, e := t.AddParseTree("cc-template", l.Tree); e != nil {
+				return nil, e
+			}
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,71 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestTemplateRoots(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	overlay := path.Join(dir, "overlay")
+	candy.Must(os.Mkdir(overlay, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(overlay, "cc-common.template"),
+		[]byte(`{{ define "common" }}
+  - path: /etc/site-overlay
+    content: overlaid
+{{ end }}`), 0644))
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(clusterDescFile, []byte(`{"dockerdomain": "bootstrapper"}`), 0644))
+
+	roots := "./templatefiles:" + overlay + ":"
+	assert.Equal(t, []string{"./templatefiles", overlay}, TemplateRoots(roots))
+	files, e := TemplateFiles(roots)
+	assert.Nil(t, e)
+	assert.Equal(t, path.Join(overlay, "cc-common.template"), files["cc-common.template"])
+	assert.Equal(t, "templatefiles/cc-coreos.template", files["cc-coreos.template"])
+
+	var out bytes.Buffer
+	assert.Nil(t, Execute(&out, "00:25:90:c0:f7:80", "cc-template", roots, clusterDescFile, "", ""))
+	assert.Contains(t, out.String(), "/etc/site-overlay")
+	assert.NotContains(t, out.String(), "/etc/modules-load.d/rbd.conf")
+
+	_, e = TemplateFiles(path.Join(dir, "none"))
+	assert.NotNil(t, e)
+}
+
+func TestLegacyTemplateRoot(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	legacy := path.Join(dir, "cloud-config.template")
+	candy.Must(ioutil.WriteFile(legacy, []byte(`{"hostname": "{{ .Hostname }}"}`), 0644))
+	clusterDescFile := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(clusterDescFile, []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80"}]}`), 0644))
+
+	files, e := TemplateFiles(legacy)
+	assert.Nil(t, e)
+	assert.Equal(t, map[string]string{"cloud-config.template": legacy}, files)
+
+	var out bytes.Buffer
+	assert.Nil(t, Execute(&out, "00:25:90:c0:f7:80", "cc-template", legacy, clusterDescFile, "", ""))
+	assert.Equal(t, `{"hostname": "00-25-90-c0-f7-80"}`, out.String())
+
+	d, e := TemplateDeprecations(legacy)
+	assert.Nil(t, e)
+	if assert.Equal(t, 1, len(d)) {
+		assert.Contains(t, d[0].Construct, legacy)
+	}
+
+	// A template directory overlaid on the legacy root takes over.
+	out.Reset()
+	assert.Nil(t, Execute(&out, "00:25:90:c0:f7:80", "cc-template", legacy+":./templatefiles", clusterDescFile, "", ""))
+	assert.Contains(t, out.String(), "#cloud-config")
+}
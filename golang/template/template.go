@@ -1,14 +1,17 @@
 package template
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/k8sp/sextant/golang/certgen"
 	"github.com/k8sp/sextant/golang/clusterdesc"
-	"github.com/topicai/candy"
 	"gopkg.in/yaml.v2"
 )
 
@@ -27,13 +30,18 @@ type ExecutionConfig struct {
 	MasterIP                 string
 	MasterHostname           string
 	BootstrapperIP           string
+	BootstrapperURL          string
+	BootstrapperHTTPSURL     string
 	CentOSYumRepo            string
 	CaCrt                    string
 	Crt                      string
-	Key                      string
+	Key                      string `redact:"true"`
 	Dockerdomain             string
 	K8sClusterDNS            string
 	K8sServiceClusterIPRange string
+	K8sNodePortRange         string
+	PodNetwork               string
+	KubeProxyMode            string
 	ZapAndStartOSD           bool
 	Images                   map[string]string
 	FlannelBackend           string
@@ -42,41 +50,207 @@ type ExecutionConfig struct {
 	TimeLength               string
 	CoreOSVersion            string
 	GPUDriversVersion        string
+	GPU                      bool
 	OSName                   string
+	Quarantine               string
+	Kubernetes               clusterdesc.KubernetesFeatures
+	Extra                    map[string]map[string]interface{} // By ContextProvider name.
+
+	// Firewall enables the rules that open only FirewallPorts to
+	// hosts outside of FirewallTrustedCIDRs.
+	Firewall             bool
+	FirewallTrustedCIDRs []string
+	FirewallPorts        []clusterdesc.FirewallPort
+
+	Provenance Provenance // Filled only by ExecuteProvenance.
+
+	DropIns []clusterdesc.UnitDropIn
+
+	// SSHCA is the public key of the SSH CA, which nodes trust for
+	// user certificates, and which signed SSHHostKey into
+	// SSHHostCert.  All are empty unless certgen.SSHCAKey is set.
+	SSHCA       string
+	SSHHostKey  string `redact:"true"`
+	SSHHostCert string
+
+	// NodeToken is the credential of the node for uploading its
+	// first-boot report, empty without a CA.
+	NodeToken string `redact:"true"`
+
+	// KubeReserved and SystemReserved are the resource
+	// reservations of the kubelet, empty if unknown.
+	KubeReserved   string
+	SystemReserved string
+
+	Sysctls []clusterdesc.Sysctl
+	Swap    clusterdesc.Swap
 }
 
 // Execute load template files from "ccTemplateDir", parse clusterDescFile to
 // "clusterdesc.Cluster" struct and then run the templateName
 func Execute(w io.Writer, mac, templateName, ccTemplateDir, clusterDescFile, caKey, caCrt string) error {
+	_, e := ExecuteProvenance(w, mac, templateName, ccTemplateDir, clusterDescFile, caKey, caCrt)
+	return e
+}
+
+// ExecuteProvenance is Execute that also returns the Provenance
+// rendered into the output.
+func ExecuteProvenance(w io.Writer, mac, templateName, ccTemplateDir, clusterDescFile, caKey, caCrt string) (*Provenance, error) {
+	return execute(w, mac, templateName, ccTemplateDir, clusterDescFile, caKey, caCrt, false)
+}
+
+// checkConfig runs the checks a config must pass to be rendered.
+func checkConfig(c *clusterdesc.Cluster, ccTemplateDir string) error {
+	if e := c.CheckKubernetesVersion(); e != nil {
+		return e
+	}
+	if e := c.CheckSystemdDropIns(); e != nil {
+		return e
+	}
+	if e := c.CheckSysctl(); e != nil {
+		return e
+	}
+	if e := c.CheckFirewall(); e != nil {
+		return e
+	}
+	if e := c.CheckMinSextantVersion(); e != nil {
+		return e
+	}
+	return CheckTemplateVersions(ccTemplateDir)
+}
+
+// execute is the render path shared by ExecuteProvenance and
+// ExecuteDebug, so what is debugged or smoke tested passes the same
+// checks as what nodes get.  With trace, output lines are annotated,
+// see ExecuteDebug.
+func execute(w io.Writer, mac, templateName, ccTemplateDir, clusterDescFile, caKey, caCrt string, trace bool) (*Provenance, error) {
 	// Load data from file every time, no need to read from remote url
-	t, parseErr := template.ParseGlob(ccTemplateDir + "/*")
+	t, parseErr := parseTemplates(ccTemplateDir)
 	if parseErr != nil {
-		return parseErr
+		return nil, parseErr
+	}
+	if trace {
+		for _, tmpl := range t.Templates() {
+			if tmpl.Tree != nil {
+				traceNode(tmpl.Tree, tmpl.Tree.Root)
+			}
+		}
+	}
+	c, loadErr := LoadClusterDesc(clusterDescFile)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	if e := checkConfig(c, ccTemplateDir); e != nil {
+		return nil, e
+	}
+	version, e := ConfigVersion(ccTemplateDir, clusterDescFile)
+	if e != nil {
+		return nil, e
+	}
+	confData, e := GetConfigDataByMac(mac, c, caKey, caCrt)
+	if e != nil {
+		return nil, e
+	}
+	confData.Provenance = Provenance{
+		MAC:           mac,
+		Hostname:      confData.Hostname,
+		Role:          roleOf(getNodeByMAC(c, mac)),
+		ConfigVersion: version,
+		Server:        confData.BootstrapperURL,
+	}
+	p := confData.Provenance
+	p.Rendered = time.Now().UTC()
+	return &p, t.ExecuteTemplate(w, templateName, *confData)
+}
+
+// EffectiveConfig returns the data the templates are executed with
+// for mac, without certs and keys, so operators can tell which value
+// a node actually gets.
+func EffectiveConfig(mac, clusterDescFile string) (*ExecutionConfig, error) {
+	c, e := LoadClusterDesc(clusterDescFile)
+	if e != nil {
+		return nil, e
 	}
-	clusterDescBuff, readErr := ioutil.ReadFile(clusterDescFile)
-	if readErr != nil {
-		return readErr
+	return GetConfigDataByMac(mac, c, "", "")
+}
+
+// clusterDescCache memoizes the most recently decoded cluster
+// description together with the bytes it was decoded from, so that
+// requests served from an unchanged cluster-desc file don't
+// re-unmarshal it every time.
+var clusterDescCache struct {
+	sync.Mutex
+	content []byte
+	cluster *clusterdesc.Cluster
+}
+
+// LoadClusterDesc reads clusterDescFile and returns the decoded
+// cluster description.  The file is read on every call, so edits are
+// picked up immediately, but it is decoded only when its content
+// differs from that of the previous call.  The returned Cluster is
+// shared between callers and must not be modified.
+func LoadClusterDesc(clusterDescFile string) (*clusterdesc.Cluster, error) {
+	b, e := ioutil.ReadFile(clusterDescFile)
+	if e != nil {
+		return nil, e
 	}
+
+	clusterDescCache.Lock()
+	defer clusterDescCache.Unlock()
+	if clusterDescCache.cluster != nil && bytes.Equal(b, clusterDescCache.content) {
+		return clusterDescCache.cluster, nil
+	}
+
 	c := &clusterdesc.Cluster{}
-	candy.Must(yaml.Unmarshal(clusterDescBuff, c))
-	confData := GetConfigDataByMac(mac, c, caKey, caCrt)
-	return t.ExecuteTemplate(w, templateName, *confData)
+	if e := yaml.Unmarshal(b, c); e != nil {
+		return nil, e
+	}
+	clusterDescCache.content = b
+	clusterDescCache.cluster = c
+	return c, nil
 }
 
 // GetConfigDataByMac returns data struct for cloud-config template to execute
-func GetConfigDataByMac(mac string, clusterdesc *clusterdesc.Cluster, caKey, caCrt string) *ExecutionConfig {
+func GetConfigDataByMac(mac string, clusterdesc *clusterdesc.Cluster, caKey, caCrt string) (*ExecutionConfig, error) {
 	node := getNodeByMAC(clusterdesc, mac)
 	ca, e := ioutil.ReadFile(caCrt)
-	var k, c []byte
-	if e == nil {
+	var k, c, sshKey, sshCrt []byte
+	sshCA, nodeToken := "", ""
+	if node.Quarantined() {
+		glog.Warningf("Serving the quarantine profile to %s: %s", node.Hostname(), node.Quarantine)
+	} else if e == nil {
 		k, c = certgen.Gen(false, node.Hostname(), caKey, caCrt, clusterdesc.KubeMasterIP, clusterdesc.KubeMasterDNS)
 		if node.KubeMaster == true {
 			k, c = certgen.Gen(true, node.Hostname(), caKey, caCrt, clusterdesc.KubeMasterIP, clusterdesc.KubeMasterDNS)
 		}
+		if nodeToken, e = certgen.NodeToken(caKey, node.Hostname()); e != nil {
+			return nil, fmt.Errorf("cannot issue the node token: %v", e)
+		}
+		if len(*certgen.SSHCAKey) > 0 {
+			if sshCA, e = certgen.SSHCAPublicKey(*certgen.SSHCAKey); e != nil {
+				return nil, fmt.Errorf("cannot read the SSH CA: %v", e)
+			}
+			sshKey, sshCrt, e = certgen.CachedSSHHost(node.Hostname(), *certgen.SSHCAKey, sshHostNames(clusterdesc, node), *certgen.SSHHostCertTTL)
+			if e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	kubeReserved, systemReserved := clusterdesc.Reservations(node, hardwareOf(node))
+	firewallPorts, e := clusterdesc.FirewallPorts(node)
+	if e != nil {
+		return nil, e
+	}
+
+	gpu := node.GPU && clusterdesc.GPUDriversLicenseAccepted
+	if gpu {
+		glog.Infof("Linking GPU drivers %s into %s under the accepted license", clusterdesc.GPUDriversVersion, node.Hostname())
 	}
 
 	return &ExecutionConfig{
 		Hostname:                 node.Hostname(),
+		IP:                       node.IP,
 		CephMonitor:              node.CephMonitor,
 		KubeMaster:               node.KubeMaster,
 		EtcdMember:               node.EtcdMember,
@@ -87,12 +261,17 @@ func GetConfigDataByMac(mac string, clusterdesc *clusterdesc.Cluster, caKey, caC
 		MasterHostname:           clusterdesc.GetMasterHostname(),
 		EtcdEndpoints:            clusterdesc.GetEtcdEndpoints(),
 		BootstrapperIP:           clusterdesc.Bootstrapper,
+		BootstrapperURL:          clusterdesc.BootstrapperURL(),
+		BootstrapperHTTPSURL:     clusterdesc.BootstrapperHTTPSURL(),
 		CentOSYumRepo:            clusterdesc.CentOSYumRepo,
 		Dockerdomain:             clusterdesc.Dockerdomain,
 		K8sClusterDNS:            clusterdesc.K8sClusterDNS,
 		K8sServiceClusterIPRange: clusterdesc.K8sServiceClusterIPRange,
+		K8sNodePortRange:         clusterdesc.K8sNodePortRange,
+		PodNetwork:               clusterdesc.PodNetwork(),
+		KubeProxyMode:            clusterdesc.ProxyMode(),
 		ZapAndStartOSD:           clusterdesc.Ceph.ZapAndStartOSD,
-		Images:                   clusterdesc.Images,
+		Images:                   clusterdesc.PinnedImages(),
 		// Mulit-line context in yaml should keep the indent,
 		// there is no good idea for templaet package to auto keep the indent so far,
 		// so insert 6*whitespace at the begging of every line
@@ -105,15 +284,55 @@ func GetConfigDataByMac(mac string, clusterdesc *clusterdesc.Cluster, caKey, caC
 		TimeLength:        clusterdesc.CoreOS.TimeLength,
 		CoreOSVersion:     clusterdesc.CoreOSVersion,
 		GPUDriversVersion: clusterdesc.GPUDriversVersion,
+		GPU:               gpu,
+		Quarantine:        node.Quarantine,
+		Kubernetes:        clusterdesc.Kubernetes(),
 		OSName:            clusterdesc.OSName,
+		Extra:             extraContext(node),
+
+		Firewall:             clusterdesc.Firewall.Enabled && !node.Quarantined(),
+		FirewallTrustedCIDRs: clusterdesc.FirewallTrustedCIDRs(),
+		FirewallPorts:        firewallPorts,
+
+		DropIns: clusterdesc.DropIns(node),
+
+		SSHCA:       sshCA,
+		SSHHostKey:  strings.Join(strings.Split(string(sshKey), "\n"), "\n      "),
+		SSHHostCert: strings.TrimSpace(string(sshCrt)),
+
+		NodeToken: nodeToken,
+
+		KubeReserved:   kubeReserved,
+		SystemReserved: systemReserved,
+
+		Sysctls: clusterdesc.Sysctls(node),
+		Swap:    clusterdesc.SwapPolicy(),
+	}, nil
+}
+
+// sshHostNames returns the names the SSH host certificate of node is
+// valid for.
+func sshHostNames(c *clusterdesc.Cluster, node clusterdesc.Node) []string {
+	names := []string{node.Hostname()}
+	if len(c.DomainName) > 0 {
+		names = append(names, node.Hostname()+"."+c.DomainName)
+	}
+	if len(node.IP) > 0 {
+		names = append(names, node.IP)
 	}
+	return names
 }
 
 func getNodeByMAC(c *clusterdesc.Cluster, mac string) clusterdesc.Node {
-	for _, n := range c.Nodes {
-		if n.Mac() == mac {
-			return n
+	n := clusterdesc.Node{MAC: mac, CephMonitor: false, KubeMaster: false, EtcdMember: false}
+	for _, node := range c.Nodes {
+		if node.Mac() == mac {
+			n = node
+			break
 		}
 	}
-	return clusterdesc.Node{MAC: mac, CephMonitor: false, KubeMaster: false, EtcdMember: false}
+	if !n.Quarantined() {
+		n.Quarantine = quarantineOf(mac)
+	}
+	return n
 }
@@ -38,8 +38,12 @@ func TestExecute(t *testing.T) {
 	tmpl, e := template.ParseGlob("./templatefiles/*")
 	candy.Must(e)
 	var ccTmpl bytes.Buffer
-	confData := GetConfigDataByMac("00:25:90:c0:f7:80", config, caKey, caCrt)
+	confData := mustConfigData("00:25:90:c0:f7:80", config, caKey, caCrt)
 	candy.Must(tmpl.ExecuteTemplate(&ccTmpl, "cc-template", *confData))
+	token, e := certgen.NodeToken(caKey, "00-25-90-c0-f7-80")
+	candy.Must(e)
+	assert.Contains(t, ccTmpl.String(), `-H "Authorization: Bearer `+token+`"`)
+	assert.Contains(t, ccTmpl.String(), "--cacert /etc/kubernetes/ssl/ca.pem -o $bundle -w '%{http_code}' "+config.BootstrapperHTTPSURL()+"/ca-bundle)")
 	yml := make(map[interface{}]interface{})
 	candy.Must(yaml.Unmarshal(ccTmpl.Bytes(), yml))
 	switch i := config.OSName; i {
@@ -56,3 +60,104 @@ func TestExecute(t *testing.T) {
 	}
 
 }
+
+func TestLoadClusterDescMemoized(t *testing.T) {
+	f, e := ioutil.TempFile("", "")
+	candy.Must(e)
+	defer os.Remove(f.Name())
+
+	candy.Must(ioutil.WriteFile(f.Name(), []byte(`{"bootstrapper": "10.0.0.1"}`), 0644))
+	c1, e := LoadClusterDesc(f.Name())
+	assert.Nil(t, e)
+	assert.Equal(t, "10.0.0.1", c1.Bootstrapper)
+	c2, e := LoadClusterDesc(f.Name())
+	assert.Nil(t, e)
+	assert.True(t, c1 == c2)
+
+	candy.Must(ioutil.WriteFile(f.Name(), []byte(`{"bootstrapper": "10.0.0.2"}`), 0644))
+	c3, e := LoadClusterDesc(f.Name())
+	assert.Nil(t, e)
+	assert.Equal(t, "10.0.0.2", c3.Bootstrapper)
+}
+
+func TestGPULicenseGating(t *testing.T) {
+	c := &clusterdesc.Cluster{
+		Nodes: []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80", GPU: true}},
+	}
+	assert.False(t, mustConfigData("00:25:90:c0:f7:80", c, "", "").GPU)
+
+	c.GPUDriversLicenseAccepted = true
+	assert.True(t, mustConfigData("00:25:90:c0:f7:80", c, "", "").GPU)
+	assert.False(t, mustConfigData("0c:c4:7a:82:c5:bc", c, "", "").GPU)
+}
+
+func TestExecuteQuarantine(t *testing.T) {
+	c := &clusterdesc.Cluster{
+		Nodes: []clusterdesc.Node{
+			{MAC: "00:25:90:c0:f7:80", KubeMaster: true, Quarantine: "burn-in failed"},
+		},
+	}
+	tmpl, e := template.ParseGlob("./templatefiles/*")
+	candy.Must(e)
+	var ccTmpl bytes.Buffer
+	confData := mustConfigData("00:25:90:c0:f7:80", c, "", "")
+	candy.Must(tmpl.ExecuteTemplate(&ccTmpl, "cc-template", *confData))
+	assert.Contains(t, ccTmpl.String(), "This node is quarantined: burn-in failed")
+	assert.NotContains(t, ccTmpl.String(), "kube-apiserver")
+
+	c.OSName = "CentOS"
+	var post bytes.Buffer
+	candy.Must(tmpl.ExecuteTemplate(&post, "centos-post-script", *mustConfigData("00:25:90:c0:f7:80", c, "", "")))
+	assert.Contains(t, post.String(), "\nset_ssh_config\n")
+	assert.NotContains(t, post.String(), "\nset_docker\n")
+	assert.NotContains(t, post.String(), "\nset_yum_repo\n")
+}
+
+func TestRuntimeQuarantine(t *testing.T) {
+	c := &clusterdesc.Cluster{
+		Nodes: []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80", KubeMaster: true}},
+	}
+	Quarantine("00:25:90:c0:f7:80", "boot loop")
+	assert.Equal(t, "boot loop", mustConfigData("00:25:90:c0:f7:80", c, "", "").Quarantine)
+	assert.Equal(t, "", mustConfigData("0c:c4:7a:82:c5:bc", c, "", "").Quarantine)
+
+	// Reasons in cluster-desc take precedence.
+	c.Nodes[0].Quarantine = "burn-in failed"
+	assert.Equal(t, "burn-in failed", mustConfigData("00:25:90:c0:f7:80", c, "", "").Quarantine)
+
+	Release("00:25:90:c0:f7:80")
+	c.Nodes[0].Quarantine = ""
+	assert.Equal(t, "", mustConfigData("00:25:90:c0:f7:80", c, "", "").Quarantine)
+}
+
+func TestExecuteKubernetesVersion(t *testing.T) {
+	tmpl, e := template.ParseGlob("./templatefiles/*")
+	candy.Must(e)
+	for _, osName := range []string{"CoreOS", "CentOS"} {
+		for _, master := range []bool{true, false} {
+			c := &clusterdesc.Cluster{
+				OSName: osName,
+				Nodes:  []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80", KubeMaster: master}},
+			}
+			var ccTmpl bytes.Buffer
+			candy.Must(tmpl.ExecuteTemplate(&ccTmpl, "cc-template", *mustConfigData("00:25:90:c0:f7:80", c, "", "")))
+			assert.Contains(t, ccTmpl.String(), "--cluster-domain=cluster.local \\\n")
+			assert.Contains(t, ccTmpl.String(), "--feature-gates=Accelerators=true")
+			if master {
+				assert.Contains(t, ccTmpl.String(), "- --storage-backend=etcd2\n")
+			}
+
+			c.KubernetesVersion = "1.5"
+			ccTmpl.Reset()
+			candy.Must(tmpl.ExecuteTemplate(&ccTmpl, "cc-template", *mustConfigData("00:25:90:c0:f7:80", c, "", "")))
+			assert.NotContains(t, ccTmpl.String(), "--feature-gates")
+			assert.NotContains(t, ccTmpl.String(), "--storage-backend")
+		}
+	}
+}
+
+func mustConfigData(mac string, c *clusterdesc.Cluster, caKey, caCrt string) *ExecutionConfig {
+	d, e := GetConfigDataByMac(mac, c, caKey, caCrt)
+	candy.Must(e)
+	return d
+}
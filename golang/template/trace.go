@@ -0,0 +1,65 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// ExecuteDebug renders templateName for mac like Execute, except that
+// certs are left out, so the output is safe to show for debugging.
+// With trace, every output line that starts with template text is
+// prefixed with the template file and line it comes from, like
+//
+//	cc-coreos.template:42| - name: kubelet.service
+func ExecuteDebug(w io.Writer, mac, templateName, ccTemplateDir, clusterDescFile string, trace bool) error {
+	_, e := execute(w, mac, templateName, ccTemplateDir, clusterDescFile, "", "", trace)
+	return e
+}
+
+// traceNode prefixes the lines in the text nodes under n with their
+// location in the template file.
+func traceNode(tree *parse.Tree, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			traceNode(tree, c)
+		}
+	case *parse.IfNode:
+		traceNode(tree, n.List)
+		traceNode(tree, n.ElseList)
+	case *parse.RangeNode:
+		traceNode(tree, n.List)
+		traceNode(tree, n.ElseList)
+	case *parse.WithNode:
+		traceNode(tree, n.List)
+		traceNode(tree, n.ElseList)
+	case *parse.TextNode:
+		// ErrorContext returns the location as file:line:col.
+		location, _ := tree.ErrorContext(n)
+		parts := strings.Split(location, ":")
+		if len(parts) < 3 {
+			return
+		}
+		file := strings.Join(parts[:len(parts)-2], ":")
+		line, e := strconv.Atoi(parts[len(parts)-2])
+		if e != nil {
+			return
+		}
+		var b bytes.Buffer
+		for _, c := range n.Text {
+			b.WriteByte(c)
+			if c == '\n' {
+				line++
+				fmt.Fprintf(&b, "%s:%d| ", file, line)
+			}
+		}
+		n.Text = b.Bytes()
+	}
+}
@@ -0,0 +1,64 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+	"gopkg.in/yaml.v2"
+)
+
+func TestExecuteDebugTrace(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	tmplDir := path.Join(dir, "templatefiles")
+	candy.Must(os.Mkdir(tmplDir, 0755))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "a.template"), []byte(`{{ define "cc-template" }}
+hostname: {{ .Hostname }}
+{{- if .KubeMaster }}
+master: true
+{{- end }}
+{{ template "b" . }}
+{{- end }}`), 0644))
+	candy.Must(ioutil.WriteFile(path.Join(tmplDir, "b.template"), []byte(`{{ define "b" }}
+keys: {{ .Key }}
+{{- end }}`), 0644))
+	desc := path.Join(dir, "cluster-desc.yml")
+	candy.Must(ioutil.WriteFile(desc, []byte(`{"nodes": [{"mac": "00:25:90:c0:f7:80"}]}`), 0644))
+
+	var b bytes.Buffer
+	assert.Nil(t, ExecuteDebug(&b, "00:25:90:c0:f7:80", "cc-template", tmplDir, desc, true))
+	assert.Equal(t, `
+a.template:2| hostname: 00-25-90-c0-f7-80
+a.template:6| 
+b.template:2| keys: `, b.String())
+
+	b.Reset()
+	assert.Nil(t, ExecuteDebug(&b, "00:25:90:c0:f7:80", "cc-template", tmplDir, desc, false))
+	assert.Equal(t, "\nhostname: 00-25-90-c0-f7-80\n\nkeys: ", b.String())
+}
+
+func TestExecuteDebugChecks(t *testing.T) {
+	dir, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(dir)
+	desc := path.Join(dir, "cluster-desc.yml")
+	b, e := yaml.Marshal(clusterdesc.Cluster{
+		SystemdDropIns: map[string]clusterdesc.DropIn{"docker": {"Service": {"Restart": {"always"}}}},
+		Nodes:          []clusterdesc.Node{{MAC: "00:25:90:c0:f7:80"}},
+	})
+	candy.Must(e)
+	candy.Must(ioutil.WriteFile(desc, b, 0644))
+
+	// Debug renders fail the checks that renders for nodes fail.
+	var out bytes.Buffer
+	_, e = ExecuteProvenance(&out, "00:25:90:c0:f7:80", "cc-template", "./templatefiles", desc, "", "")
+	assert.Error(t, e)
+	assert.Equal(t, e, ExecuteDebug(&out, "00:25:90:c0:f7:80", "cc-template", "./templatefiles", desc, false))
+}
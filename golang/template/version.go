@@ -0,0 +1,45 @@
+package template
+
+import (
+	"io/ioutil"
+	"regexp"
+
+	"github.com/k8sp/sextant/golang/clusterdesc"
+)
+
+// minVersionComment matches the comments, like
+//
+//	{{/* sextant >= 1.1 */}}
+//
+// by which a template declares the oldest sextant it works with.
+var minVersionComment = regexp.MustCompile(`\{\{-?\s*/\*\s*sextant\s*>=\s*(\S+)\s*\*/\s*-?\}\}`)
+
+// CheckTemplateVersion returns an error if content, of the template
+// described by what, declares that it requires a newer sextant.
+func CheckTemplateVersion(what string, content []byte) error {
+	for _, m := range minVersionComment.FindAllSubmatch(content, -1) {
+		if e := clusterdesc.CheckVersion(what, string(m[1])); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// CheckTemplateVersions returns an error if a template in
+// ccTemplateDir requires a newer sextant.
+func CheckTemplateVersions(ccTemplateDir string) error {
+	files, e := sortedTemplateFiles(ccTemplateDir)
+	if e != nil {
+		return e
+	}
+	for _, f := range files {
+		b, e := ioutil.ReadFile(f)
+		if e != nil {
+			return e
+		}
+		if e := CheckTemplateVersion("template "+f, b); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/topicai/candy"
+)
+
+func TestCheckTemplateVersions(t *testing.T) {
+	assert.Nil(t, CheckTemplateVersions("./templatefiles"))
+
+	site, e := ioutil.TempDir("", "")
+	candy.Must(e)
+	defer os.RemoveAll(site)
+	candy.Must(ioutil.WriteFile(path.Join(site, "cc-site.template"), []byte("{{/* sextant >= 1.0 */}}\n{{ define \"site\" }}{{ end }}\n"), 0644))
+	assert.Nil(t, CheckTemplateVersions("./templatefiles:"+site))
+
+	candy.Must(ioutil.WriteFile(path.Join(site, "cc-site.template"), []byte("{{- /* sextant >= 99.1 */ -}}\n"), 0644))
+	e = CheckTemplateVersions("./templatefiles:" + site)
+	if assert.NotNil(t, e) {
+		assert.Contains(t, e.Error(), "cc-site.template requires sextant 99.1 or newer")
+	}
+}
@@ -25,7 +25,7 @@ import (
 
 func main() {
 	clusterDesc := flag.String("cluster-desc", "./cluster-desc.yml", "Configurations for a k8s cluster.")
-	ccTemplateDir := flag.String("cloud-config-dir", "./cloud-config.template", "cloud-config file template.")
+	ccTemplateDir := flag.String("cloud-config-dir", "./cloud-config.template", "cloud-config file template directories, separated by ':', where later ones override earlier ones.")
 	flag.Parse()
 
 	glog.Info("Checking %s ...", *clusterDesc)
@@ -42,9 +42,11 @@ func main() {
 func validation(clusterDescFile string, ccTemplateDir string) error {
 	clusterDesc, err := ioutil.ReadFile(clusterDescFile)
 	candy.Must(err)
-	_, direrr := os.Stat(ccTemplateDir)
-	if os.IsNotExist(direrr) {
-		return direrr
+	for _, dir := range cctemplate.TemplateRoots(ccTemplateDir) {
+		_, direrr := os.Stat(dir)
+		if os.IsNotExist(direrr) {
+			return direrr
+		}
 	}
 
 	c := &clusterdesc.Cluster{}
@@ -63,6 +65,9 @@ func validation(clusterDescFile string, ccTemplateDir string) error {
 	countEtcdMember := 0
 	countKubeMaster := 0
 	for _, node := range c.Nodes {
+		if node.Quarantined() {
+			continue
+		}
 		if node.EtcdMember {
 			countEtcdMember++
 		}
@@ -74,10 +79,64 @@ func validation(clusterDescFile string, ccTemplateDir string) error {
 		return errors.New("Cluster description yaml should include one master and one etcd member at least.")
 	}
 
+	if err = c.CheckKubernetesVersion(); err != nil {
+		return errors.New("Cluster description yaml: " + err.Error())
+	}
+
+	if err = c.CheckMinSextantVersion(); err != nil {
+		return err
+	}
+
+	if err = cctemplate.CheckTemplateVersions(ccTemplateDir); err != nil {
+		return err
+	}
+
+	if err = c.CheckCapacity(); err != nil {
+		return errors.New("Cluster description yaml capacity: " + err.Error())
+	}
+
+	if err = c.CheckNetworks(); err != nil {
+		return errors.New("Cluster description yaml networks: " + err.Error())
+	}
+
+	if err = c.CheckSystemdDropIns(); err != nil {
+		return errors.New("Cluster description yaml: " + err.Error())
+	}
+
+	if err = c.CheckFirewall(); err != nil {
+		return errors.New("Cluster description yaml firewall: " + err.Error())
+	}
+
+	if err = c.CheckSysctl(); err != nil {
+		return errors.New("Cluster description yaml: " + err.Error())
+	}
+
+	if err = c.CheckFailureDomains(); err != nil {
+		return errors.New("Cluster description yaml failure domains: " + err.Error())
+	}
+
 	if len(c.SSHAuthorizedKeys) == 0 {
 		return errors.New("Cluster description yaml should include one ssh key.")
 	}
 
+	undefined, empty, err := cctemplate.CheckVariables(ccTemplateDir, c)
+	if err != nil {
+		return errors.New("Parse templates failed: " + err.Error())
+	}
+	if len(undefined) > 0 {
+		return errors.New("Templates refer to undefined variables:\n" + strings.Join(undefined, "\n"))
+	}
+	for _, v := range empty {
+		glog.Warningf("Template variable is empty for every node: %s", v)
+	}
+	deprecated, err := cctemplate.TemplateDeprecations(ccTemplateDir)
+	if err != nil {
+		return errors.New("Parse templates failed: " + err.Error())
+	}
+	for _, d := range append(c.Deprecations(clusterdesc.Node{}), deprecated...) {
+		glog.Warningf("Deprecated %s: %s", d.Construct, d.Advice)
+	}
+
 	caKey := "./tmp_ca.key"
 	caCrt := "./tmp_ca.crt"
 	certgen.GenerateCA(caKey, caCrt)
@@ -48,6 +48,13 @@ if [[ "$?" -ne 0 ||  "$BS_IP" == "" ]]; then
 fi
 echo "Using bootstrapper server IP $BS_IP"
 
+# Nodes fetch configs and artifacts from BS_URL, which is external_url
+# in cluster-desc if the bootstrapper sits behind a NAT or a load
+# balancer, or http://$BS_IP otherwise.
+BS_URL=${cluster_desc_external_url:-http://$BS_IP}
+BS_URL=${BS_URL%/}
+echo "Using bootstrapper server URL $BS_URL"
+
 KUBE_MASTER_HOSTNAME=`head -n $(grep -n 'kube_master\s*:\s*y' $CLUSTER_DESC | cut -d: -f1) $CLUSTER_DESC | grep mac: | tail | grep -o '..:..:..:..:..:..' | tr ':' '-'`
 if [[ "$?" -ne 0 || "$KUBE_MASTER_HOSTNAME" == ""  ]]; then
     echo "The cluster-desc file should container kube-master node."
@@ -281,7 +288,16 @@ prepare_setup_kubectl() {
 
 generate_addons_config() {
     printf "Generating configuration files ..."
-    mkdir -p $BSROOT/html/static/addons-config/
+    # Addons are applied by the addon manager on masters, so they
+    # all go into the master bundle, served as /addons/master.tar.gz.
+    mkdir -p $BSROOT/html/static/addons-config/master/
+    # ISC dhcpd, Kea and BIND equivalents of dnsmasq.conf, for
+    # appliances standing by for the bootstrapper, served as
+    # /static/standby/ and copied to $SEXTANT_STANDBY_DIR if set.
+    # The bootstrapper generates them again from its templates in
+    # config/standby/ whenever cluster-desc.yml is edited.
+    mkdir -p $BSROOT/html/static/standby/ $BSROOT/config/standby/
+    cp $SEXTANT_DIR/golang/addons/template/{isc-dhcpd.conf,kea-dhcp4.json,bind.zone}.template $BSROOT/config/standby/
 
     docker run --rm -it \
             --volume $GOPATH:/go \
@@ -294,9 +310,14 @@ generate_addons_config() {
 
     for file in $(ls $SEXTANT_DIR/golang/addons/template/|grep \.yaml$)
     do
-        cp $SEXTANT_DIR/golang/addons/template/$file $BSROOT/html/static/addons-config/$file;
+        cp $SEXTANT_DIR/golang/addons/template/$file $BSROOT/html/static/addons-config/master/$file;
     done
 
+    if [[ -n "${SEXTANT_STANDBY_DIR:-}" ]]; then
+        mkdir -p $SEXTANT_STANDBY_DIR
+        cp $BSROOT/html/static/standby/* $SEXTANT_STANDBY_DIR/
+    fi
+
     echo "Done"
 }
 
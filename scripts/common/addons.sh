@@ -6,37 +6,43 @@ set -o pipefail
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/ingress.template \
-    -config-file /bsroot/html/static/addons-config/ingress.yaml
+    -config-file /bsroot/html/static/addons-config/master/ingress.yaml
 
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/kubedns-controller.template \
-    -config-file /bsroot/html/static/addons-config/kubedns-controller.yaml
+    -config-file /bsroot/html/static/addons-config/master/kubedns-controller.yaml
 
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/kubedns-svc.template \
-    -config-file /bsroot/html/static/addons-config/kubedns-svc.yaml
+    -config-file /bsroot/html/static/addons-config/master/kubedns-svc.yaml
 
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/dnsmasq.conf.template \
     -config-file /bsroot/config/dnsmasq.conf
 
+for standby in isc-dhcpd.conf kea-dhcp4.json bind.zone; do
+    /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
+        -template-file /addons/template/$standby.template \
+        -config-file /bsroot/html/static/standby/$standby
+done
+
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/default-backend.template \
-    -config-file /bsroot/html/static/addons-config/default-backend.yaml
+    -config-file /bsroot/html/static/addons-config/master/default-backend.yaml
 
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/heapster-controller.template \
-    -config-file /bsroot/html/static/addons-config/heapster-controller.yaml
+    -config-file /bsroot/html/static/addons-config/master/heapster-controller.yaml
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/influxdb-grafana-controller.template \
-    -config-file /bsroot/html/static/addons-config/influxdb-grafana-controller.yaml
+    -config-file /bsroot/html/static/addons-config/master/influxdb-grafana-controller.yaml
 
 /go/bin/addons -cluster-desc-file /cluster-desc.yaml \
     -template-file /addons/template/dashboard-controller.template \
-    -config-file /bsroot/html/static/addons-config/dashboard-controller.yaml
+    -config-file /bsroot/html/static/addons-config/master/dashboard-controller.yaml
@@ -10,6 +10,13 @@ check_coreos_version () {
     echo "Done with coreos channel: " $cluster_desc_coreos_channel "version: " $VERSION
 }
 
+# record_checksum writes the sha256 of a file in the current directory,
+# whose signature has just been verified, to a .sha256 sidecar, against
+# which cloud-config-server verifies the file before serving it.
+record_checksum() {
+    sha256sum $1 > $1.sha256 || { echo "Failed"; exit 1; }
+}
+
 update_coreos_images() {
     printf "Updating CoreOS images ... "
     mkdir -p $BSROOT/html/static/$VERSION
@@ -19,6 +26,7 @@ update_coreos_images() {
     wget --quiet -c -N -P $BSROOT/html/static/$VERSION https://$cluster_desc_coreos_channel.release.core-os.net/amd64-usr/$cluster_desc_coreos_version/coreos_production_image.bin.bz2.sig || { echo "Failed"; exit 1; }
     cd $BSROOT/html/static/$VERSION
     gpg --verify coreos_production_image.bin.bz2.sig > /dev/null 2>&1 || { echo "Failed"; exit 1; }
+    record_checksum coreos_production_image.bin.bz2
     cd $BSROOT/html/static
     # Never change 'current' to 'current/', I beg you.
     rm -rf current > /dev/null 2>&1
@@ -54,6 +62,7 @@ download_pxe_images() {
     ln -s ../html/static/$VERSION/coreos_production_pxe.vmlinuz.sig ./ > /dev/null 2>&1 || { echo "Failed"; exit 1; }
     cd $BSROOT/tftpboot
     gpg --verify coreos_production_pxe.vmlinuz.sig > /dev/null 2>&1 || { echo "Failed"; exit 1; }
+    (cd $BSROOT/html/static/$VERSION && record_checksum coreos_production_pxe.vmlinuz)
     echo "Done"
 
     printf "Downloading CoreOS PXE CPIO image ... "
@@ -65,6 +74,7 @@ download_pxe_images() {
     rm -f $BSROOT/tftpboot/coreos_production_pxe_image.cpio.gz.sig > /dev/null 2>&1 || { echo "Failed"; exit 1; }
     ln -s ../html/static/$VERSION/coreos_production_pxe_image.cpio.gz.sig ./ > /dev/null 2>&1 || { echo "Failed"; exit 1; }
     gpg --verify coreos_production_pxe_image.cpio.gz.sig > /dev/null 2>&1 || { echo "Failed"; exit 1; }
+    (cd $BSROOT/html/static/$VERSION && record_checksum coreos_production_pxe_image.cpio.gz)
     echo "Done"
 }
 
@@ -77,7 +87,7 @@ default coreos
 
 label coreos
   kernel coreos_production_pxe.vmlinuz
-  append initrd=coreos_production_pxe_image.cpio.gz cloud-config-url=http://$BS_IP/static/cloud-config/install.sh coreos.autologin
+  append initrd=coreos_production_pxe_image.cpio.gz cloud-config-url=$BS_URL/static/cloud-config/install.sh coreos.autologin
 EOF
     echo "Done"
 }
@@ -100,7 +110,9 @@ generate_install_script() {
     printf "Generating CoreOS install script ... "
     mkdir -p $BSROOT/html/static/cloud-config
     cp $SEXTANT_DIR/scripts/coreos/install.sh $BSROOT/html/static/cloud-config/
-    sed -i -e 's/BS_IP/$BS_IP/g' $BSROOT/html/static/cloud-config/install.sh
+    sed -i -e "s#BS_URL#$BS_URL#g" $BSROOT/html/static/cloud-config/install.sh
+    cp $SEXTANT_DIR/scripts/coreos/push-install.sh $BSROOT/html/static/cloud-config/
+    sed -i -e "s#BS_URL#$BS_URL#g" $BSROOT/html/static/cloud-config/push-install.sh
 
     if [[ "$cluster_desc_zap_and_start_osd" =~ ^([yY][eE][sS]|[yY])+$ ]]; then
         sed -i -e 's/ZSP_AND_START_OSD/1/g' $BSROOT/html/static/cloud-config/install.sh
@@ -25,9 +25,11 @@ default_iface=$(awk '$2 == 00000000 { print $1  }' /proc/net/route | uniq)
 printf "Default interface: ${default_iface}\n"
 default_iface=$(echo ${default_iface} | awk '{ print \$1 }')
 
-mac_addr=$(ip addr show dev ${default_iface} | awk '$1 ~ /^link\// { print $2 }')
+# push-install.sh sets MAC to the MAC address of the node's PXE NIC,
+# as that is how cluster-desc.yml knows the node.
+mac_addr=${MAC:-$(ip addr show dev ${default_iface} | awk '$1 ~ /^link\// { print $2 }')}
 printf "Interface: ${default_iface} MAC address: ${mac_addr}\n"
 
-wget -O ${mac_addr}.yml http://BS_IP/cloud-config/${mac_addr}
-sudo coreos-install -d /dev/sda -c ${mac_addr}.yml -b http://BS_IP/static -V current && sudo reboot
+wget -O ${mac_addr}.yml BS_URL/cloud-config/${mac_addr}
+sudo coreos-install -d /dev/sda -c ${mac_addr}.yml -b BS_URL/static -V current && sudo reboot
 
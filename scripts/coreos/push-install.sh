@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+#
+# Installs CoreOS over SSH on a node that can't PXE boot, e.g., for
+# a broken option ROM, but runs a CoreOS live or installed system.
+# It runs install.sh there with the MAC address the node is enlisted
+# by in cluster-desc.yml, so it gets the same config as if it had PXE
+# booted.  Credentials are those of ssh, e.g., from ~/.ssh/config.
+#
+#   push-install.sh <mac> <[user@]host> [ssh options...]
+
+if [[ $# -lt 2 ]]; then
+    echo "Usage: $0 <mac> <[user@]host> [ssh options...]" >&2
+    exit 1
+fi
+mac=$1
+host=$2
+shift 2
+
+if ! [[ $mac =~ ^([0-9a-fA-F]{2}[:-]){5}[0-9a-fA-F]{2}$ ]]; then
+    echo "$mac is not a MAC address" >&2
+    exit 1
+fi
+mac=$(echo $mac | tr 'A-F-' 'a-f:')
+
+# Fail early if the bootstrapper can't render a config for the node.
+curl -fsS -o /dev/null "BS_URL/cloud-config/$mac?preflight" || { echo "Cannot render the cloud-config of $mac"; exit 1; }
+
+ssh "$@" $host "command -v coreos-install >/dev/null || { echo 'coreos-install not found, boot a CoreOS live system first' >&2; exit 1; }
+  curl -fsSL BS_URL/static/cloud-config/install.sh | sudo MAC=$mac bash"
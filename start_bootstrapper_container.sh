@@ -48,6 +48,7 @@ docker run -d \
        --privileged \
        -v /var/run/docker.sock:/var/run/docker.sock \
        -v $BSROOT:/bsroot \
+       -e SEXTANT_DHCP -e SEXTANT_REGISTRY -e SEXTANT_ALERT_URL -e SEXTANT_SSH_CA -e SEXTANT_ARP_PROBE_IFACE -e SEXTANT_ACCESS_LOG -e SEXTANT_DNS_CHECK_SERVER \
        bootstrapper || { echo "Failed"; exit -1; }
 
 # Sleep 3 seconds, waitting for registry started.